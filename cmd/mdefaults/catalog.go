@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+)
+
+// catalogFileSystem is the file system the user catalog is read from.
+type catalogFileSystem interface {
+	catalog.FileReader
+	UserHomeDir() (string, error)
+}
+
+// loadCatalog returns the built-in catalog extended with the user catalog.
+// When the user catalog cannot be read the built-in one is used alone.
+func loadCatalog(fs catalogFileSystem) *catalog.Catalog {
+	homeDir, err := fs.UserHomeDir()
+	if err != nil {
+		return catalog.Builtin()
+	}
+	c, err := catalog.Load(fs, homeDir)
+	if err != nil {
+		log.Printf("Failed to read the user catalog: %v", err)
+		printer.PrintWarning(fmt.Sprintf("Ignoring the user catalog: %v", err))
+	}
+	return c
+}
+
+// describe returns the catalog description of the key of cfg as a trailing
+// comment, or an empty string for keys the catalog does not know.
+func describe(c *catalog.Catalog, cfg config.Config) string {
+	description := c.Describe(cfg.Domain, cfg.Key)
+	if description == "" {
+		return ""
+	}
+	return color.New(color.Faint).Sprintf("  # %s", description)
+}
+
+// configuredEntries returns the entries of the configuration file at path for
+// explain, or none when the file cannot be loaded.
+func configuredEntries(fs config.FileSystemReader, path string) []config.Config {
+	tree, err := config.LoadTree(fs, path)
+	if err != nil {
+		log.Printf("Failed to read config file: %v", err)
+		return nil
+	}
+	configs, err := config.Resolve(tree.Configs(), profileFlag)
+	if err != nil {
+		log.Printf("Failed to apply profile: %v", err)
+		return nil
+	}
+	return configs
+}
+
+// handleSearch lists the catalog entries matching the words of args.
+func handleSearch(w io.Writer, c *catalog.Catalog, args []string) int {
+	if len(args) == 0 {
+		printer.PrintError("Usage: mdefaults search <text>")
+		return 1
+	}
+	matches := c.Search(strings.Join(args, " "))
+	if len(matches) == 0 {
+		fmt.Fprintf(w, "No known settings match %q\n", strings.Join(args, " "))
+		return 1
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tKEY\tTYPE\tDESCRIPTION")
+	for _, entry := range matches {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Domain, entry.Key, entry.Type, entry.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		log.Printf("Failed to print search results: %v", err)
+	}
+	return 0
+}
+
+// handleExplain prints what the catalog knows about a key of a domain,
+// followed by the entries of configs that configure it.
+func handleExplain(w io.Writer, c *catalog.Catalog, configs []config.Config, args []string) int {
+	if len(args) != 2 {
+		printer.PrintError("Usage: mdefaults explain <domain> <key>")
+		return 1
+	}
+	entry, ok := c.Lookup(args[0], args[1])
+	if !ok {
+		fmt.Fprintf(w, "%s %s is not in the catalog; try mdefaults search %s\n", args[0], args[1], args[1])
+		return 1
+	}
+
+	fmt.Fprintln(w, color.New(color.Bold).Sprintf("%s %s", entry.Domain, entry.Key))
+	fmt.Fprintf(w, "  %s\n", entry.Description)
+	fmt.Fprintf(w, "  Type: %s\n", entry.Type)
+	if entry.MacOS != "" {
+		fmt.Fprintf(w, "  macOS: %s\n", entry.MacOS)
+	}
+	if len(entry.Values) > 0 {
+		fmt.Fprintln(w, "  Values:")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, value := range entry.Values {
+			fmt.Fprintf(tw, "    %s\t%s\n", value.Value, value.Description)
+		}
+		if err := tw.Flush(); err != nil {
+			log.Printf("Failed to print catalog values: %v", err)
+		}
+	}
+	for _, cfg := range configs {
+		if e, ok := c.Lookup(cfg.Domain, cfg.Key); ok && e.Domain == entry.Domain && e.Key == entry.Key {
+			fmt.Fprintf(w, "  Configured: %s\n", config.FormatConfig(cfg))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+)
+
+func TestHandleSearch(t *testing.T) {
+	var buf bytes.Buffer
+	if code := handleSearch(&buf, catalog.Builtin(), []string{"ds_store"}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	expected := `DOMAIN                     KEY                       TYPE     DESCRIPTION
+com.apple.desktopservices  DSDontWriteNetworkStores  boolean  Do not create .DS_Store files on network volumes.
+com.apple.desktopservices  DSDontWriteUSBStores      boolean  Do not create .DS_Store files on USB volumes.
+`
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if code := handleSearch(&buf, catalog.Builtin(), []string{"no", "such", "setting"}); code != 1 {
+		t.Errorf("Expected exit code 1 without matches, got %d", code)
+	}
+	if buf.String() != "No known settings match \"no such setting\"\n" {
+		t.Errorf("Unexpected output %q", buf.String())
+	}
+}
+
+func TestHandleExplain(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	value := "2"
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "tilesize", Value: &value, Type: "integer"},
+		{Domain: "-g", Key: "AppleKeyboardUIMode", Value: &value, Type: "integer"},
+	}
+
+	var buf bytes.Buffer
+	if code := handleExplain(&buf, catalog.Builtin(), configs, []string{"NSGlobalDomain", "AppleKeyboardUIMode"}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	expected := `NSGlobalDomain AppleKeyboardUIMode
+  Full keyboard access, which lets Tab move the focus between all controls.
+  Type: integer
+  Values:
+    0  Text boxes and lists only
+    2  All controls, macOS 13 and later
+    3  All controls, macOS 12 and earlier
+  Configured: -g AppleKeyboardUIMode 2 integer
+`
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if code := handleExplain(&buf, catalog.Builtin(), nil, []string{"com.apple.dock", "show-recents"}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if expected := "com.apple.dock show-recents\n  Show suggested and recent applications in the Dock.\n  Type: boolean\n  macOS: 10.14+\n"; buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if code := handleExplain(&buf, catalog.Builtin(), nil, []string{"com.example.app", "Theme"}); code != 1 {
+		t.Errorf("Expected exit code 1 for an unknown key, got %d", code)
+	}
+}
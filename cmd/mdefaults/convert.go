@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+)
+
+// convertFileSystem is the file system convert reads and writes through.
+type convertFileSystem interface {
+	config.FileSystemReader
+	Stat(name string) (os.FileInfo, error)
+}
+
+// handleConvert writes the entries of a configuration file to another file in
+// the format given by its extension. With one argument the current
+// configuration file is converted.
+func handleConvert(fs convertFileSystem, doc config.Document, args []string) int {
+	var input string
+	switch len(args) {
+	case 1:
+	case 2:
+		input = args[0]
+	default:
+		printer.PrintError("Usage: mdefaults convert [input] <output>")
+		return 1
+	}
+	output := args[len(args)-1]
+
+	if input != "" {
+		var err error
+		doc, err = config.ReadDocument(fs, input)
+		if err != nil {
+			printer.PrintError(fmt.Sprintf("Failed to read %s: %v", input, err))
+			return 1
+		}
+	}
+	if inc, ok := doc.(interface{ Includes() []config.Include }); ok && len(inc.Includes()) > 0 {
+		printer.PrintWarning("Include directives are not converted; add them to the new file by hand.")
+	}
+	if _, err := fs.Stat(output); err == nil && !yesFlag {
+		printer.PrintError(fmt.Sprintf("%s already exists, use -y to overwrite it", output))
+		return 1
+	}
+
+	format := config.FormatForPath(output)
+	configs := doc.Configs()
+	var restarts []config.Restart
+	if r, ok := doc.(interface{ Restarts() []config.Restart }); ok {
+		restarts = r.Restarts()
+	}
+	converted, err := config.NewDocument(format, configs, restarts)
+	if err != nil {
+		log.Printf("Failed to convert configuration: %v", err)
+		return 1
+	}
+	if err := config.WriteDocument(fs, output, converted); err != nil {
+		printer.PrintError(fmt.Sprintf("Failed to write %s: %v", output, err))
+		return 1
+	}
+	printer.PrintSuccess(fmt.Sprintf("Converted %d entries to %s (%s format)", len(configs), output, format))
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/filesystem"
+)
+
+func TestHandleConvert(t *testing.T) {
+	originalYesFlag := yesFlag
+	defer func() { yesFlag = originalYesFlag }()
+	yesFlag = false
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "mdefaults")
+	output := filepath.Join(dir, "mdefaults.yaml")
+	if err := os.WriteFile(input, []byte("restart com.apple.dock Dock\ncom.apple.dock tilesize 48 integer\n"), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+	fs := filesystem.NewOSFileSystem()
+	doc := config.ParseLineDocument("")
+
+	if code := handleConvert(fs, doc, []string{input, output}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "restart:\n  com.apple.dock: Dock\ncom.apple.dock:\n  tilesize:\n    value: 48\n    type: integer\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+
+	if code := handleConvert(fs, doc, []string{input, output}); code != 1 {
+		t.Errorf("Expected an existing output to be kept, got exit code %d", code)
+	}
+	yesFlag = true
+	if code := handleConvert(fs, doc, []string{input, output}); code != 0 {
+		t.Errorf("Expected -y to overwrite the output, got exit code %d", code)
+	}
+}
+
+func TestHandleConvert_Usage(t *testing.T) {
+	if code := handleConvert(filesystem.NewOSFileSystem(), config.ParseLineDocument(""), nil); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+}
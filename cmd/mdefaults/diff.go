@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	diffop "github.com/fumiya-kume/mdefaults/internal/operation/diff"
+)
+
+// exitDrift is returned by the diff command when the system differs from the
+// configuration file.
+const exitDrift = 2
+
+func handleDiff(path string, configs []config.Config, knownSettings *catalog.Catalog) int {
+	results := diffop.Diff(configs)
+	printDiff(os.Stdout, path, results, knownSettings)
+	if diffop.HasDrift(results) {
+		return exitDrift
+	}
+	return 0
+}
+
+// printDiff writes a unified-style report: lines from the configuration file
+// at path are prefixed with "-", values found on the system with "+", and type
+// mismatches with "~". Entries that could not be read are prefixed with "!",
+// with the reason, such as the missing privileges of a system domain. The first line of each entry ends with the catalog
+// description of its key.
+func printDiff(w io.Writer, path string, results []diffop.Result, knownSettings *catalog.Catalog) {
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+	yellow := color.New(color.FgYellow)
+
+	fmt.Fprintf(w, "--- %s\n", path)
+	fmt.Fprintln(w, "+++ macOS")
+
+	counts := map[diffop.Status]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		cfg := result.Config
+		configLine := config.FormatConfig(cfg)
+		systemLine := config.FormatScope(cfg) + config.FormatLine(cfg.Domain, cfg.Key, result.SystemValue, result.SystemType)
+		description := describe(knownSettings, cfg)
+
+		switch result.Status {
+		case diffop.Added:
+			fmt.Fprintln(w, green.Sprintf("+ %s", systemLine)+description)
+		case diffop.Changed:
+			fmt.Fprintln(w, red.Sprintf("- %s", configLine)+description)
+			fmt.Fprintln(w, green.Sprintf("+ %s", systemLine))
+		case diffop.TypeMismatch:
+			fmt.Fprintln(w, yellow.Sprintf("~ %s (type %s on macOS)", configLine, result.SystemType)+description)
+		case diffop.MissingOnSystem:
+			fmt.Fprintln(w, red.Sprintf("- %s (missing on macOS)", configLine)+description)
+		case diffop.PresentOnSystem:
+			fmt.Fprintln(w, red.Sprintf("- %s", configLine)+description)
+			fmt.Fprintln(w, green.Sprintf("+ %s", systemLine))
+		case diffop.ReadFailed:
+			if errors.Is(result.Err, defaults.ErrPrivilegesRequired) {
+				fmt.Fprintln(w, yellow.Sprintf("! %s (administrator privileges are required to read it)", configLine)+description)
+				continue
+			}
+			fmt.Fprintln(w, yellow.Sprintf("! %s (could not read: %v)", configLine, result.Err)+description)
+		}
+	}
+
+	if !diffop.HasDrift(results) {
+		fmt.Fprintln(w, green.Sprint("Configuration is in sync with macOS"))
+		return
+	}
+	fmt.Fprintf(w, "%d added, %d changed, %d type mismatches, %d missing on macOS, %d to be deleted, %d unreadable\n",
+		counts[diffop.Added], counts[diffop.Changed], counts[diffop.TypeMismatch], counts[diffop.MissingOnSystem], counts[diffop.PresentOnSystem], counts[diffop.ReadFailed])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	diffop "github.com/fumiya-kume/mdefaults/internal/operation/diff"
+)
+
+func TestPrintDiff(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	value := func(s string) *string { return &s }
+	results := []diffop.Result{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "autohide", Value: value("1"), Type: "boolean"}, Status: diffop.InSync, SystemValue: "1", SystemType: "boolean"},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: value("48"), Type: "integer"}, Status: diffop.Changed, SystemValue: "64", SystemType: "integer"},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "orientation", Value: value(""), Type: "string"}, Status: diffop.Added, SystemValue: "left", SystemType: "string"},
+		{Config: config.Config{Domain: "com.apple.finder", Key: "ShowPathbar", Value: value("1"), Type: "string"}, Status: diffop.TypeMismatch, SystemValue: "1", SystemType: "boolean"},
+		{Config: config.Config{Domain: "com.example.app", Key: "name", Value: value("Screen Shot"), Type: "string"}, Status: diffop.MissingOnSystem},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true}, Status: diffop.PresentOnSystem, SystemValue: "1", SystemType: "boolean"},
+		{Config: config.Config{Domain: "com.example.app", Key: "theme", Value: value("dark"), Type: "string"}, Status: diffop.ReadFailed, Err: errors.New("signal: killed")},
+		{Config: config.Config{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Value: value("0"), Type: "boolean", System: true}, Status: diffop.ReadFailed, Err: fmt.Errorf("%w: Permission denied", defaults.ErrPrivilegesRequired)},
+	}
+
+	var buf bytes.Buffer
+	printDiff(&buf, "/Users/me/.mdefaults", results, catalog.Builtin())
+
+	expected := `--- /Users/me/.mdefaults
++++ macOS
+- com.apple.dock tilesize 48 integer  # Size of the Dock icons, in points from 16 to 128.
++ com.apple.dock tilesize 64 integer
++ com.apple.dock orientation left string  # Position of the Dock on the screen.
+~ com.apple.finder ShowPathbar 1 string (type boolean on macOS)  # Show the path bar at the bottom of Finder windows.
+- com.example.app name 'Screen Shot' string (missing on macOS)
+- !com.apple.dock mru-spaces  # Rearrange Spaces automatically based on most recent use.
++ com.apple.dock mru-spaces 1 boolean
+! com.example.app theme dark string (could not read: signal: killed)
+! -system com.apple.loginwindow GuestEnabled 0 boolean (administrator privileges are required to read it)  # Allow guest users to log in. A system domain.
+1 added, 1 changed, 1 type mismatches, 1 missing on macOS, 1 to be deleted, 2 unreadable
+`
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintDiff_InSync(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	var buf bytes.Buffer
+	printDiff(&buf, "/Users/me/.mdefaults", []diffop.Result{{Status: diffop.InSync}}, nil)
+
+	expected := "--- /Users/me/.mdefaults\n+++ macOS\nConfiguration is in sync with macOS\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"os"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
 var (
@@ -10,8 +13,41 @@ var (
 	vFlag       bool
 	verboseFlag bool
 	yesFlag     bool
+	dryRunFlag  bool
+	matchFlag   string
+	regexFlag   string
+	profileFlag string
+	configFlag  string
+	jobsFlag    int
+	sudoFlag    string
+
+	failFastFlag        bool
+	continueOnErrorFlag bool
+	batchFlag           bool
+	restartAppsFlag     bool
 )
 
+// parseArgs parses args with fs, allowing flags to follow positional
+// arguments as in "mdefaults import com.apple.dock --match 'tile*'". It
+// returns the positional arguments. Everything after "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
 // initFlags initializes command-line flags
 func initFlags() {
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -19,4 +55,15 @@ func initFlags() {
 	flag.BoolVar(&vFlag, "v", false, "Print version information")
 	flag.BoolVar(&verboseFlag, "verbose", false, "Enable verbose logging")
 	flag.BoolVar(&yesFlag, "y", false, "Automatically confirm prompts")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "Show what push would change without writing anything")
+	flag.StringVar(&matchFlag, "match", "", "Import only keys matching a glob pattern")
+	flag.StringVar(&regexFlag, "regex", "", "Import only keys matching a regular expression")
+	flag.StringVar(&profileFlag, "profile", "", "Apply the entries of a profile on top of the shared entries")
+	flag.StringVar(&configFlag, "config", "", "Path of the configuration file (defaults to $MDEFAULTS_CONFIG, then the XDG and home locations)")
+	flag.IntVar(&jobsFlag, "jobs", parallel.DefaultJobs, "Number of keys pull and push read or write at the same time")
+	flag.StringVar(&sudoFlag, "sudo", defaults.SudoPrompt.String(), "How push and rollback get root privileges for system domains: prompt or non-interactive")
+	flag.BoolVar(&failFastFlag, "fail-fast", false, "Stop push at the first entry that cannot be written")
+	flag.BoolVar(&continueOnErrorFlag, "continue-on-error", false, "Exit successfully from push even if some entries cannot be written")
+	flag.BoolVar(&batchFlag, "batch", false, "Write the changes to each domain with a single defaults import")
+	flag.BoolVar(&restartAppsFlag, "restart-apps", false, "Restart the apps whose domains push changed, such as the Dock and the Finder")
 }
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"os"
 	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
 func TestInitFlags(t *testing.T) {
@@ -19,6 +21,15 @@ func TestInitFlags(t *testing.T) {
 	vFlag = false
 	verboseFlag = false
 	yesFlag = false
+	dryRunFlag = false
+	failFastFlag = false
+	continueOnErrorFlag = false
+	batchFlag = false
+	restartAppsFlag = false
+	matchFlag = ""
+	regexFlag = ""
+	profileFlag = ""
+	configFlag = ""
 
 	// Initialize flags
 	initFlags()
@@ -34,6 +45,11 @@ func TestInitFlags(t *testing.T) {
 		{"v flag", []string{"cmd", "-v"}, &vFlag, true},
 		{"verbose flag", []string{"cmd", "-verbose"}, &verboseFlag, true},
 		{"y flag", []string{"cmd", "-y"}, &yesFlag, true},
+		{"dry-run flag", []string{"cmd", "--dry-run"}, &dryRunFlag, true},
+		{"fail-fast flag", []string{"cmd", "--fail-fast"}, &failFastFlag, true},
+		{"continue-on-error flag", []string{"cmd", "--continue-on-error"}, &continueOnErrorFlag, true},
+		{"batch flag", []string{"cmd", "--batch"}, &batchFlag, true},
+		{"restart-apps flag", []string{"cmd", "--restart-apps"}, &restartAppsFlag, true},
 	}
 
 	for _, tc := range testCases {
@@ -46,6 +62,15 @@ func TestInitFlags(t *testing.T) {
 			vFlag = false
 			verboseFlag = false
 			yesFlag = false
+			dryRunFlag = false
+			failFastFlag = false
+			continueOnErrorFlag = false
+			batchFlag = false
+			restartAppsFlag = false
+			matchFlag = ""
+			regexFlag = ""
+			profileFlag = ""
+			configFlag = ""
 
 			// Initialize flags
 			initFlags()
@@ -75,6 +100,15 @@ func TestFlagDefaults(t *testing.T) {
 	vFlag = false
 	verboseFlag = false
 	yesFlag = false
+	dryRunFlag = false
+	failFastFlag = false
+	continueOnErrorFlag = false
+	batchFlag = false
+	restartAppsFlag = false
+	matchFlag = ""
+	regexFlag = ""
+	profileFlag = ""
+	configFlag = ""
 
 	// Initialize flags
 	initFlags()
@@ -96,4 +130,112 @@ func TestFlagDefaults(t *testing.T) {
 	if yesFlag != false {
 		t.Errorf("Expected yesFlag default to be false, got %v", yesFlag)
 	}
+	if dryRunFlag != false {
+		t.Errorf("Expected dryRunFlag default to be false, got %v", dryRunFlag)
+	}
+	if profileFlag != "" {
+		t.Errorf("Expected profileFlag default to be empty, got %q", profileFlag)
+	}
+	if configFlag != "" {
+		t.Errorf("Expected configFlag default to be empty, got %q", configFlag)
+	}
+	if jobsFlag != parallel.DefaultJobs {
+		t.Errorf("Expected jobsFlag default to be %d, got %d", parallel.DefaultJobs, jobsFlag)
+	}
+	if sudoFlag != "prompt" {
+		t.Errorf("Expected sudoFlag default to be prompt, got %q", sudoFlag)
+	}
+}
+
+func TestSudoFlag(t *testing.T) {
+	originalSudo := sudoFlag
+	defer func() { sudoFlag = originalSudo }()
+
+	initFlags()
+	if _, err := parseArgs(flag.CommandLine, []string{"push", "--sudo", "non-interactive"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sudoFlag != "non-interactive" {
+		t.Errorf("Expected sudo non-interactive, got %q", sudoFlag)
+	}
+}
+
+func TestJobsFlag(t *testing.T) {
+	originalJobs := jobsFlag
+	defer func() { jobsFlag = originalJobs }()
+
+	initFlags()
+	if _, err := parseArgs(flag.CommandLine, []string{"pull", "--jobs", "1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if jobsFlag != 1 {
+		t.Errorf("Expected jobs 1, got %d", jobsFlag)
+	}
+}
+
+func TestProfileFlag(t *testing.T) {
+	originalProfile := profileFlag
+	defer func() { profileFlag = originalProfile }()
+
+	initFlags()
+	args, err := parseArgs(flag.CommandLine, []string{"--profile", "presentation", "-y"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if profileFlag != "presentation" || len(args) != 0 {
+		t.Errorf("Expected profile presentation and no arguments, got %q and %v", profileFlag, args)
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	originalConfig := configFlag
+	defer func() { configFlag = originalConfig }()
+
+	initFlags()
+	args, err := parseArgs(flag.CommandLine, []string{"diff", "--config", "dotfiles/mdefaults.toml"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if configFlag != "dotfiles/mdefaults.toml" || len(args) != 1 {
+		t.Errorf("Expected config dotfiles/mdefaults.toml and one argument, got %q and %v", configFlag, args)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		args       []string
+		positional []string
+		match      string
+		verbose    bool
+	}{
+		{"flags first", []string{"--match", "tile*", "com.apple.dock"}, []string{"com.apple.dock"}, "tile*", false},
+		{"flags after positional", []string{"com.apple.dock", "--match", "tile*", "-verbose"}, []string{"com.apple.dock"}, "tile*", true},
+		{"terminator", []string{"-verbose", "--", "-dash", "--match"}, []string{"-dash", "--match"}, "", true},
+		{"no arguments", nil, nil, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			match := fs.String("match", "", "")
+			verbose := fs.Bool("verbose", false, "")
+
+			positional, err := parseArgs(fs, tc.args)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(positional) != len(tc.positional) {
+				t.Fatalf("Expected %q, got %q", tc.positional, positional)
+			}
+			for i := range positional {
+				if positional[i] != tc.positional[i] {
+					t.Errorf("Expected %q, got %q", tc.positional, positional)
+				}
+			}
+			if *match != tc.match || *verbose != tc.verbose {
+				t.Errorf("Expected match=%q verbose=%v, got match=%q verbose=%v", tc.match, tc.verbose, *match, *verbose)
+			}
+		})
+	}
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	importop "github.com/fumiya-kume/mdefaults/internal/operation/importer"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+)
+
+// handleImport appends the keys of the domain named by args to the
+// configuration file. Keys already in the file or the files it includes are
+// left untouched.
+func handleImport(fs config.FileSystemReader, tree *config.Tree, args []string) int {
+	if len(args) != 1 {
+		printer.PrintError("Usage: mdefaults import <domain> [--match glob] [--regex re]")
+		return 1
+	}
+	domain := args[0]
+
+	filter, err := importop.NewFilter(matchFlag, regexFlag)
+	if err != nil {
+		printer.PrintError(err.Error())
+		return 1
+	}
+	configs, err := importop.Import(domain, filter)
+	if err != nil {
+		if errors.Is(err, defaults.ErrDomainNotFound) {
+			printer.PrintError(fmt.Sprintf("Domain %s does not exist", domain))
+			return 1
+		}
+		log.Printf("Failed to import %s: %v", domain, err)
+		printer.PrintError(fmt.Sprintf("Failed to import %s: %v", domain, err))
+		return 1
+	}
+
+	appended := tree.AppendMissing(configs)
+	if len(appended) > 0 {
+		if err := tree.Write(fs); err != nil {
+			log.Printf("Failed to write config file: %v", err)
+			return 1
+		}
+	}
+	printImport(os.Stdout, tree.Main().Path, domain, appended, len(configs)-len(appended))
+	return 0
+}
+
+func printImport(w io.Writer, path, domain string, appended []config.Config, existing int) {
+	green := color.New(color.FgGreen)
+	for _, cfg := range appended {
+		fmt.Fprintln(w, green.Sprintf("+ %s", config.FormatConfig(cfg)))
+	}
+	fmt.Fprintf(w, "Imported %d key(s) from %s, %d already in %s\n", len(appended), domain, existing, path)
+}
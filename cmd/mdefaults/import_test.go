@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+)
+
+func TestPrintImport(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	value := "48"
+	appended := []config.Config{{Domain: "com.apple.dock", Key: "tilesize", Value: &value, Type: "integer"}}
+
+	var buf bytes.Buffer
+	printImport(&buf, "/Users/me/.config/mdefaults/config.yaml", "com.apple.dock", appended, 2)
+
+	expected := "+ com.apple.dock tilesize 48 integer\nImported 1 key(s) from com.apple.dock, 2 already in /Users/me/.config/mdefaults/config.yaml\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
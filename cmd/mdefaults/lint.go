@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/operation/lint"
+)
+
+// handleLint checks the configuration file at path and the files it includes
+// without touching the system. It prints one "path:line: message" diagnostic
+// per problem, including the syntax errors and broken includes that keep the
+// files from being loaded, and returns 1 when there is any.
+func handleLint(w io.Writer, fs config.FileSystemReader, path string) int {
+	tree, err := config.LoadTree(fs, path)
+	var diagnostics []lint.Diagnostic
+	if err != nil {
+		diagnostics = lint.LoadErrors(err)
+	} else {
+		diagnostics = lint.Lint(tree.Files)
+	}
+	for _, d := range diagnostics {
+		fmt.Fprintln(w, d.String())
+	}
+	if len(diagnostics) > 0 {
+		fmt.Fprintln(w, color.New(color.FgRed).Sprintf("%d problem(s) found", len(diagnostics)))
+		return 1
+	}
+	fmt.Fprintln(w, color.New(color.FgGreen).Sprintf("No problems found in %d file(s)", len(tree.Files)))
+	return 0
+}
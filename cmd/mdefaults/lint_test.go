@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+)
+
+func TestHandleLint(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	fs := &config.MockFileSystem{Files: map[string]string{
+		"/home/.mdefaults":   "include dock.conf\ncom.apple.finder ShowPathbar yes boolean\n",
+		"/home/dock.conf":    "com.apple.dock tilesize big integer\ncom.apple.dock tilesize 48 integer\n",
+		"/home/clean.conf":   "com.apple.dock autohide 1 boolean\n",
+		"/home/broken.conf":  "com.apple.dock autohide 1 boolean\ninclude missing.conf\n",
+		"/home/syntax.conf":  "com.apple.dock autohide 1 boolean\ninclude bad.yaml\n",
+		"/home/bad.yaml":     "com.apple.dock:\n  autohide: [1\n",
+		"/home/invalid.yaml": "- com.apple.dock\n",
+	}}
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		expected string
+	}{
+		{
+			"problems in an included file",
+			"/home/.mdefaults",
+			1,
+			"/home/dock.conf:1: com.apple.dock tilesize: invalid integer \"big\"\n" +
+				"/home/dock.conf:2: com.apple.dock tilesize: duplicate entry, first given on line 1\n" +
+				"2 problem(s) found\n",
+		},
+		{
+			"clean",
+			"/home/clean.conf",
+			0,
+			"No problems found in 1 file(s)\n",
+		},
+		{
+			"broken include",
+			"/home/broken.conf",
+			1,
+			"/home/broken.conf:2: include missing.conf: file does not exist\n" +
+				"1 problem(s) found\n",
+		},
+		{
+			"syntax error in an included file",
+			"/home/syntax.conf",
+			1,
+			"/home/bad.yaml:1: did not find expected ',' or ']'\n" +
+				"1 problem(s) found\n",
+		},
+		{
+			"invalid main file",
+			"/home/invalid.yaml",
+			1,
+			"/home/invalid.yaml:1: expected a map of domains\n" +
+				"1 problem(s) found\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if code := handleLint(&buf, fs, tc.path); code != tc.code {
+				t.Errorf("Expected exit code %d, got %d", tc.code, code)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("Expected output:\n%s\nGot:\n%s", tc.expected, buf.String())
+			}
+		})
+	}
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 
-	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
 	"github.com/fumiya-kume/mdefaults/internal/config"
 	"github.com/fumiya-kume/mdefaults/internal/filesystem"
-	pullop "github.com/fumiya-kume/mdefaults/internal/operation/pull"
-	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 	"github.com/fumiya-kume/mdefaults/internal/printer"
 )
 
@@ -38,61 +39,77 @@ func run() int {
 	command := os.Args[1]
 
 	// Parse flags after the command
-	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+	args, err := parseArgs(flag.CommandLine, os.Args[2:])
+	if err != nil {
 		log.Printf("Failed to parse command line arguments: %v", err)
 		return 1
 	}
 
+	if verboseFlag {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+		log.Println("Verbose mode enabled")
+	}
+
 	fs := filesystem.NewOSFileSystem()
-	if err := filesystem.CreateConfigFileIfMissing(fs); err != nil {
-		log.Printf("Failed to create config file: %v", err)
+	// search and rollback need no configuration file.
+	switch command {
+	case "search":
+		return handleSearch(os.Stdout, loadCatalog(fs), args)
+	case "rollback":
+		return handleRollback(fs, args)
 	}
-	configs, err := config.ReadConfigFile(fs)
+	path, err := filesystem.ResolveConfigFilePath(fs, configFlag)
 	if err != nil {
-		log.Printf("Failed to read config file: %v", err)
+		log.Printf("Failed to locate config file: %v", err)
+		printer.PrintError(err.Error())
 		return 1
 	}
+	// Only the default file is created; an explicitly chosen path that does
+	// not exist is most likely a typo.
+	if homeDir, err := fs.UserHomeDir(); err == nil && path == config.DefaultConfigFilePath(homeDir) {
+		if err := filesystem.CreateConfigFileIfMissing(fs, path); err != nil {
+			log.Printf("Failed to create config file: %v", err)
+		}
+	}
+	// lint reports the problems that keep the files from loading itself, and
+	// explain works without a valid configuration.
+	switch command {
+	case "lint":
+		return handleLint(os.Stdout, fs, path)
+	case "explain":
+		return handleExplain(os.Stdout, loadCatalog(fs), configuredEntries(fs, path), args)
+	}
 
-	if verboseFlag {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-		log.Println("Verbose mode enabled")
+	tree, err := config.LoadTree(fs, path)
+	if err != nil {
+		log.Printf("Failed to read config file: %v", err)
+		printer.PrintError(err.Error())
+		return 1
+	}
+	configs, err := config.Resolve(tree.Configs(), profileFlag)
+	if err != nil {
+		printer.PrintError(err.Error())
+		return 1
 	}
 
+	knownSettings := loadCatalog(fs)
+
 	switch command {
 	case "pull":
-		fmt.Println("Current Configuration:")
-		printConfigs(configs)
-		fmt.Println("macOS Configuration:")
-		macOSConfigs, err := pullop.Pull(configs)
-		if err != nil {
-			printer.PrintError("Failed to pull configurations")
-			return 1
-		}
-		printConfigs(macOSConfigs)
-
-		if !yesFlag {
-			color.Yellow("Warning: mdefaults will override your configuration file (~/.mdefaults). Proceed with caution.")
-			fmt.Print("Do you want to continue? (yes/no): ")
-			var response string
-			if _, err := fmt.Scanln(&response); err != nil {
-				fmt.Println("Failed to read input, operation cancelled.")
-				return 1
-			}
-			if response != "yes" {
-				fmt.Println("Operation cancelled.")
-				return 0
-			}
-		}
-
-		printer.PrintSuccess("Configurations pulled successfully")
-		if err := config.WriteConfigFile(fs, macOSConfigs); err != nil {
-			log.Printf("Failed to write config file: %v", err)
-			return 1
-		}
-		return 0
+		return handlePull(fs, tree, configs, knownSettings)
 	case "push":
-		printConfigs(configs)
-		return handlePush(configs)
+		if dryRunFlag {
+			return handlePlan(configs, tree.Restarts(), knownSettings)
+		}
+		return handlePush(fs, configs, tree.Restarts(), knownSettings)
+	case "import":
+		return handleImport(fs, tree, args)
+	case "convert":
+		return handleConvert(fs, tree.Main().Doc, args)
+	case "plan":
+		return handlePlan(configs, tree.Restarts(), knownSettings)
+	case "diff":
+		return handleDiff(tree.Main().Path, configs, knownSettings)
 	case "debug":
 		log.Println("Debug command executed")
 		// Add more debug information here
@@ -103,26 +120,51 @@ func run() int {
 	}
 }
 
+// interruptible returns a context that is cancelled when the user presses
+// Ctrl-C. Until stop is called Ctrl-C does not end the process, so it should
+// only cover work that checks the context.
+func interruptible() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// limits returns the bounds pull and push work within.
+func limits() parallel.Limits {
+	return parallel.Limits{Jobs: jobsFlag}
+}
+
 func printUsage() {
 	fmt.Println("Usage: mdefaults [command]")
 	fmt.Println("Commands:")
-	fmt.Println("  pull    - Retrieve and update configuration values.")
-	fmt.Println("  push    - Write configuration values.")
+	fmt.Println("  pull     - Retrieve and update configuration values.")
+	fmt.Println("  push     - Write configuration values.")
+	fmt.Println("  plan     - Show the commands push would run (same as push --dry-run).")
+	fmt.Println("  diff     - Show differences between the configuration file and macOS.")
+	fmt.Println("  lint     - Check the configuration file for mistakes without touching macOS.")
+	fmt.Println("  search   - Find known settings whose domain, key or description contain the given words.")
+	fmt.Println("  explain  - Describe a known setting (explain <domain> <key>).")
+	fmt.Println("  import   - Add the keys of a domain to the configuration file (import <domain> [--match glob] [--regex re]).")
+	fmt.Println("  convert  - Convert the configuration file between the line, YAML and TOML formats (convert [input] <output>).")
+	fmt.Println("  rollback - Undo the last push, or the push that took the given snapshot id.")
+	fmt.Println("Use --profile <name> with pull, push, plan and diff to apply a profile on top of the shared entries.")
+	fmt.Println("Use --config <path> or set MDEFAULTS_CONFIG to choose the configuration file.")
+	fmt.Println("Use --jobs <n> with pull, push and plan to set how many keys are read or written at the same time.")
+	fmt.Println("Use --batch with push to write the changes to each domain with a single defaults import.")
+	fmt.Println("Use --restart-apps with push to restart the apps whose domains changed, such as the Dock and the Finder.")
+	fmt.Println("Use --sudo prompt|non-interactive with push and rollback to choose how system domains get root privileges.")
 	fmt.Println("Hey, let's call with pull or push.")
 }
 
-func printConfigs(configs []config.Config) {
+// printConfigs lists configs with the catalog description of their keys.
+func printConfigs(configs []config.Config, knownSettings *catalog.Catalog) {
 	for _, cfg := range configs {
-		fmt.Printf("- %s %s %s\n", cfg.Domain, cfg.Key, *cfg.Value)
+		if cfg.Absent {
+			fmt.Printf("- %s %s (absent)%s\n", cfg.Domain, cfg.Key, describe(knownSettings, cfg))
+			continue
+		}
+		fmt.Printf("- %s %s %s%s\n", cfg.Domain, cfg.Key, *cfg.Value, describe(knownSettings, cfg))
 	}
 }
 
-func handlePush(configs []config.Config) int {
-	pushop.Push(configs)
-	printer.PrintSuccess("Configurations pushed successfully")
-	return 0
-}
-
 // printVersionInfo prints the version and architecture information
 func printVersionInfo() {
 	fmt.Printf("Version: %s\n", version)
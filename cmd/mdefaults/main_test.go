@@ -62,7 +62,24 @@ func TestMain_NoCommand_ShowsHelp(t *testing.T) {
 		run()
 	})
 
-	expectedOutput := "Usage: mdefaults [command]\nCommands:\n  pull    - Retrieve and update configuration values.\n  push    - Write configuration values.\nHey, let's call with pull or push.\n"
+	expectedOutput := "Usage: mdefaults [command]\nCommands:\n" +
+		"  pull     - Retrieve and update configuration values.\n" +
+		"  push     - Write configuration values.\n" +
+		"  plan     - Show the commands push would run (same as push --dry-run).\n" +
+		"  diff     - Show differences between the configuration file and macOS.\n" +
+		"  lint     - Check the configuration file for mistakes without touching macOS.\n" +
+		"  search   - Find known settings whose domain, key or description contain the given words.\n" +
+		"  explain  - Describe a known setting (explain <domain> <key>).\n" +
+		"  import   - Add the keys of a domain to the configuration file (import <domain> [--match glob] [--regex re]).\n" +
+		"  convert  - Convert the configuration file between the line, YAML and TOML formats (convert [input] <output>).\n" +
+		"  rollback - Undo the last push, or the push that took the given snapshot id.\n" +
+		"Use --profile <name> with pull, push, plan and diff to apply a profile on top of the shared entries.\n" +
+		"Use --config <path> or set MDEFAULTS_CONFIG to choose the configuration file.\n" +
+		"Use --jobs <n> with pull, push and plan to set how many keys are read or written at the same time.\n" +
+		"Use --batch with push to write the changes to each domain with a single defaults import.\n" +
+		"Use --restart-apps with push to restart the apps whose domains changed, such as the Dock and the Finder.\n" +
+		"Use --sudo prompt|non-interactive with push and rollback to choose how system domains get root privileges.\n" +
+		"Hey, let's call with pull or push.\n"
 
 	if output != expectedOutput {
 		t.Errorf("Expected output:\n%s\nGot:\n%s", expectedOutput, output)
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	pullop "github.com/fumiya-kume/mdefaults/internal/operation/pull"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+)
+
+// handlePull reads the values of configs, the entries of tree resolved for
+// the selected profile, and writes them back to the entries they came from.
+func handlePull(fs config.FileSystemReader, tree *config.Tree, configs []config.Config, knownSettings *catalog.Catalog) int {
+	fmt.Println("Current Configuration:")
+	printConfigs(configs, knownSettings)
+	fmt.Println("macOS Configuration:")
+	ctx, stop := interruptible()
+	macOSConfigs, failures, err := pullop.Pull(ctx, configs, limits())
+	stop()
+	if errors.Is(err, context.Canceled) {
+		printer.PrintError("Pull interrupted, the configuration file was not changed")
+		return 1
+	}
+	if err != nil {
+		printer.PrintError("Failed to pull configurations")
+		return 1
+	}
+	printConfigs(macOSConfigs, knownSettings)
+	printPullFailures(os.Stdout, tree.Main().Path, failures)
+
+	if !yesFlag {
+		color.Yellow("Warning: mdefaults will update the values in your configuration file (%s). Proceed with caution.", tree.Main().Path)
+		fmt.Print("Do you want to continue? (yes/no): ")
+		var response string
+		if _, err := fmt.Scanln(&response); err != nil {
+			fmt.Println("Failed to read input, operation cancelled.")
+			return 1
+		}
+		if response != "yes" {
+			fmt.Println("Operation cancelled.")
+			return 0
+		}
+	}
+
+	tree.Update(macOSConfigs)
+	for _, failure := range failures {
+		tree.Mark(failure.Config, "not pulled, "+failure.Reason.String())
+	}
+	if err := tree.Write(fs); err != nil {
+		log.Printf("Failed to write config file: %v", err)
+		return 1
+	}
+	printer.PrintSuccess("Configurations pulled successfully")
+	return 0
+}
+
+// printPullFailures reports the keys pull could not read. Those entries keep
+// their value in the configuration file at path.
+func printPullFailures(w io.Writer, path string, failures []pullop.Failure) {
+	if len(failures) == 0 {
+		return
+	}
+	yellow := color.New(color.FgYellow)
+
+	fmt.Fprintln(w, yellow.Sprintf("Could not read %d key(s); they are kept in %s with a marker:", len(failures), path))
+	for _, failure := range failures {
+		line := fmt.Sprintf("  %s %s: %s", failure.Config.Domain, failure.Config.Key, failure.Reason)
+		if failure.Reason == pullop.CommandFailed {
+			line += fmt.Sprintf(" (%v)", failure.Err)
+		}
+		fmt.Fprintln(w, yellow.Sprint(line))
+	}
+}
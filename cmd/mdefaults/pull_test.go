@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	pullop "github.com/fumiya-kume/mdefaults/internal/operation/pull"
+)
+
+func TestPrintPullFailures(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	failures := []pullop.Failure{
+		{Config: config.Config{Domain: "com.example.app", Key: "theme"}, Reason: pullop.DomainAbsent, Err: errors.New("domain does not exist")},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Reason: pullop.CommandFailed, Err: errors.New("exit status 1")},
+	}
+
+	var buf bytes.Buffer
+	printPullFailures(&buf, "/Users/me/.mdefaults", failures)
+
+	expected := `Could not read 2 key(s); they are kept in /Users/me/.mdefaults with a marker:
+  com.example.app theme: domain absent
+  com.apple.dock tilesize: command failed (exit status 1)
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintPullFailures_None(t *testing.T) {
+	var buf bytes.Buffer
+	printPullFailures(&buf, "/Users/me/.mdefaults", nil)
+	if buf.String() != "" {
+		t.Errorf("Expected no output, got %q", buf.String())
+	}
+}
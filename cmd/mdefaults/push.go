@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+	"github.com/fumiya-kume/mdefaults/internal/operation/restart"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+	"github.com/fumiya-kume/mdefaults/internal/snapshot"
+)
+
+// snapshotFileSystem is the file system push and rollback keep snapshots in.
+type snapshotFileSystem interface {
+	snapshot.FileSystem
+	UserHomeDir() (string, error)
+}
+
+// handlePush writes configs to macOS. With --restart-apps it then restarts the
+// processes that restarts, and the built-in mapping, give for the changed
+// domains.
+func handlePush(fs snapshotFileSystem, configs []config.Config, restarts map[string][]string, knownSettings *catalog.Catalog) int {
+	if failFastFlag && continueOnErrorFlag {
+		printer.PrintError("--fail-fast and --continue-on-error cannot be used together")
+		return 1
+	}
+	sudoMode, err := defaults.ParseSudoMode(sudoFlag)
+	if err != nil {
+		printer.PrintError(err.Error())
+		return 1
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+	steps, err := pushop.Plan(ctx, configs, limits())
+	if err != nil {
+		printer.PrintError("Push interrupted, nothing was pushed")
+		return 1
+	}
+
+	// Record the current state of every key push is about to change so that
+	// `mdefaults rollback` can undo it. Nothing is written if this fails.
+	if s := newSnapshot(steps, time.Now()); len(s.Entries) > 0 {
+		if err := recordContainers(ctx, s, newDomainCommand); err != nil {
+			log.Printf("Failed to record the values of arrays and dicts: %v", err)
+			printer.PrintError(fmt.Sprintf("Failed to save a snapshot, nothing was pushed: %v", err))
+			return 1
+		}
+		if err := saveSnapshot(fs, s); err != nil {
+			log.Printf("Failed to save snapshot: %v", err)
+			printer.PrintError("Failed to save a snapshot, nothing was pushed")
+			return 1
+		}
+		fmt.Printf("Saved snapshot %s (undo with: mdefaults rollback)\n", s.ID)
+	}
+
+	opts := pushop.Options{
+		FailFast:   failFastFlag,
+		Limits:     limits(),
+		Batch:      batchFlag,
+		Privileged: defaults.SudoRunner{Mode: sudoMode},
+	}
+	results := pushop.Apply(ctx, steps, opts)
+	printPushResults(os.Stdout, results, knownSettings)
+	if needsPrivileges(results) {
+		printer.PrintWarning("System domains are written with sudo; run push from a terminal, or authorize with `sudo -v` first when using --sudo non-interactive")
+	}
+	if restartAppsFlag && ctx.Err() == nil {
+		restartApps(ctx, os.Stdout, restart.CommandImpl{}, restart.NewMap(restarts), results)
+	}
+	if ctx.Err() != nil {
+		printer.PrintError("Push interrupted, run mdefaults rollback to undo the entries that were applied")
+		return 1
+	}
+	if !pushop.Failed(results) {
+		printer.PrintSuccess("Configurations pushed successfully")
+		return 0
+	}
+	if continueOnErrorFlag {
+		printer.PrintWarning("Some configurations could not be pushed")
+		return 0
+	}
+	printer.PrintError("Some configurations could not be pushed")
+	return 1
+}
+
+// needsPrivileges reports whether an entry failed for lack of root
+// privileges.
+func needsPrivileges(results []pushop.Result) bool {
+	for _, result := range results {
+		if result.Status == pushop.StatusFailed && errors.Is(result.Err, defaults.ErrPrivilegesRequired) {
+			return true
+		}
+	}
+	return false
+}
+
+// printPushResults prints a table of the entries push wrote, skipped or failed
+// to write, with the catalog description of their keys, followed by a count of
+// every status. Unchanged entries are only counted.
+func printPushResults(w io.Writer, results []pushop.Result, knownSettings *catalog.Catalog) {
+	statusColors := map[pushop.Status]*color.Color{
+		pushop.StatusApplied: color.New(color.FgGreen),
+		pushop.StatusSkipped: color.New(color.FgYellow),
+		pushop.StatusFailed:  color.New(color.FgRed),
+	}
+
+	counts := map[pushop.Status]int{}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := false
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Status == pushop.StatusUnchanged {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(tw, "DOMAIN\tKEY\tSTATUS     DETAIL")
+			header = true
+		}
+		detail := ""
+		if result.Err != nil {
+			detail = result.Err.Error()
+		} else if result.Config.Absent {
+			detail = "(deleted)"
+		} else if result.Config.Value != nil {
+			detail = *result.Config.Value
+		}
+		// The status is padded before coloring because the escape codes
+		// would otherwise count towards the column width.
+		status := statusColors[result.Status].Sprintf("%-9s", result.Status)
+		fmt.Fprintf(tw, "%s\t%s\t%s  %s%s\n", result.Config.Domain, result.Config.Key, status, detail, describe(knownSettings, result.Config))
+	}
+	if err := tw.Flush(); err != nil {
+		log.Printf("Failed to print push results: %v", err)
+	}
+	fmt.Fprintf(w, "Push: %d applied, %d unchanged, %d skipped, %d failed\n",
+		counts[pushop.StatusApplied], counts[pushop.StatusUnchanged], counts[pushop.StatusSkipped], counts[pushop.StatusFailed])
+}
+
+// newSnapshot records the state of the keys the write steps change.
+func newSnapshot(steps []pushop.Step, now time.Time) *snapshot.Snapshot {
+	var entries []snapshot.Entry
+	for _, step := range steps {
+		if step.Action != pushop.ActionWrite && step.Action != pushop.ActionDelete {
+			continue
+		}
+		entry := snapshot.Entry{Domain: step.Config.Domain, Key: step.Config.Key, Host: step.Config.Host, System: step.Config.System, Exists: step.Exists}
+		if step.Exists {
+			entry.Value = step.CurrentValue
+			entry.Type = step.CurrentType
+		}
+		entries = append(entries, entry)
+	}
+	return snapshot.New(entries, now)
+}
+
+func newDomainCommand(domain string, scope defaults.Scope) defaults.DomainCommand {
+	return defaults.NewScopedDomainCommandImpl(domain, scope)
+}
+
+// recordContainers stores the exported value of the array and dict keys of s
+// in their Plist, since the text of defaults read loses the types of nested
+// values. Each domain is exported once.
+func recordContainers(ctx context.Context, s *snapshot.Snapshot, newDomainCmd func(domain string, scope defaults.Scope) defaults.DomainCommand) error {
+	exports := map[defaults.Scope]map[string]*plist.Value{}
+	for i := range s.Entries {
+		entry := &s.Entries[i]
+		if !entry.Exists || (entry.Type != "array" && entry.Type != "dict") {
+			continue
+		}
+		scope := defaults.Scope{Host: entry.Host, System: entry.System}
+		tree, ok := exports[scope][entry.Domain]
+		if !ok {
+			domainCmd := newDomainCmd(entry.Domain, scope)
+			output, err := domainCmd.Export(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", entry.Domain, err)
+			}
+			if tree, _, err = plist.Decode(output); err != nil {
+				return fmt.Errorf("failed to parse the export of %s: %w", entry.Domain, err)
+			}
+			if exports[scope] == nil {
+				exports[scope] = map[string]*plist.Value{}
+			}
+			exports[scope][entry.Domain] = tree
+		}
+		value := tree.Get(entry.Key)
+		if value == nil {
+			return fmt.Errorf("%s %s is missing from the export of its domain", entry.Domain, entry.Key)
+		}
+		data, err := plist.FormatXML(value)
+		if err != nil {
+			return err
+		}
+		entry.Plist = string(data)
+	}
+	return nil
+}
+
+func saveSnapshot(fs snapshotFileSystem, s *snapshot.Snapshot) error {
+	dir, err := snapshotDir(fs)
+	if err != nil {
+		return err
+	}
+	return snapshot.Save(fs, dir, s)
+}
+
+func snapshotDir(fs snapshotFileSystem) (string, error) {
+	homeDir, err := fs.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return snapshot.Dir(homeDir), nil
+}
+
+// handlePlan prints the commands push would run without touching the system.
+func handlePlan(configs []config.Config, restarts map[string][]string, knownSettings *catalog.Catalog) int {
+	ctx, stop := interruptible()
+	defer stop()
+	steps, err := pushop.Plan(ctx, configs, limits())
+	if err != nil {
+		printer.PrintError("Plan interrupted")
+		return 1
+	}
+	printPlan(os.Stdout, steps, knownSettings)
+	if restartAppsFlag {
+		printPlannedRestarts(os.Stdout, restart.NewMap(restarts), steps)
+	}
+	return 0
+}
+
+// printPlan prints the command of each step that changes the system, followed
+// by the catalog description of its key as a shell comment.
+func printPlan(w io.Writer, steps []pushop.Step, knownSettings *catalog.Catalog) {
+	red := color.New(color.FgRed)
+
+	writes, deletes, unchanged, skipped := 0, 0, 0, 0
+	for _, step := range steps {
+		switch step.Action {
+		case pushop.ActionWrite:
+			writes++
+			fmt.Fprintln(w, step.Command()+describe(knownSettings, step.Config))
+		case pushop.ActionDelete:
+			deletes++
+			fmt.Fprintln(w, step.Command()+describe(knownSettings, step.Config))
+		case pushop.ActionUnchanged:
+			unchanged++
+		case pushop.ActionSkip:
+			skipped++
+		case pushop.ActionInvalid:
+			skipped++
+			fmt.Fprintln(w, red.Sprintf("# %s %s: %v", step.Config.Domain, step.Config.Key, step.Err))
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to write, %d to delete, %d unchanged, %d skipped\n", writes, deletes, unchanged, skipped)
+}
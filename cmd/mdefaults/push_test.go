@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/catalog"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+)
+
+func TestPrintPlan(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	steps := []pushop.Step{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Action: pushop.ActionWrite, Args: []string{"write", "com.apple.dock", "tilesize", "-int", "48"}},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "autohide"}, Action: pushop.ActionUnchanged},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "orientation"}, Action: pushop.ActionSkip},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "persistent-apps"}, Action: pushop.ActionInvalid, Err: errors.New("invalid array value")},
+		{Config: config.Config{Domain: "com.apple.screencapture", Key: "name"}, Action: pushop.ActionWrite, Args: []string{"write", "com.apple.screencapture", "name", "Screen Shot"}},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true}, Action: pushop.ActionDelete, Args: []string{"delete", "com.apple.dock", "mru-spaces"}},
+	}
+
+	var buf bytes.Buffer
+	printPlan(&buf, steps, catalog.Builtin())
+
+	expected := `defaults write com.apple.dock tilesize -int 48  # Size of the Dock icons, in points from 16 to 128.
+# com.apple.dock persistent-apps: invalid array value
+defaults write com.apple.screencapture name 'Screen Shot'  # Prefix of the file names of screenshots.
+defaults delete com.apple.dock mru-spaces  # Rearrange Spaces automatically based on most recent use.
+Plan: 2 to write, 1 to delete, 1 unchanged, 2 skipped
+`
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintPushResults(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	value := "48"
+	results := []pushop.Result{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: &value}, Status: pushop.StatusApplied},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "autohide"}, Status: pushop.StatusUnchanged},
+		{Config: config.Config{Domain: "com.apple.finder", Key: "ShowPathbar"}, Status: pushop.StatusFailed, Err: errors.New("write error")},
+		{Config: config.Config{Domain: "com.apple.finder", Key: "NewWindowTarget"}, Status: pushop.StatusSkipped, Err: pushop.ErrNotAttempted},
+	}
+
+	var buf bytes.Buffer
+	printPushResults(&buf, results, catalog.Builtin())
+
+	expected := `DOMAIN            KEY              STATUS     DETAIL
+com.apple.dock    tilesize         applied    48  # Size of the Dock icons, in points from 16 to 128.
+com.apple.finder  ShowPathbar      failed     write error  # Show the path bar at the bottom of Finder windows.
+com.apple.finder  NewWindowTarget  skipped    not attempted after an earlier failure  # Folder new Finder windows open.
+Push: 1 applied, 1 unchanged, 1 skipped, 1 failed
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintPushResults_AllUnchanged(t *testing.T) {
+	results := []pushop.Result{{Config: config.Config{Domain: "com.apple.dock", Key: "autohide"}, Status: pushop.StatusUnchanged}}
+
+	var buf bytes.Buffer
+	printPushResults(&buf, results, nil)
+
+	if expected := "Push: 0 applied, 1 unchanged, 0 skipped, 0 failed\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestNeedsPrivileges(t *testing.T) {
+	results := []pushop.Result{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Status: pushop.StatusFailed, Err: errors.New("exit status 1")},
+	}
+	if needsPrivileges(results) {
+		t.Error("Expected an ordinary failure not to need privileges")
+	}
+	results = append(results, pushop.Result{
+		Config: config.Config{Domain: "com.apple.loginwindow", Key: "SHOWFULLNAME", System: true},
+		Status: pushop.StatusFailed,
+		Err:    fmt.Errorf("%w: sudo: a password is required", defaults.ErrPrivilegesRequired),
+	})
+	if !needsPrivileges(results) {
+		t.Error("Expected a failed system entry to need privileges")
+	}
+}
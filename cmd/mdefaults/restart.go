@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/fatih/color"
+	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+	"github.com/fumiya-kume/mdefaults/internal/operation/restart"
+)
+
+// restartApps restarts the processes of the domains push changed and reports
+// the processes that could not be restarted.
+func restartApps(ctx context.Context, w io.Writer, cmd restart.Command, m restart.Map, results []pushop.Result) {
+	var domains []string
+	for _, result := range results {
+		if result.Status == pushop.StatusApplied {
+			domains = append(domains, result.Config.Domain)
+		}
+	}
+	for _, result := range restart.Restart(ctx, cmd, m.Processes(domains)) {
+		if result.Err != nil {
+			log.Printf("Failed to restart %s: %v", result.Process, result.Err)
+			fmt.Fprintln(w, color.New(color.FgYellow).Sprintf("Could not restart %s: %v", result.Process, result.Err))
+			continue
+		}
+		fmt.Fprintf(w, "Restarted %s\n", result.Process)
+	}
+}
+
+// printPlannedRestarts lists the processes push --restart-apps would restart
+// after the steps of a plan.
+func printPlannedRestarts(w io.Writer, m restart.Map, steps []pushop.Step) {
+	var domains []string
+	for _, step := range steps {
+		if step.Action == pushop.ActionWrite || step.Action == pushop.ActionDelete {
+			domains = append(domains, step.Config.Domain)
+		}
+	}
+	processes := m.Processes(domains)
+	if len(processes) == 0 {
+		fmt.Fprintln(w, "No apps to restart")
+		return
+	}
+	fmt.Fprintf(w, "Would restart: %s\n", strings.Join(processes, ", "))
+}
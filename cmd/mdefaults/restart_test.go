@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+	"github.com/fumiya-kume/mdefaults/internal/operation/restart"
+)
+
+func TestRestartApps(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	results := []pushop.Result{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Status: pushop.StatusApplied},
+		{Config: config.Config{Domain: "com.apple.finder", Key: "ShowPathbar"}, Status: pushop.StatusUnchanged},
+		{Config: config.Config{Domain: "com.apple.menuextra.clock", Key: "ShowSeconds"}, Status: pushop.StatusApplied},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "autohide"}, Status: pushop.StatusApplied},
+	}
+	cmd := &restart.MockCommand{Errors: map[string]error{"SystemUIServer": errors.New("no matching processes")}}
+
+	var buf bytes.Buffer
+	restartApps(context.Background(), &buf, cmd, restart.NewMap(nil), results)
+
+	expected := "Restarted Dock\nCould not restart SystemUIServer: no matching processes\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintPlannedRestarts(t *testing.T) {
+	steps := []pushop.Step{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Action: pushop.ActionWrite},
+		{Config: config.Config{Domain: "com.apple.finder", Key: "ShowPathbar"}, Action: pushop.ActionUnchanged},
+		{Config: config.Config{Domain: "com.example.app", Key: "theme"}, Action: pushop.ActionDelete},
+	}
+
+	var buf bytes.Buffer
+	printPlannedRestarts(&buf, restart.NewMap(map[string][]string{"com.example.app": {"Example"}}), steps)
+	if expected := "Would restart: Dock, Example\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	printPlannedRestarts(&buf, restart.NewMap(nil), steps[1:2])
+	if expected := "No apps to restart\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
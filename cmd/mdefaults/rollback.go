@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	rollbackop "github.com/fumiya-kume/mdefaults/internal/operation/rollback"
+	"github.com/fumiya-kume/mdefaults/internal/printer"
+	"github.com/fumiya-kume/mdefaults/internal/snapshot"
+)
+
+// handleRollback restores the snapshot named by args, or the latest one.
+func handleRollback(fs snapshotFileSystem, args []string) int {
+	if len(args) > 1 {
+		printer.PrintError("Usage: mdefaults rollback [snapshot-id]")
+		return 1
+	}
+	dir, err := snapshotDir(fs)
+	if err != nil {
+		log.Printf("Failed to locate snapshots: %v", err)
+		return 1
+	}
+
+	sudoMode, err := defaults.ParseSudoMode(sudoFlag)
+	if err != nil {
+		printer.PrintError(err.Error())
+		return 1
+	}
+
+	var s *snapshot.Snapshot
+	if len(args) == 1 {
+		s, err = snapshot.Load(fs, dir, args[0])
+	} else {
+		s, err = snapshot.Latest(fs, dir)
+	}
+	if err != nil {
+		if errors.Is(err, snapshot.ErrNoSnapshots) {
+			printer.PrintError("No snapshots to roll back to. Snapshots are taken by mdefaults push.")
+			return 1
+		}
+		printer.PrintError(fmt.Sprintf("Failed to load snapshot: %v", err))
+		if ids, listErr := snapshot.List(fs, dir); listErr == nil && len(ids) > 0 {
+			fmt.Printf("Available snapshots: %s\n", strings.Join(ids, ", "))
+		}
+		return 1
+	}
+
+	fmt.Printf("Rolling back snapshot %s\n", s.ID)
+	if failed := printRollback(os.Stdout, rollbackop.Rollback(s, defaults.SudoRunner{Mode: sudoMode})); failed > 0 {
+		printer.PrintError(fmt.Sprintf("Failed to restore %d of %d keys", failed, len(s.Entries)))
+		return 1
+	}
+	printer.PrintSuccess("Rollback completed successfully")
+	return 0
+}
+
+// printRollback prints one line per restored key and returns the number of
+// keys that could not be restored.
+func printRollback(w io.Writer, results []rollbackop.Result) int {
+	red := color.New(color.FgRed)
+
+	failed := 0
+	for _, result := range results {
+		entry := result.Entry
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Fprintln(w, red.Sprintf("! %s %s: %v", entry.Domain, entry.Key, result.Err))
+		case result.Deleted:
+			fmt.Fprintf(w, "- %s %s (deleted)\n", entry.Domain, entry.Key)
+		default:
+			fmt.Fprintf(w, "  %s %s -> %s\n", entry.Domain, entry.Key, entry.Value)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	pushop "github.com/fumiya-kume/mdefaults/internal/operation/push"
+	rollbackop "github.com/fumiya-kume/mdefaults/internal/operation/rollback"
+	"github.com/fumiya-kume/mdefaults/internal/snapshot"
+)
+
+func TestNewSnapshot_RecordsOnlyWrites(t *testing.T) {
+	steps := []pushop.Step{
+		{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize"}, Action: pushop.ActionWrite, Exists: true, CurrentValue: "64", CurrentType: "integer"},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "autohide"}, Action: pushop.ActionUnchanged, Exists: true, CurrentValue: "1", CurrentType: "boolean"},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "orientation"}, Action: pushop.ActionWrite, Exists: false},
+		{Config: config.Config{Domain: "com.apple.dock", Key: "largesize"}, Action: pushop.ActionInvalid, Err: errors.New("could not read the current value")},
+	}
+
+	s := newSnapshot(steps, time.Now())
+
+	expected := []snapshot.Entry{
+		{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"},
+		{Domain: "com.apple.dock", Key: "orientation", Exists: false},
+	}
+	if len(s.Entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(s.Entries))
+	}
+	for i := range expected {
+		if s.Entries[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], s.Entries[i])
+		}
+	}
+}
+
+func TestRecordContainers(t *testing.T) {
+	dock := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: "{persistent-apps = ({GUID = 1234;}); persistent-others = (); tilesize = 48;}"}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{
+		{Domain: "com.apple.dock", Key: "persistent-apps", Exists: true, Value: "({GUID = 1234;})", Type: "array"},
+		{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "48", Type: "integer"},
+		{Domain: "com.apple.dock", Key: "persistent-others", Exists: true, Value: "()", Type: "array"},
+	}}
+
+	err := recordContainers(context.Background(), s, func(domain string, scope defaults.Scope) defaults.DomainCommand { return dock })
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dock.Exports != 1 {
+		t.Errorf("Expected the domain to be exported once, got %d", dock.Exports)
+	}
+	if !strings.Contains(s.Entries[0].Plist, "<key>GUID</key>") || s.Entries[1].Plist != "" || !strings.Contains(s.Entries[2].Plist, "<array/>") {
+		t.Errorf("Expected the property lists of the arrays only, got %+v", s.Entries)
+	}
+
+	s.Entries[0].Key = "removed"
+	if err := recordContainers(context.Background(), s, func(domain string, scope defaults.Scope) defaults.DomainCommand { return dock }); err == nil {
+		t.Error("Expected an error for a key missing from the export")
+	}
+}
+
+func TestPrintRollback(t *testing.T) {
+	originalNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = originalNoColor }()
+
+	results := []rollbackop.Result{
+		{Entry: snapshot.Entry{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"}},
+		{Entry: snapshot.Entry{Domain: "com.apple.dock", Key: "orientation"}, Deleted: true},
+		{Entry: snapshot.Entry{Domain: "com.apple.dock", Key: "autohide", Exists: true, Value: "1", Type: "boolean"}, Err: errors.New("write error")},
+	}
+
+	var buf bytes.Buffer
+	failed := printRollback(&buf, results)
+
+	expected := "  com.apple.dock tilesize -> 64\n- com.apple.dock orientation (deleted)\n! com.apple.dock autohide: write error\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+	if failed != 1 {
+		t.Errorf("Expected 1 failure, got %d", failed)
+	}
+}
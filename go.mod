@@ -3,7 +3,12 @@ module github.com/fumiya-kume/mdefaults
 go 1.23
 
 require (
-	github.com/fatih/color v1.18.0 // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fatih/color v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/sys v0.25.0 // indirect
@@ -0,0 +1,204 @@
+// Package catalog describes well-known defaults keys: what they do, the type
+// they hold, the values they accept and the macOS versions they apply to.
+package catalog
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"gopkg.in/yaml.v3"
+)
+
+// builtinCatalog is the catalog shipped with mdefaults. It maps domains to
+// keys to entries, in the format Parse reads.
+//
+//go:embed catalog.yaml
+var builtinCatalog string
+
+// Entry describes a key of a domain.
+type Entry struct {
+	Domain      string  `yaml:"-"`
+	Key         string  `yaml:"-"`
+	Description string  `yaml:"description"`
+	Type        string  `yaml:"type"`
+	Values      []Value `yaml:"values"`
+	// MacOS gives the macOS versions the key applies to, such as "10.14+"
+	// or "10.9-12". It is empty when the key applies to every version.
+	MacOS string `yaml:"macos"`
+}
+
+// Value is an allowed value of a key and what it means.
+type Value struct {
+	Value       string `yaml:"value"`
+	Description string `yaml:"description"`
+}
+
+// Catalog holds entries by domain and key.
+type Catalog struct {
+	entries map[string]map[string]Entry
+}
+
+// globalDomainAliases are the names defaults accepts for NSGlobalDomain.
+var globalDomainAliases = map[string]bool{"-g": true, "-globalDomain": true, "Apple Global Domain": true}
+
+// Builtin returns the catalog shipped with mdefaults.
+func Builtin() *Catalog {
+	c, err := Parse(builtinCatalog)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in catalog: %v", err))
+	}
+	return c
+}
+
+// Parse reads a catalog given as YAML, a map of domains to maps of keys to
+// entries:
+//
+//	com.apple.dock:
+//	  mru-spaces:
+//	    description: Rearrange Spaces automatically based on most recent use.
+//	    type: boolean
+//	    macos: "10.7+"
+//
+// Every entry needs a description, and its type must be one push writes.
+func Parse(content string) (*Catalog, error) {
+	var domains map[string]map[string]Entry
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&domains); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	c := &Catalog{entries: map[string]map[string]Entry{}}
+	for domain, keys := range domains {
+		for key, entry := range keys {
+			if entry.Description == "" {
+				return nil, fmt.Errorf("%s %s: description is missing", domain, key)
+			}
+			if entry.Type == "" {
+				entry.Type = "string"
+			}
+			if !defaults.IsKnownType(entry.Type) {
+				return nil, fmt.Errorf("%s %s: unknown type %q", domain, key, entry.Type)
+			}
+			entry.Domain, entry.Key = domain, key
+			c.add(entry)
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) add(entry Entry) {
+	if c.entries[entry.Domain] == nil {
+		c.entries[entry.Domain] = map[string]Entry{}
+	}
+	c.entries[entry.Domain][entry.Key] = entry
+}
+
+// Merge adds the entries of other to c, replacing those for the same domain
+// and key, and returns c.
+func (c *Catalog) Merge(other *Catalog) *Catalog {
+	for _, entry := range other.Entries() {
+		c.add(entry)
+	}
+	return c
+}
+
+// Lookup returns the entry for key of domain. NSGlobalDomain may be given by
+// any of the names defaults accepts for it. A nil catalog has no entries.
+func (c *Catalog) Lookup(domain, key string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	if globalDomainAliases[domain] {
+		domain = "NSGlobalDomain"
+	}
+	entry, ok := c.entries[domain][key]
+	return entry, ok
+}
+
+// Describe returns the description of key of domain, or an empty string for
+// keys that are not in the catalog.
+func (c *Catalog) Describe(domain, key string) string {
+	entry, _ := c.Lookup(domain, key)
+	return entry.Description
+}
+
+// Entries returns every entry, sorted by domain and key.
+func (c *Catalog) Entries() []Entry {
+	var entries []Entry
+	for _, keys := range c.entries {
+		for _, entry := range keys {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Domain != entries[j].Domain {
+			return entries[i].Domain < entries[j].Domain
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// Search returns the entries whose domain, key or description contain every
+// word of text, ignoring case, sorted by domain and key.
+func (c *Catalog) Search(text string) []Entry {
+	words := strings.Fields(strings.ToLower(text))
+	var matches []Entry
+	for _, entry := range c.Entries() {
+		haystack := strings.ToLower(entry.Domain + " " + entry.Key + " " + entry.Description)
+		matched := true
+		for _, word := range words {
+			if !strings.Contains(haystack, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// FileReader reads the user catalog.
+type FileReader interface {
+	ReadFile(name string) (string, error)
+}
+
+// UserPath returns the catalog file in which users describe keys of their
+// own, $XDG_CONFIG_HOME/mdefaults/catalog.yaml or
+// ~/.config/mdefaults/catalog.yaml.
+func UserPath(homeDir string) string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" || !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "mdefaults", "catalog.yaml")
+}
+
+// Load returns the built-in catalog extended with the user catalog in
+// homeDir, whose entries replace the built-in ones. Without a user catalog
+// it returns the built-in one.
+func Load(fs FileReader, homeDir string) (*Catalog, error) {
+	c := Builtin()
+	path := UserPath(homeDir)
+	content, err := fs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	user, err := Parse(content)
+	if err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c.Merge(user), nil
+}
@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+)
+
+func TestBuiltin(t *testing.T) {
+	c := Builtin()
+
+	entry, ok := c.Lookup("com.apple.dock", "mru-spaces")
+	if !ok || entry.Type != "boolean" || entry.Description == "" {
+		t.Errorf("Expected the boolean mru-spaces entry, got %+v", entry)
+	}
+	entry, ok = c.Lookup("-g", "AppleKeyboardUIMode")
+	if !ok || entry.Domain != "NSGlobalDomain" || len(entry.Values) != 3 || entry.Values[1].Value != "2" {
+		t.Errorf("Expected the AppleKeyboardUIMode entry through the -g alias, got %+v", entry)
+	}
+	if entry, _ := c.Lookup("com.apple.dock", "wvous-br-corner"); len(entry.Values) == 0 {
+		t.Errorf("Expected the hot corner values to be shared, got %+v", entry)
+	}
+	if _, ok := c.Lookup("com.example.app", "unknown"); ok {
+		t.Error("Expected no entry for an unknown key")
+	}
+
+	// Every allowed value has to be one push can write as the type of its key.
+	for _, entry := range c.Entries() {
+		for _, value := range entry.Values {
+			if _, err := config.PlistValue(value.Value, entry.Type); err != nil {
+				t.Errorf("%s %s: value %q: %v", entry.Domain, entry.Key, value.Value, err)
+			}
+		}
+	}
+}
+
+func TestCatalog_Search(t *testing.T) {
+	c := Builtin()
+
+	matches := c.Search("DOCK hot corner")
+	if len(matches) != 4 {
+		t.Fatalf("Expected the 4 hot corners, got %+v", matches)
+	}
+	if matches[0].Key != "wvous-bl-corner" || matches[3].Key != "wvous-tr-corner" {
+		t.Errorf("Expected matches sorted by key, got %s and %s", matches[0].Key, matches[3].Key)
+	}
+	if matches := c.Search("no such setting"); len(matches) != 0 {
+		t.Errorf("Expected no matches, got %+v", matches)
+	}
+}
+
+func TestDescribe_NilCatalog(t *testing.T) {
+	var c *Catalog
+	if description := c.Describe("com.apple.dock", "autohide"); description != "" {
+		t.Errorf("Expected no description, got %q", description)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"missing description", "com.example.app:\n  Key:\n    type: boolean\n"},
+		{"unknown type", "com.example.app:\n  Key:\n    description: A key.\n    type: bool\n"},
+		{"not a map", "- com.example.app\n"},
+		{"unknown field", "com.example.app:\n  Key:\n    description: A key.\n    default: 1\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(tc.content); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+type mockReader map[string]string
+
+func (m mockReader) ReadFile(name string) (string, error) {
+	content, ok := m[name]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return content, nil
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	c, err := Load(mockReader{}, "/Users/me")
+	if err != nil {
+		t.Fatalf("Expected no error without a user catalog, got %v", err)
+	}
+	if _, ok := c.Lookup("com.apple.dock", "autohide"); !ok {
+		t.Error("Expected the built-in entries")
+	}
+
+	user := "com.example.app:\n  Theme:\n    description: Color theme of the app.\n    values:\n      - {value: dark, description: Dark}\ncom.apple.dock:\n  autohide:\n    description: Our own description.\n    type: boolean\n"
+	c, err = Load(mockReader{"/Users/me/.config/mdefaults/catalog.yaml": user}, "/Users/me")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if entry, ok := c.Lookup("com.example.app", "Theme"); !ok || entry.Type != "string" {
+		t.Errorf("Expected the string entry of the user catalog, got %+v", entry)
+	}
+	if description := c.Describe("com.apple.dock", "autohide"); description != "Our own description." {
+		t.Errorf("Expected the user entry to replace the built-in one, got %q", description)
+	}
+
+	if _, err := Load(mockReader{"/Users/me/.config/mdefaults/catalog.yaml": "com.example.app:\n  Theme: {}\n"}, "/Users/me"); err == nil {
+		t.Error("Expected an error for an invalid user catalog")
+	}
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+// NormalizeSystemValue converts the output of `defaults read` into the form
+// stored in the configuration file. The trailing newline is removed, data is
+// converted to hexadecimal digits, and arrays and dicts, which defaults prints
+// over several lines, are rendered as compact property lists. The parsed tree
+// is returned for arrays and dicts.
+func NormalizeSystemValue(value, valueType string) (string, *plist.Value) {
+	value = strings.TrimSuffix(value, "\n")
+	if valueType == "data" {
+		// defaults read prints data as <0a0b> or {length = 2, bytes = 0x0a0b},
+		// while defaults write -data expects plain hexadecimal digits.
+		if tree, err := plist.ParseText(value); err == nil && tree.Type == "data" {
+			return tree.Scalar, nil
+		}
+		return value, nil
+	}
+	if !IsStructuredType(valueType) {
+		return value, nil
+	}
+	tree, err := plist.ParseText(value)
+	if err != nil {
+		return strings.ReplaceAll(value, "\n", ""), nil
+	}
+	return plist.FormatText(tree), tree
+}
+
+// isKnownType reports whether valueType is one of the types of the
+// configuration file.
+func isKnownType(valueType string) bool {
+	switch valueType {
+	case "string", "boolean", "integer", "float", "date", "data", "array", "dict", "array-add", "dict-add":
+		return true
+	}
+	return false
+}
+
+// BaseType returns the type a value of valueType has once it is written, e.g.
+// "array" for "array-add" and "string" for an empty type.
+func BaseType(valueType string) string {
+	switch valueType {
+	case "":
+		return "string"
+	case "array-add":
+		return "array"
+	case "dict-add":
+		return "dict"
+	}
+	return valueType
+}
+
+// ValuesEqual reports whether the configured value want matches the value got
+// read from the system, both interpreted as valueType. Booleans, numbers,
+// dates and property lists are compared by meaning rather than by text, so
+// that "true" matches the "1" printed by defaults read. For array-add and
+// dict-add, got only has to contain the elements of want.
+func ValuesEqual(valueType, want, got string) bool {
+	switch valueType {
+	case "boolean":
+		w, okW := parseBool(want)
+		g, okG := parseBool(got)
+		if okW && okG {
+			return w == g
+		}
+	case "integer":
+		w, errW := strconv.ParseInt(strings.TrimSpace(want), 10, 64)
+		g, errG := strconv.ParseInt(strings.TrimSpace(got), 10, 64)
+		if errW == nil && errG == nil {
+			return w == g
+		}
+	case "float":
+		w, errW := strconv.ParseFloat(strings.TrimSpace(want), 64)
+		g, errG := strconv.ParseFloat(strings.TrimSpace(got), 64)
+		if errW == nil && errG == nil {
+			return w == g
+		}
+	case "date":
+		w, okW := parseDate(want)
+		g, okG := parseDate(got)
+		if okW && okG {
+			return w.Equal(g)
+		}
+	case "array", "dict", "array-add", "dict-add":
+		w, errW := plist.ParseText(want)
+		g, errG := plist.ParseText(got)
+		if errW == nil && errG == nil {
+			if strings.HasSuffix(valueType, "-add") {
+				return plist.Contains(g, w)
+			}
+			return plist.Equal(w, g)
+		}
+	}
+	return want == got
+}
+
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes":
+		return true, true
+	case "0", "false", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// dateLayouts are the date formats accepted in the configuration file. The
+// first one is how `defaults read` prints dates.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// PlistValue converts a configured value of valueType into the property list
+// value `defaults write` would store for it. Booleans become 1 or 0 and dates
+// are stored in plist.DateLayout. Array and dict elements stay strings, as
+// with `defaults write -array`; array-add and dict-add return the elements to
+// add.
+func PlistValue(value, valueType string) (*plist.Value, error) {
+	switch valueType {
+	case "", "string":
+		return plist.NewString(value), nil
+	case "boolean":
+		b, ok := parseBool(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid boolean %q", value)
+		}
+		if b {
+			return &plist.Value{Type: "boolean", Scalar: "1"}, nil
+		}
+		return &plist.Value{Type: "boolean", Scalar: "0"}, nil
+	case "integer":
+		if _, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		return &plist.Value{Type: "integer", Scalar: strings.TrimSpace(value)}, nil
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", value)
+		}
+		return &plist.Value{Type: "float", Scalar: strconv.FormatFloat(f, 'f', -1, 64)}, nil
+	case "date":
+		t, ok := parseDate(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid date %q", value)
+		}
+		return &plist.Value{Type: "date", Scalar: t.UTC().Format(plist.DateLayout)}, nil
+	case "data":
+		digits := strings.ToLower(strings.TrimSpace(value))
+		if _, err := hex.DecodeString(digits); err != nil {
+			return nil, fmt.Errorf("invalid data %q", value)
+		}
+		return &plist.Value{Type: "data", Scalar: digits}, nil
+	case "array", "dict", "array-add", "dict-add":
+		tree, err := plist.ParseText(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %w", valueType, err)
+		}
+		if tree.Type != BaseType(valueType) {
+			return nil, fmt.Errorf("expected a %s, got %s", BaseType(valueType), tree.Type)
+		}
+		return tree, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", valueType)
+}
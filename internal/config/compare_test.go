@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestValuesEqual(t *testing.T) {
+	testCases := []struct {
+		name      string
+		valueType string
+		want      string
+		got       string
+		expected  bool
+	}{
+		{"boolean true and 1", "boolean", "true", "1", true},
+		{"boolean YES and 1", "boolean", "YES", "1", true},
+		{"boolean false and 0", "boolean", "false", "0", true},
+		{"boolean differs", "boolean", "true", "0", false},
+		{"integer with leading zero", "integer", "048", "48", true},
+		{"integer differs", "integer", "48", "64", false},
+		{"float", "float", "1.50", "1.5", true},
+		{"float differs", "float", "1.5", "1.25", false},
+		{"date in different zones", "date", "2024-01-01T09:00:00+09:00", "2024-01-01 00:00:00 +0000", true},
+		{"date differs", "date", "2024-01-02", "2024-01-01 00:00:00 +0000", false},
+		{"array", "array", `("a", b)`, "(a, b)", true},
+		{"array differs", "array", "(a, b)", "(b, a)", false},
+		{"dict in different order", "dict", "{a = 1; b = 2;}", "{b = 2; a = 1;}", true},
+		{"array-add contained", "array-add", "(b)", "(a, b, c)", true},
+		{"array-add missing", "array-add", "(d)", "(a, b, c)", false},
+		{"dict-add contained", "dict-add", "{b = 2;}", "{a = 1; b = 2;}", true},
+		{"string", "string", "hello", "hello", true},
+		{"string is compared by text", "string", "1", "true", false},
+		{"unparsable integer falls back to text", "integer", "abc", "abc", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ValuesEqual(tc.valueType, tc.want, tc.got); got != tc.expected {
+				t.Errorf("ValuesEqual(%s, %q, %q) = %v, expected %v", tc.valueType, tc.want, tc.got, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBaseType(t *testing.T) {
+	testCases := map[string]string{
+		"":          "string",
+		"string":    "string",
+		"integer":   "integer",
+		"array-add": "array",
+		"dict-add":  "dict",
+	}
+
+	for valueType, expected := range testCases {
+		if got := BaseType(valueType); got != expected {
+			t.Errorf("BaseType(%q) = %s, expected %s", valueType, got, expected)
+		}
+	}
+}
+
+func TestNormalizeSystemValue(t *testing.T) {
+	value, tree := NormalizeSystemValue("(\n    a,\n    \"b c\"\n)\n", "array")
+	if value != `(a, "b c")` {
+		t.Errorf("Expected compact array, got %s", value)
+	}
+	if tree == nil || len(tree.Array) != 2 {
+		t.Errorf("Expected parsed array with 2 elements, got %+v", tree)
+	}
+
+	value, _ = NormalizeSystemValue("{length = 2, bytes = 0x0a0b}\n", "data")
+	if value != "0a0b" {
+		t.Errorf("Expected hexadecimal data, got %q", value)
+	}
+
+	value, tree = NormalizeSystemValue("multi\nline\n", "string")
+	if value != "multi\nline" || tree != nil {
+		t.Errorf("Expected only the trailing newline to be removed, got %q", value)
+	}
+}
+
+func TestPlistValue(t *testing.T) {
+	testCases := []struct {
+		value     string
+		valueType string
+		expected  string
+	}{
+		{"dark", "", "string dark"},
+		{"yes", "boolean", "boolean 1"},
+		{"false", "boolean", "boolean 0"},
+		{" 48 ", "integer", "integer 48"},
+		{"0.50", "float", "float 0.5"},
+		{"2024-01-02T04:04:05+01:00", "date", "date 2024-01-02 03:04:05 +0000"},
+		{"0A0B", "data", "data 0a0b"},
+	}
+
+	for _, tc := range testCases {
+		v, err := PlistValue(tc.value, tc.valueType)
+		if err != nil {
+			t.Fatalf("PlistValue(%q, %q) returned error: %v", tc.value, tc.valueType, err)
+		}
+		if got := v.Type + " " + v.Scalar; got != tc.expected {
+			t.Errorf("PlistValue(%q, %q) = %s, expected %s", tc.value, tc.valueType, got, tc.expected)
+		}
+	}
+
+	v, err := PlistValue(`(a, "b c")`, "array-add")
+	if err != nil || v.Type != "array" || len(v.Array) != 2 {
+		t.Errorf("Expected an array of 2 elements, got %+v (%v)", v, err)
+	}
+}
+
+func TestPlistValue_Errors(t *testing.T) {
+	testCases := [][2]string{
+		{"maybe", "boolean"},
+		{"1.5", "integer"},
+		{"half", "float"},
+		{"yesterday", "date"},
+		{"xyz", "data"},
+		{"(a, b)", "dict"},
+		{"1", "color"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := PlistValue(tc[0], tc[1]); err == nil {
+			t.Errorf("Expected an error for %q as %s", tc[0], tc[1])
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package config
 
 import (
-	"fmt"
+	"errors"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/fumiya-kume/mdefaults/internal/plist"
 )
 
 // Config represents a configuration entry with domain, key, value, and type.
@@ -14,10 +15,43 @@ type Config struct {
 	Key    string
 	Value  *string
 	Type   string
+	// Structured is the parsed form of array and dict values. It is nil for
+	// other types and for values that are not valid property lists.
+	Structured *plist.Value
+	// Absent means the key must not exist; push deletes it. Absent entries
+	// are written as "!domain key" and have no value or type.
+	Absent bool
+	// Comment is the comment attached to the entry, without the # sign.
+	Comment string
+	// Profile is the profile the entry belongs to, or empty for the shared
+	// base that applies to every profile.
+	Profile string
+	// Source is the path of the file the entry was read from, which may be
+	// a file included by the configuration file.
+	Source string
+	// SourceProfile is the profile of the entry within its Source file. It
+	// differs from Profile for the entries of a file included in a profile
+	// section, which belong to that profile but are written without one.
+	SourceProfile string
+	// Line is the line of the entry in the file it was read from, or 0 for
+	// entries that were not read from a file.
+	Line int
+	// Host selects the ByHost preferences the entry configures: empty for
+	// the preferences shared by every host, CurrentHost for those of this
+	// Mac, or the name of another host.
+	Host string
+	// System means the entry configures the system-wide preferences in
+	// /Library/Preferences, which push writes with root privileges.
+	System bool
 }
 
-// ConfigFilePath is the default path for the configuration file.
-var ConfigFilePath = filepath.Join(os.Getenv("HOME"), ".mdefaults")
+// ConfigFileName is the name of the configuration file in the home directory.
+const ConfigFileName = ".mdefaults"
+
+// DefaultConfigFilePath returns the path of the configuration file in homeDir.
+func DefaultConfigFilePath(homeDir string) string {
+	return filepath.Join(homeDir, ConfigFileName)
+}
 
 // FileSystemReader is a minimal interface for file system operations needed by config package
 type FileSystemReader interface {
@@ -25,57 +59,143 @@ type FileSystemReader interface {
 	WriteFile(name string, content string) error
 }
 
-// ReadConfigFile reads the configuration file and returns a slice of Config.
-func ReadConfigFile(fs FileSystemReader) ([]Config, error) {
-	content, err := fs.ReadFile(ConfigFilePath)
+// ReadConfigFile reads the configuration file at path and returns a slice of Config.
+// Each line has the form `domain key [value [type]] [# comment]`; fields may be
+// quoted as described in splitFields. Lines that cannot be parsed are logged
+// and skipped. Included files are read as described in LoadTree.
+func ReadConfigFile(fs FileSystemReader, path string) ([]Config, error) {
+	tree, err := LoadTree(fs, path)
 	if err != nil {
 		return nil, err
 	}
-	configs := []Config{}
-	for _, line := range strings.Split(content, "\n") {
-		if line != "" {
-			parts := strings.Split(line, " ")
-			if len(parts) < 2 {
-				continue
-			}
-			value := ""
-			valueType := "string"
-			if len(parts) >= 3 {
-				value = parts[2]
-			}
-			if len(parts) >= 4 {
-				valueType = parts[3]
-			}
-			configs = append(configs, Config{
-				Domain: parts[0],
-				Key:    parts[1],
-				Value:  &value,
-				Type:   valueType,
-			})
+	return tree.Configs(), nil
+}
+
+var errMissingKey = errors.New("missing key")
+
+// errAbsentValue is returned for absent entries that also give a value.
+var errAbsentValue = errors.New("absent entries take no value or type")
+
+// parseLine splits a configuration line into its fields and returns the offset
+// of its trailing comment. Files written before values were quoted separated
+// the fields with single spaces and stored them verbatim, so an empty value
+// was two consecutive spaces (`domain key  type`), and values such as Bob's or
+// #fff held bare quotes and hashes. Such lines are still read the old way when
+// they cannot be tokenized, or when tokenizing would drop their value.
+func parseLine(line string) ([]string, int, error) {
+	if parts, ok := legacyValueFields(line); ok {
+		return parts, len(line), nil
+	}
+	fields, commentAt, err := splitFields(line)
+	if err != nil {
+		if parts, ok := legacyFields(line); ok {
+			return parts, len(line), nil
 		}
+		return nil, 0, err
+	}
+	return fields, commentAt, nil
+}
+
+// legacyValueFields returns the fields of an old `domain key value type` line
+// whose value tokenizing would drop or change: an empty value, one starting
+// with # followed by a known type, as in `com.example.app color #fff string`,
+// or backslashes followed by a known type, as in
+// `com.example.app path C:\dir string`.
+func legacyValueFields(line string) ([]string, bool) {
+	if strings.ContainsAny(line, "'\"") {
+		return nil, false
+	}
+	parts, ok := legacyFields(line)
+	if !ok || len(parts) != 4 {
+		return nil, false
+	}
+	switch {
+	case strings.Contains(line, "\\"):
+		return parts, isKnownType(parts[3])
+	case parts[2] == "" && !strings.Contains(line, "#"):
+		return parts, true
+	case strings.HasPrefix(parts[2], "#") && isKnownType(parts[3]):
+		return parts, true
+	}
+	return nil, false
+}
+
+// legacyFields splits line the way files were read before values were quoted:
+// `domain key [value [type]]`, separated by single spaces.
+func legacyFields(line string) ([]string, bool) {
+	if strings.ContainsAny(line, "\t\r") {
+		return nil, false
+	}
+	parts := strings.Split(line, " ")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] == "" || parts[1] == "" || (len(parts) == 4 && parts[3] == "") {
+		return nil, false
 	}
-	return configs, nil
+	return parts, true
+}
+
+// IsStructuredType reports whether values of valueType are written as
+// old-style property lists, such as ("a", "b") or {key = value;}.
+func IsStructuredType(valueType string) bool {
+	switch valueType {
+	case "array", "array-add", "dict", "dict-add":
+		return true
+	}
+	return false
+}
+
+// ParseStructured parses the value of an array or dict entry. It returns nil
+// for other types and for values that are not valid property lists.
+func ParseStructured(value, valueType string) *plist.Value {
+	if !IsStructuredType(valueType) {
+		return nil
+	}
+	v, err := plist.ParseText(value)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// FormatLine renders a configuration entry as a single line, quoting fields
+// so that it is read back unchanged.
+func FormatLine(domain, key, value, valueType string) string {
+	return strings.Join([]string{quoteDomain(domain), quoteField(key), quoteField(value), quoteField(valueType)}, " ")
+}
+
+// FormatAbsentLine renders an entry whose key must not exist.
+func FormatAbsentLine(domain, key string) string {
+	return string(absentMarker) + quoteDomain(domain) + " " + quoteField(key)
+}
+
+// FormatConfig renders cfg as a line of the configuration file, starting with
+// the option selecting its scope, if any. Entries without a value are rendered
+// with an empty one.
+func FormatConfig(cfg Config) string {
+	if cfg.Absent {
+		return FormatScope(cfg) + FormatAbsentLine(cfg.Domain, cfg.Key)
+	}
+	value := ""
+	if cfg.Value != nil {
+		value = *cfg.Value
+	}
+	return FormatScope(cfg) + FormatLine(cfg.Domain, cfg.Key, value, configType(cfg))
 }
 
 // GenerateConfigFileContent generates the content for the configuration file from a slice of Config.
 func GenerateConfigFileContent(configs []Config) string {
 	content := ""
 	for _, config := range configs {
-		if config.Value == nil {
+		if config.Value == nil && !config.Absent {
 			log.Printf("Skipping %s: Value is nil", config.Key)
 			continue
 		}
-		configType := config.Type
-		if configType == "" {
-			configType = "string"
-		}
-		content += fmt.Sprintf("%s %s %s %s\n", config.Domain, config.Key, *config.Value, configType)
+		content += FormatConfig(config) + "\n"
 	}
 	return content
 }
 
-// WriteConfigFile writes the configs to the configuration file.
-func WriteConfigFile(fs FileSystemReader, configs []Config) error {
+// WriteConfigFile writes the configs to the configuration file at path.
+func WriteConfigFile(fs FileSystemReader, path string, configs []Config) error {
 	content := GenerateConfigFileContent(configs)
-	return fs.WriteFile(ConfigFilePath, content)
+	return fs.WriteFile(path, content)
 }
@@ -6,10 +6,12 @@ import (
 	"testing"
 )
 
+var testConfigFilePath = DefaultConfigFilePath("/mock/home")
+
 func TestReadConfigFile_Success(t *testing.T) {
 	fs := &MockFileSystem{HomeDir: "/mock/home", StatError: nil, CreateErr: nil, ConfigFileContent: "com.apple.dock autohide 1\ncom.apple.finder ShowPathbar true\n"}
 
-	configs, err := ReadConfigFile(fs)
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -44,7 +46,7 @@ func TestReadConfigFile_Success(t *testing.T) {
 func TestReadConfigFile_Error(t *testing.T) {
 	fs := &MockFileSystem{StatError: errors.New("read error")}
 
-	_, err := ReadConfigFile(fs)
+	_, err := ReadConfigFile(fs, testConfigFilePath)
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -95,7 +97,7 @@ func TestWriteConfigFile_Success(t *testing.T) {
 		{Domain: "com.apple.finder", Key: "ShowPathbar", Value: &value2},
 	}
 
-	err := WriteConfigFile(mockFS, configs)
+	err := WriteConfigFile(mockFS, testConfigFilePath, configs)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -117,7 +119,7 @@ func TestWriteConfigFile_Error(t *testing.T) {
 		{Domain: "com.apple.dock", Key: "autohide", Value: &value1},
 	}
 
-	err := WriteConfigFile(mockFS, configs)
+	err := WriteConfigFile(mockFS, testConfigFilePath, configs)
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -140,7 +142,7 @@ com.example.app longValue 123456789012345678901234567890123456789012345678901234
 `
 	fs := &MockFileSystem{HomeDir: "/mock/home", ConfigFileContent: configContent}
 
-	configs, err := ReadConfigFile(fs)
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -204,10 +206,171 @@ func TestGenerateConfigFileContent_VariousInputTypes(t *testing.T) {
 		{Domain: "com.example.app", Key: "longValue", Value: &value6},
 	}
 
-	expectedContent := "com.example.app floatValue 3.14 string\ncom.example.app negativeValue -42 string\ncom.example.app zeroValue 0 string\ncom.example.app specialChars !@#$%^&*() string\ncom.example.app emptyValue  string\ncom.example.app longValue 1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890 string\n"
+	expectedContent := "com.example.app floatValue 3.14 string\ncom.example.app negativeValue -42 string\ncom.example.app zeroValue 0 string\ncom.example.app specialChars !@#$%^&*() string\ncom.example.app emptyValue \"\" string\ncom.example.app longValue 1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890 string\n"
 	content := GenerateConfigFileContent(configs)
 
 	if content != expectedContent {
 		t.Errorf("Expected content %q, got %q", expectedContent, content)
 	}
 }
+
+func TestReadConfigFile_QuotedValues(t *testing.T) {
+	configContent := `com.apple.screencapture location '/Users/me/Library/Application Support/Shots' string
+com.apple.screencapture name "My \"Screen\" Shot" string
+com.example.app emptyValue "" string
+com.example.app multiLine "line1\nline2" string
+com.example.app escapedSpace a\ b string
+`
+	fs := &MockFileSystem{ConfigFileContent: configContent}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expectedValues := []string{
+		"/Users/me/Library/Application Support/Shots",
+		`My "Screen" Shot`,
+		"",
+		"line1\nline2",
+		"a b",
+	}
+	if len(configs) != len(expectedValues) {
+		t.Fatalf("Expected %d configs, got %d", len(expectedValues), len(configs))
+	}
+	for i, expected := range expectedValues {
+		if *configs[i].Value != expected {
+			t.Errorf("Expected value %q, got %q", expected, *configs[i].Value)
+		}
+		if configs[i].Type != "string" {
+			t.Errorf("Expected type string, got %s", configs[i].Type)
+		}
+	}
+}
+
+func TestReadConfigFile_LegacyEmptyValue(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "com.example.app emptyValue  integer\n"}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("Expected 1 config, got %d", len(configs))
+	}
+	if *configs[0].Value != "" || configs[0].Type != "integer" {
+		t.Errorf("Expected empty integer value, got %q %s", *configs[0].Value, configs[0].Type)
+	}
+}
+
+func TestReadConfigFile_LegacyQuotes(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "com.example.app owner Bob's\ncom.example.app size 5\" string\ncom.example.app dir C:\\Users\\\n"}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"Bob's", `5"`, `C:\Users\`}
+	if len(configs) != len(expected) {
+		t.Fatalf("Expected %d configs, got %+v", len(expected), configs)
+	}
+	for i, value := range expected {
+		if *configs[i].Value != value || configs[i].Type != "string" {
+			t.Errorf("Expected %q to be read verbatim, got %q %s", value, *configs[i].Value, configs[i].Type)
+		}
+	}
+}
+
+func TestReadConfigFile_LegacyHashValue(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "com.example.app color #fff string\ncom.example.app theme dark # not a type\n"}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 configs, got %+v", configs)
+	}
+	if *configs[0].Value != "#fff" || configs[0].Type != "string" {
+		t.Errorf("Expected the value #fff, got %q %s", *configs[0].Value, configs[0].Type)
+	}
+	if *configs[1].Value != "dark" || configs[1].Comment == "" {
+		t.Errorf("Expected dark followed by a comment, got %q %q", *configs[1].Value, configs[1].Comment)
+	}
+}
+
+func TestReadConfigFile_LegacyBackslashValue(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "com.example.app path C:\\dir string\ncom.example.app name a\\ b\n"}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 configs, got %+v", configs)
+	}
+	if *configs[0].Value != `C:\dir` || configs[0].Type != "string" {
+		t.Errorf("Expected the value C:\\dir, got %q %s", *configs[0].Value, configs[0].Type)
+	}
+	if *configs[1].Value != "a b" {
+		t.Errorf("Expected an escaped space to be read as one, got %q", *configs[1].Value)
+	}
+}
+
+func TestReadConfigFile_SkipsUnterminatedQuote(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "com.example.app broken 'the value string\ncom.apple.dock autohide 1 boolean\n"}
+
+	configs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(configs) != 1 || configs[0].Key != "autohide" {
+		t.Errorf("Expected only the valid line to be read, got %+v", configs)
+	}
+}
+
+func TestGenerateConfigFileContent_RoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"plain",
+		"Application Support",
+		"it's",
+		`say "hi"`,
+		`C:\path\to`,
+		"tab\there",
+		"new\nline",
+		"(\n    \"com.apple.Safari\",\n    foo\n)",
+		"{    \"tile-type\" = \"file-tile\";}",
+		"日本語 テキスト",
+		"\x00\x1b\x7f",
+		"\xff\xfe invalid utf-8",
+		"#not-a-comment",
+	}
+
+	configs := make([]Config, 0, len(values))
+	for i := range values {
+		configs = append(configs, Config{Domain: "com.example app", Key: "key " + values[i], Value: &values[i], Type: "string"})
+	}
+
+	fs := &MockFileSystem{ConfigFileContent: GenerateConfigFileContent(configs)}
+	readConfigs, err := ReadConfigFile(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(readConfigs) != len(configs) {
+		t.Fatalf("Expected %d configs, got %d", len(configs), len(readConfigs))
+	}
+	for i := range configs {
+		if readConfigs[i].Domain != configs[i].Domain || readConfigs[i].Key != configs[i].Key || *readConfigs[i].Value != *configs[i].Value {
+			t.Errorf("Round trip mismatch: expected %q %q %q, got %q %q %q",
+				configs[i].Domain, configs[i].Key, *configs[i].Value,
+				readConfigs[i].Domain, readConfigs[i].Key, *readConfigs[i].Value)
+		}
+	}
+}
+
+func TestDefaultConfigFilePath(t *testing.T) {
+	if path := DefaultConfigFilePath("/Users/me"); path != "/Users/me/.mdefaults" {
+		t.Errorf("Expected /Users/me/.mdefaults, got %s", path)
+	}
+}
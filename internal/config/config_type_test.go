@@ -9,7 +9,7 @@ func TestReadConfigFileWithTypes(t *testing.T) {
 		ConfigFileContent: "com.apple.dock autohide 1 boolean\ncom.apple.finder ShowPathbar true boolean\ncom.apple.trackpad ClickThreshold 2 integer",
 	}
 
-	configs, err := ReadConfigFile(mockFS)
+	configs, err := ReadConfigFile(mockFS, testConfigFilePath)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -42,7 +42,7 @@ func TestReadConfigFileBackwardCompatibility(t *testing.T) {
 		ConfigFileContent: "com.apple.dock autohide 1\ncom.apple.finder ShowPathbar true",
 	}
 
-	configs, err := ReadConfigFile(mockFS)
+	configs, err := ReadConfigFile(mockFS, testConfigFilePath)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -98,6 +98,41 @@ func TestGenerateConfigFileContentWithEmptyType(t *testing.T) {
 	}
 }
 
+func TestReadConfigFileWithStructuredTypes(t *testing.T) {
+	mockFS := &MockFileSystem{
+		ConfigFileContent: `com.apple.dock persistent-apps '({tile-data = {file-label = Safari;}; tile-type = file-tile;})' array
+com.apple.finder FXInfoPanesExpanded '{General = 1; Preview = 0;}' dict
+com.example.app broken '(a, b' array
+com.apple.dock autohide 1 boolean
+`,
+	}
+
+	configs, err := ReadConfigFile(mockFS, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(configs) != 4 {
+		t.Fatalf("Expected 4 configs, got %d", len(configs))
+	}
+
+	apps := configs[0].Structured
+	if apps == nil || apps.Type != "array" || len(apps.Array) != 1 {
+		t.Fatalf("Expected an array with one element, got %+v", apps)
+	}
+	if label := apps.Array[0].Get("tile-data").Get("file-label"); label == nil || label.Scalar != "Safari" {
+		t.Errorf("Expected nested file-label Safari, got %+v", label)
+	}
+	if panes := configs[1].Structured; panes == nil || panes.Type != "dict" || len(panes.Dict) != 2 {
+		t.Errorf("Expected a dict with two entries, got %+v", panes)
+	}
+	if configs[2].Structured != nil {
+		t.Errorf("Expected malformed array to have no structured value, got %+v", configs[2].Structured)
+	}
+	if configs[3].Structured != nil {
+		t.Errorf("Expected scalar to have no structured value, got %+v", configs[3].Structured)
+	}
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
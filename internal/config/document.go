@@ -0,0 +1,520 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// LineKind describes what a line of the configuration file contains.
+type LineKind int
+
+const (
+	// BlankLine is an empty or whitespace-only line.
+	BlankLine LineKind = iota
+	// CommentLine is a line that only holds a # comment.
+	CommentLine
+	// EntryLine is a line describing a configuration entry.
+	EntryLine
+	// InvalidLine is a line that could not be parsed. It is kept verbatim.
+	InvalidLine
+	// SectionLine is a "[profile name]" or "[base]" line that starts the
+	// entries of a profile or of the shared base.
+	SectionLine
+	// IncludeLine is an "include path" line that reads the entries of other
+	// files.
+	IncludeLine
+	// RestartLine is a "restart domain [process...]" line that sets the
+	// processes push restarts after changing the domain.
+	RestartLine
+)
+
+// Line is a single line of the configuration file.
+type Line struct {
+	Kind LineKind
+	// Raw is the text of the line without its line break.
+	Raw string
+	// Config holds the parsed entry of an EntryLine.
+	Config Config
+	// Comment is the trailing comment of an EntryLine, including the
+	// whitespace in front of the # sign.
+	Comment string
+	// Err describes why an InvalidLine could not be parsed.
+	Err error
+	// Section is the profile a SectionLine starts, empty for [base].
+	Section string
+	// Include is the path, glob or directory of an IncludeLine.
+	Include string
+	// Restart is the directive of a RestartLine.
+	Restart Restart
+}
+
+// LineDocument is a lossless representation of a configuration file in the
+// line format. Comments, blank lines and the order of entries survive a
+// ParseLineDocument/String round trip. "include path" lines read the entries of
+// other files, see LoadTree, and "restart domain [process...]" lines set the
+// processes push restarts after changing a domain. Entries of ByHost
+// preferences start with -currentHost or "-host name", and entries of the
+// system-wide preferences with -system, see currentHostOption. Entries
+// belong to the shared base until a "[profile name]" line, and to that profile
+// until the next section line:
+//
+//	com.apple.dock autohide 0 boolean
+//
+//	[profile presentation]
+//	com.apple.dock autohide 1 boolean
+//
+//	[base]
+//	com.apple.finder ShowPathbar 1 boolean
+type LineDocument struct {
+	Lines []Line
+}
+
+// ParseLineDocument parses the content of a configuration file in the line
+// format.
+func ParseLineDocument(content string) *LineDocument {
+	rawLines := strings.Split(content, "\n")
+	doc := &LineDocument{Lines: make([]Line, 0, len(rawLines))}
+	profile := ""
+	for _, raw := range rawLines {
+		line := parseDocumentLine(raw)
+		switch line.Kind {
+		case SectionLine:
+			profile = line.Section
+		case EntryLine:
+			line.Config.Profile = profile
+		}
+		doc.Lines = append(doc.Lines, line)
+	}
+	return doc
+}
+
+var errInvalidSection = errors.New("expected [profile <name>] or [base]")
+
+// parseSectionLine parses "[profile name]" and "[base]", which may be
+// followed by a comment.
+func parseSectionLine(raw string) Line {
+	text := strings.TrimSpace(raw)
+	end := strings.IndexByte(text, ']')
+	if end < 0 {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errInvalidSection}
+	}
+	if rest := strings.TrimSpace(text[end+1:]); rest != "" && rest[0] != '#' {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errInvalidSection}
+	}
+	fields := strings.Fields(text[1:end])
+	switch {
+	case len(fields) == 1 && fields[0] == "base":
+		return Line{Kind: SectionLine, Raw: raw}
+	case len(fields) == 2 && fields[0] == "profile":
+		return Line{Kind: SectionLine, Raw: raw, Section: fields[1]}
+	}
+	return Line{Kind: InvalidLine, Raw: raw, Err: errInvalidSection}
+}
+
+var errIncludePath = errors.New("include takes a single path")
+
+var errRestartDomain = errors.New("restart takes a domain and the processes to restart")
+
+// isDirectiveLine reports whether raw starts with the unquoted keyword.
+func isDirectiveLine(raw, keyword string) bool {
+	fields := strings.Fields(raw)
+	return len(fields) > 0 && fields[0] == keyword
+}
+
+// FormatSectionLine renders the line that starts the entries of profile.
+func FormatSectionLine(profile string) string {
+	if profile == "" {
+		return "[base]"
+	}
+	return "[profile " + profile + "]"
+}
+
+func parseDocumentLine(raw string) Line {
+	if strings.TrimSpace(raw) == "" {
+		return Line{Kind: BlankLine, Raw: raw}
+	}
+	if strings.TrimLeft(raw, " \t")[0] == '[' {
+		return parseSectionLine(raw)
+	}
+	parts, commentAt, err := parseLine(raw)
+	if err != nil {
+		return Line{Kind: InvalidLine, Raw: raw, Err: err}
+	}
+	if len(parts) == 0 {
+		return Line{Kind: CommentLine, Raw: raw}
+	}
+	if isDirectiveLine(raw, includeKeyword) {
+		if len(parts) != 2 {
+			return Line{Kind: InvalidLine, Raw: raw, Err: errIncludePath}
+		}
+		return Line{Kind: IncludeLine, Raw: raw, Include: parts[1]}
+	}
+	if isDirectiveLine(raw, restartKeyword) {
+		if len(parts) < 2 {
+			return Line{Kind: InvalidLine, Raw: raw, Err: errRestartDomain}
+		}
+		return Line{Kind: RestartLine, Raw: raw, Restart: Restart{Domain: parts[1], Processes: parts[2:]}}
+	}
+	host, system, parts, quoted, err := cutScope(parts, quotedFields(raw))
+	if err != nil {
+		return Line{Kind: InvalidLine, Raw: raw, Err: err}
+	}
+	// The absent marker follows the scope option, if any: "-currentHost !domain key".
+	scoped := host != "" || system
+	if strings.TrimLeft(raw, " \t")[0] == absentMarker || (scoped && isBare(quoted, 0) && strings.HasPrefix(parts[0], string(absentMarker))) {
+		line := parseAbsentLine(raw, parts, quoted, commentAt)
+		line.Config.Host, line.Config.System = host, system
+		if err := validateScope(line.Config); line.Kind == EntryLine && err != nil {
+			return Line{Kind: InvalidLine, Raw: raw, Err: err}
+		}
+		return line
+	}
+	if parts, err = joinApp(parts, quoted); err != nil {
+		return Line{Kind: InvalidLine, Raw: raw, Err: err}
+	}
+	if len(parts) < 2 {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errMissingKey}
+	}
+	value := ""
+	valueType := "string"
+	if len(parts) >= 3 {
+		value = parts[2]
+	}
+	if len(parts) >= 4 {
+		valueType = parts[3]
+	}
+	if err := validateScope(Config{Domain: parts[0], System: system}); err != nil {
+		return Line{Kind: InvalidLine, Raw: raw, Err: err}
+	}
+	return Line{
+		Kind: EntryLine,
+		Raw:  raw,
+		Config: Config{
+			Domain:     parts[0],
+			Key:        parts[1],
+			Value:      &value,
+			Type:       valueType,
+			Structured: ParseStructured(value, valueType),
+			Comment:    commentText(raw[commentAt:]),
+			Host:       host,
+			System:     system,
+		},
+		Comment: trailingText(raw, commentAt),
+	}
+}
+
+// parseAbsentLine parses "!domain key". The marker is only recognized when it
+// is not quoted, so parts[0] starts with it; "! domain key" is accepted too.
+func parseAbsentLine(raw string, parts []string, quoted []bool, commentAt int) Line {
+	if parts[0] == string(absentMarker) && isBare(quoted, 0) {
+		parts = parts[1:]
+		if len(quoted) > 0 {
+			quoted = quoted[1:]
+		}
+	} else {
+		parts[0] = parts[0][1:]
+	}
+	if len(parts) == 0 {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errMissingKey}
+	}
+	parts, err := joinApp(parts, quoted)
+	if err != nil {
+		return Line{Kind: InvalidLine, Raw: raw, Err: err}
+	}
+	if len(parts) < 2 {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errMissingKey}
+	}
+	if len(parts) > 2 {
+		return Line{Kind: InvalidLine, Raw: raw, Err: errAbsentValue}
+	}
+	return Line{
+		Kind:    EntryLine,
+		Raw:     raw,
+		Config:  Config{Domain: parts[0], Key: parts[1], Absent: true, Comment: commentText(raw[commentAt:])},
+		Comment: trailingText(raw, commentAt),
+	}
+}
+
+// commentText returns the text of a trailing comment without the # sign and
+// without the marker added by Mark.
+func commentText(comment string) string {
+	comment = strings.TrimSpace(stripMarker(comment))
+	return strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+}
+
+// trailingText returns the part of an entry line that follows its fields: the
+// trailing comment, or the carriage return of a CRLF line without a comment.
+func trailingText(raw string, commentAt int) string {
+	if commentAt == len(raw) && strings.HasSuffix(raw, "\r") {
+		return "\r"
+	}
+	return raw[commentAt:]
+}
+
+// Configs returns the entries of the document in file order.
+func (d *LineDocument) Configs() []Config {
+	configs := []Config{}
+	for i, line := range d.Lines {
+		if line.Kind == EntryLine {
+			cfg := line.Config
+			cfg.Line = i + 1
+			configs = append(configs, cfg)
+		}
+	}
+	return configs
+}
+
+// markerPrefix starts the comment Mark adds to an entry.
+const markerPrefix = "# mdefaults: "
+
+// Update sets the value and type of every entry in configs. Lines whose value
+// and type are already up to date are left byte-for-byte untouched, and updated
+// lines keep their trailing comment but lose the marker added by Mark. Absent
+// entries are left alone. Entries that are not in the document yet are
+// appended at the end.
+func (d *LineDocument) Update(configs []Config) {
+	for _, cfg := range configs {
+		if cfg.Value == nil {
+			continue
+		}
+		found := false
+		for i := range d.Lines {
+			line := &d.Lines[i]
+			if line.Kind != EntryLine || !sameEntry(line.Config, cfg) {
+				continue
+			}
+			found = true
+			if line.Config.Absent {
+				// The file asks for the key to be removed; pull does not
+				// turn that into a value.
+				continue
+			}
+			line.setComment(stripMarker(line.Comment))
+			if *line.Config.Value == *cfg.Value && line.Config.Type == configType(cfg) {
+				continue
+			}
+			line.setConfig(cfg)
+		}
+		if !found {
+			d.appendEntry(cfg)
+		}
+	}
+}
+
+// AppendMissing appends the entries of configs whose domain and key are not in
+// the document yet, leaving existing entries untouched. It returns the
+// appended entries.
+func (d *LineDocument) AppendMissing(configs []Config) []Config {
+	var appended []Config
+	for _, cfg := range configs {
+		if (cfg.Value == nil && !cfg.Absent) || d.has(cfg) {
+			continue
+		}
+		d.appendEntry(cfg)
+		appended = append(appended, cfg)
+	}
+	return appended
+}
+
+func (d *LineDocument) has(cfg Config) bool {
+	for _, line := range d.Lines {
+		if line.Kind == EntryLine && sameEntry(line.Config, cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mark adds a "# mdefaults: note" comment to the entries for the profile,
+// domain and key of cfg, replacing an earlier marker. The entries keep their
+// value; the marker records why they could not be updated and is removed by
+// the next Update.
+func (d *LineDocument) Mark(cfg Config, note string) {
+	for i := range d.Lines {
+		line := &d.Lines[i]
+		if line.Kind != EntryLine || !sameEntry(line.Config, cfg) {
+			continue
+		}
+		comment := stripMarker(line.Comment)
+		cr := ""
+		if strings.HasSuffix(comment, "\r") {
+			comment, cr = strings.TrimSuffix(comment, "\r"), "\r"
+		}
+		line.setComment(comment + " " + markerPrefix + note + cr)
+	}
+}
+
+// stripMarker removes the marker added by Mark from a trailing comment.
+func stripMarker(comment string) string {
+	at := strings.Index(comment, markerPrefix)
+	if at < 0 {
+		return comment
+	}
+	cr := ""
+	if strings.HasSuffix(comment, "\r") {
+		cr = "\r"
+	}
+	return strings.TrimRight(comment[:at], " \t") + cr
+}
+
+// setComment replaces the trailing comment of an entry line, keeping the text
+// of its fields as written.
+func (l *Line) setComment(comment string) {
+	if comment == l.Comment {
+		return
+	}
+	l.Raw = l.Raw[:len(l.Raw)-len(l.Comment)] + comment
+	l.Comment = comment
+}
+
+func (d *LineDocument) appendEntry(cfg Config) {
+	line := Line{Kind: EntryLine}
+	if cfg.Comment != "" {
+		line.Comment = " # " + cfg.Comment
+	}
+	line.setConfig(cfg)
+	at, section := d.insertionPoint(cfg.Profile)
+	var lines []Line
+	if section {
+		if at > 0 && d.Lines[at-1].Kind != BlankLine {
+			lines = append(lines, Line{Kind: BlankLine})
+		}
+		lines = append(lines, Line{Kind: SectionLine, Raw: FormatSectionLine(cfg.Profile), Section: cfg.Profile})
+	}
+	lines = append(lines, line)
+	d.Lines = append(d.Lines[:at], append(lines, d.Lines[at:]...)...)
+}
+
+// insertionPoint returns the index at which a new entry of profile is
+// inserted: after the last entry of the profile, or at the start of its
+// section when it has none. When the profile has no section yet, the index is
+// the end of the file and section is true.
+func (d *LineDocument) insertionPoint(profile string) (at int, section bool) {
+	end := len(d.Lines)
+	// Keep the final line break, if any, at the end of the file.
+	if end > 0 && d.Lines[end-1].Kind == BlankLine && d.Lines[end-1].Raw == "" {
+		end--
+	}
+	lastEntry, header, firstSection := -1, -1, -1
+	current := ""
+	for i, line := range d.Lines {
+		switch line.Kind {
+		case SectionLine:
+			current = line.Section
+			if firstSection < 0 {
+				firstSection = i
+			}
+			if current == profile {
+				header = i
+			}
+		case EntryLine:
+			if current == profile {
+				lastEntry = i
+			}
+		}
+	}
+	switch {
+	case firstSection < 0 && profile == "":
+		return end, false
+	case lastEntry >= 0:
+		return lastEntry + 1, false
+	case header >= 0:
+		return header + 1, false
+	case profile != "":
+		return end, true
+	case firstSection >= 0:
+		// Put the first base entry in front of the profiles, before the blank
+		// lines that separate them.
+		at = firstSection
+		for at > 0 && d.Lines[at-1].Kind == BlankLine {
+			at--
+		}
+		return at, false
+	}
+	return end, false
+}
+
+func (l *Line) setConfig(cfg Config) {
+	l.Config = cfg
+	if !cfg.Absent {
+		value := *cfg.Value
+		l.Config.Value = &value
+		l.Config.Type = configType(cfg)
+	}
+	l.Raw = FormatConfig(l.Config) + l.Comment
+}
+
+// String renders the document back to the content of a configuration file.
+func (d *LineDocument) String() string {
+	raw := make([]string, len(d.Lines))
+	for i, line := range d.Lines {
+		raw[i] = line.Raw
+	}
+	return strings.Join(raw, "\n")
+}
+
+// Includes returns the include lines of the document.
+func (d *LineDocument) Includes() []Include {
+	var includes []Include
+	profile := ""
+	position := 0
+	for i, line := range d.Lines {
+		switch line.Kind {
+		case SectionLine:
+			profile = line.Section
+		case EntryLine:
+			position++
+		case IncludeLine:
+			includes = append(includes, Include{Pattern: line.Include, Line: i + 1, Profile: profile, Position: position})
+		}
+	}
+	return includes
+}
+
+// Restarts returns the restart lines of the document.
+func (d *LineDocument) Restarts() []Restart {
+	var restarts []Restart
+	for i, line := range d.Lines {
+		if line.Kind == RestartLine {
+			restart := line.Restart
+			restart.Line = i + 1
+			restarts = append(restarts, restart)
+		}
+	}
+	return restarts
+}
+
+// appendRestarts adds a restart line for each directive, before the final line
+// break.
+func (d *LineDocument) appendRestarts(restarts []Restart) {
+	at := len(d.Lines)
+	if at > 0 && d.Lines[at-1].Kind == BlankLine && d.Lines[at-1].Raw == "" {
+		at--
+	}
+	lines := make([]Line, 0, len(restarts))
+	for _, restart := range restarts {
+		fields := []string{restartKeyword, quoteField(restart.Domain)}
+		for _, process := range restart.Processes {
+			fields = append(fields, quoteField(process))
+		}
+		lines = append(lines, Line{Kind: RestartLine, Raw: strings.Join(fields, " "), Restart: restart})
+	}
+	d.Lines = append(d.Lines[:at], append(lines, d.Lines[at:]...)...)
+}
+
+func (d *LineDocument) invalidEntries() []error {
+	var errs []error
+	for i, line := range d.Lines {
+		if line.Kind == InvalidLine {
+			errs = append(errs, &LineError{Line: i + 1, Err: line.Err})
+		}
+	}
+	return errs
+}
+
+func configType(cfg Config) string {
+	if cfg.Type == "" {
+		return "string"
+	}
+	return cfg.Type
+}
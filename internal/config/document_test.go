@@ -0,0 +1,303 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sampleDocument = `# Dock
+com.apple.dock autohide 1 boolean  # hide the dock
+com.apple.dock tilesize
+
+# Finder
+com.apple.finder ShowPathbar true boolean
+com.example.app broken 'an unterminated value
+`
+
+func TestParseDocument_RoundTrip(t *testing.T) {
+	contents := []string{
+		"",
+		"\n",
+		sampleDocument,
+		"com.apple.dock autohide 1 boolean",
+		"com.apple.dock autohide 1 boolean\r\n# comment\r\n",
+		"\n\n   \n\t# indented comment\n",
+	}
+
+	for _, content := range contents {
+		if rendered := ParseLineDocument(content).String(); rendered != content {
+			t.Errorf("Expected %q to round trip, got %q", content, rendered)
+		}
+	}
+}
+
+func TestParseDocument_LineKinds(t *testing.T) {
+	doc := ParseLineDocument(sampleDocument)
+
+	expectedKinds := []LineKind{CommentLine, EntryLine, EntryLine, BlankLine, CommentLine, EntryLine, InvalidLine, BlankLine}
+	if len(doc.Lines) != len(expectedKinds) {
+		t.Fatalf("Expected %d lines, got %d", len(expectedKinds), len(doc.Lines))
+	}
+	for i, kind := range expectedKinds {
+		if doc.Lines[i].Kind != kind {
+			t.Errorf("Expected line %d to be of kind %d, got %d", i+1, kind, doc.Lines[i].Kind)
+		}
+	}
+	if doc.Lines[1].Comment != "  # hide the dock" {
+		t.Errorf("Expected trailing comment to be kept, got %q", doc.Lines[1].Comment)
+	}
+	if doc.Lines[6].Err == nil {
+		t.Error("Expected invalid line to carry an error")
+	}
+}
+
+func TestDocument_Configs(t *testing.T) {
+	configs := ParseLineDocument(sampleDocument).Configs()
+
+	expected := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr(""), Type: "string"},
+		{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("true"), Type: "boolean"},
+	}
+	if len(configs) != len(expected) {
+		t.Fatalf("Expected %d configs, got %d", len(expected), len(configs))
+	}
+	for i := range expected {
+		if configs[i].Domain != expected[i].Domain || configs[i].Key != expected[i].Key ||
+			*configs[i].Value != *expected[i].Value || configs[i].Type != expected[i].Type {
+			t.Errorf("Config mismatch at index %d: expected %+v, got %+v", i, expected[i], configs[i])
+		}
+	}
+}
+
+func TestDocument_UpdateInPlace(t *testing.T) {
+	doc := ParseLineDocument(sampleDocument)
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("0"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("true"), Type: "boolean"},
+	})
+
+	expected := `# Dock
+com.apple.dock autohide 0 boolean  # hide the dock
+com.apple.dock tilesize 48 integer
+
+# Finder
+com.apple.finder ShowPathbar true boolean
+com.example.app broken 'an unterminated value
+`
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected content:\n%s\nGot content:\n%s", expected, rendered)
+	}
+}
+
+func TestDocument_UpdateKeepsUnchangedLinesVerbatim(t *testing.T) {
+	content := "com.apple.dock   autohide\t'1'   boolean\n"
+	doc := ParseLineDocument(content)
+
+	doc.Update([]Config{{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"}})
+
+	if rendered := doc.String(); rendered != content {
+		t.Errorf("Expected unchanged line to be kept verbatim, got %q", rendered)
+	}
+}
+
+func TestDocument_UpdateKeepsCRLF(t *testing.T) {
+	doc := ParseLineDocument("com.apple.dock autohide 1 boolean\r\n")
+
+	doc.Update([]Config{{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("0"), Type: "boolean"}})
+
+	expected := "com.apple.dock autohide 0 boolean\r\n"
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
+
+func TestDocument_UpdateAppendsNewEntries(t *testing.T) {
+	doc := ParseLineDocument("# Dock\ncom.apple.dock autohide 1 boolean\n")
+
+	doc.Update([]Config{{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("Application Support"), Type: ""}})
+
+	expected := "# Dock\ncom.apple.dock autohide 1 boolean\ncom.apple.finder ShowPathbar 'Application Support' string\n"
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
+
+func TestDocument_UpdateSkipsNilValues(t *testing.T) {
+	content := "com.apple.dock autohide 1 boolean\n"
+	doc := ParseLineDocument(content)
+
+	doc.Update([]Config{{Domain: "com.apple.dock", Key: "autohide", Value: nil, Type: "boolean"}})
+
+	if rendered := doc.String(); rendered != content {
+		t.Errorf("Expected %q, got %q", content, rendered)
+	}
+}
+
+func TestDocument_Mark(t *testing.T) {
+	doc := ParseLineDocument("com.apple.dock autohide 1 boolean  # hide the dock\ncom.example.app key 'a b'\r\n")
+
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "autohide"}, "not pulled, key absent")
+	doc.Mark(Config{Domain: "com.example.app", Key: "key"}, "not pulled, domain absent")
+	doc.Mark(Config{Domain: "com.example.app", Key: "key"}, "not pulled, timed out")
+
+	expected := "com.apple.dock autohide 1 boolean  # hide the dock # mdefaults: not pulled, key absent\n" +
+		"com.example.app key 'a b' # mdefaults: not pulled, timed out\r\n"
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+	if configs := doc.Configs(); *configs[1].Value != "a b" {
+		t.Errorf("Expected marked entry to keep its value, got %q", *configs[1].Value)
+	}
+
+	reparsed := ParseLineDocument(expected)
+	reparsed.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.example.app", Key: "key", Value: stringPtr("c"), Type: "string"},
+	})
+	expected = "com.apple.dock autohide 1 boolean  # hide the dock\ncom.example.app key c string\r\n"
+	if rendered := reparsed.String(); rendered != expected {
+		t.Errorf("Expected Update to remove the markers, got %q", rendered)
+	}
+}
+
+func TestParseDocument_AbsentEntries(t *testing.T) {
+	testCases := []struct {
+		line   string
+		absent bool
+		domain string
+		key    string
+		kind   LineKind
+	}{
+		{"!com.apple.dock mru-spaces", true, "com.apple.dock", "mru-spaces", EntryLine},
+		{"! com.apple.dock mru-spaces  # restore the default", true, "com.apple.dock", "mru-spaces", EntryLine},
+		{"!'com.example.my app' key", true, "com.example.my app", "key", EntryLine},
+		{"'!com.example.app' key value", false, "!com.example.app", "key", EntryLine},
+		{"!com.apple.dock mru-spaces 1 boolean", false, "", "", InvalidLine},
+		{"!com.apple.dock", false, "", "", InvalidLine},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			line := ParseLineDocument(tc.line).Lines[0]
+			if line.Kind != tc.kind {
+				t.Fatalf("Expected kind %d, got %d (%v)", tc.kind, line.Kind, line.Err)
+			}
+			if tc.kind != EntryLine {
+				return
+			}
+			cfg := line.Config
+			if cfg.Absent != tc.absent || cfg.Domain != tc.domain || cfg.Key != tc.key {
+				t.Errorf("Expected absent=%v %q %q, got absent=%v %q %q", tc.absent, tc.domain, tc.key, cfg.Absent, cfg.Domain, cfg.Key)
+			}
+		})
+	}
+}
+
+func TestFormatConfig_RoundTripsAbsentEntries(t *testing.T) {
+	configs := []Config{
+		{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+		{Domain: "!com.example.app", Key: "key", Absent: true},
+		{Domain: "!com.example.app", Key: "key", Value: stringPtr("v"), Type: "string"},
+	}
+
+	for _, cfg := range configs {
+		parsed := ParseLineDocument(FormatConfig(cfg)).Configs()
+		if len(parsed) != 1 || parsed[0].Absent != cfg.Absent || parsed[0].Domain != cfg.Domain || parsed[0].Key != cfg.Key {
+			t.Errorf("Expected %+v to round trip through %q, got %+v", cfg, FormatConfig(cfg), parsed)
+		}
+	}
+}
+
+func TestDocument_UpdateLeavesAbsentEntries(t *testing.T) {
+	content := "!com.apple.dock mru-spaces\n"
+	doc := ParseLineDocument(content)
+
+	doc.Update([]Config{{Domain: "com.apple.dock", Key: "mru-spaces", Value: stringPtr("1"), Type: "boolean"}})
+
+	if doc.String() != content {
+		t.Errorf("Expected absent entry to be kept, got %q", doc.String())
+	}
+}
+
+func TestDocument_AppendMissing(t *testing.T) {
+	doc := ParseLineDocument("# Dock\ncom.apple.dock autohide 0 boolean\n!com.apple.dock mru-spaces\n")
+
+	appended := doc.AppendMissing([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+	})
+
+	expected := "# Dock\ncom.apple.dock autohide 0 boolean\n!com.apple.dock mru-spaces\ncom.apple.dock tilesize 48 integer\n"
+	if doc.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, doc.String())
+	}
+	if len(appended) != 1 || appended[0].Key != "tilesize" {
+		t.Errorf("Expected only tilesize to be appended, got %+v", appended)
+	}
+}
+
+func TestReadDocument_Error(t *testing.T) {
+	fs := &MockFileSystem{StatError: errors.New("read error")}
+
+	if _, err := ReadDocument(fs, testConfigFilePath); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
+
+func TestWriteDocument(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: sampleDocument}
+
+	doc, err := ReadDocument(fs, testConfigFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := WriteDocument(fs, testConfigFilePath, doc); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fs.WriteFileContent != sampleDocument {
+		t.Errorf("Expected %q, got %q", sampleDocument, fs.WriteFileContent)
+	}
+}
+
+func TestParseDocument_Profiles(t *testing.T) {
+	content := "com.apple.dock autohide 0 boolean\n\n[profile presentation]  # for talks\ncom.apple.dock autohide 1 boolean\n\n[base]\ncom.apple.finder ShowPathbar 1 boolean\n[profile]\n"
+	doc := ParseLineDocument(content)
+
+	if rendered := doc.String(); rendered != content {
+		t.Errorf("Expected %q to round trip, got %q", content, rendered)
+	}
+	var profiles []string
+	for _, cfg := range doc.Configs() {
+		profiles = append(profiles, cfg.Profile)
+	}
+	if strings.Join(profiles, ",") != ",presentation," {
+		t.Errorf("Expected profiles [ presentation ], got %q", profiles)
+	}
+	if line := doc.Lines[7]; line.Kind != InvalidLine {
+		t.Errorf("Expected a section without a name to be invalid, got kind %d", line.Kind)
+	}
+}
+
+func TestDocument_UpdateProfiles(t *testing.T) {
+	doc := ParseLineDocument("com.apple.dock autohide 0 boolean\n\n[profile presentation]\ncom.apple.dock autohide 1 boolean\n")
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "orientation", Value: stringPtr("left"), Type: "string", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer", Profile: "work"},
+	})
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "autohide", Profile: "presentation"}, "not pulled, key absent")
+
+	expected := "com.apple.dock autohide 0 boolean\ncom.apple.dock tilesize 48 integer\n\n" +
+		"[profile presentation]\ncom.apple.dock autohide true boolean # mdefaults: not pulled, key absent\ncom.apple.dock orientation left string\n\n" +
+		"[profile work]\ncom.apple.dock tilesize 64 integer\n"
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
@@ -1,5 +1,11 @@
 package config
 
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
 // MockFileSystem is a mock implementation of the FileSystemReader interface for testing
 type MockFileSystem struct {
 	HomeDir           string
@@ -8,16 +14,49 @@ type MockFileSystem struct {
 	ConfigFileContent string
 	WriteFileErr      error
 	WriteFileContent  string
+	// Files, when set, holds the content of each file by path instead of
+	// ConfigFileContent. Written files are stored in it as well.
+	Files map[string]string
 }
 
 func (m *MockFileSystem) ReadFile(name string) (string, error) {
 	if m.StatError != nil {
 		return "", m.StatError
 	}
+	if m.Files != nil {
+		content, ok := m.Files[name]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return content, nil
+	}
 	return m.ConfigFileContent, nil
 }
 
 func (m *MockFileSystem) WriteFile(name string, content string) error {
 	m.WriteFileContent = content
+	if m.Files != nil && m.WriteFileErr == nil {
+		m.Files[name] = content
+	}
 	return m.WriteFileErr
 }
+
+func (m *MockFileSystem) UserHomeDir() (string, error) {
+	return m.HomeDir, nil
+}
+
+// ReadDir lists the files of Files directly inside name.
+func (m *MockFileSystem) ReadDir(name string) ([]string, error) {
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	var names []string
+	for path := range m.Files {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	if len(names) == 0 {
+		return nil, os.ErrNotExist
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Document is a parsed configuration file that can be updated and written
+// back without losing the parts mdefaults does not understand, such as
+// comments and the order of entries.
+type Document interface {
+	// Configs returns the entries of the document in file order.
+	Configs() []Config
+	// Update sets the value and type of the entries in configs, matched by
+	// profile, domain, key and scope, appending the ones that are not in the
+	// document yet. Absent entries are left alone.
+	Update(configs []Config)
+	// AppendMissing appends the entries of configs that are not in the
+	// document yet and returns them.
+	AppendMissing(configs []Config) []Config
+	// Mark records on the entry for the profile, domain, key and scope of cfg
+	// why it could not be updated. The next Update removes the note.
+	Mark(cfg Config, note string)
+	// String renders the document as the content of a configuration file.
+	String() string
+}
+
+// Format is a configuration file format.
+type Format int
+
+const (
+	// LineFormat is the `domain key value type` format of ~/.mdefaults.
+	LineFormat Format = iota
+	// YAMLFormat groups keys under their domain, see YAMLDocument.
+	YAMLFormat
+	// TOMLFormat uses a table per domain, see TOMLDocument.
+	TOMLFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case LineFormat:
+		return "line"
+	case YAMLFormat:
+		return "yaml"
+	case TOMLFormat:
+		return "toml"
+	}
+	return "unknown"
+}
+
+// FormatForPath detects the format of a configuration file from its
+// extension. Files without a known extension use the line format.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAMLFormat
+	case ".toml":
+		return TOMLFormat
+	}
+	return LineFormat
+}
+
+// ParseDocument parses content in the given format.
+func ParseDocument(format Format, content string) (Document, error) {
+	switch format {
+	case YAMLFormat:
+		return ParseYAMLDocument(content)
+	case TOMLFormat:
+		return ParseTOMLDocument(content)
+	case LineFormat:
+		return ParseLineDocument(content), nil
+	}
+	return nil, fmt.Errorf("unknown configuration format %d", format)
+}
+
+// NewDocument creates a document in the given format holding the restart
+// directives and configs.
+func NewDocument(format Format, configs []Config, restarts []Restart) (Document, error) {
+	doc, err := ParseDocument(format, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(restarts) > 0 {
+		doc.(restartAppender).appendRestarts(restarts)
+	}
+	doc.AppendMissing(configs)
+	return doc, nil
+}
+
+// invalidEntries is implemented by documents that keep entries they could not
+// parse.
+type invalidEntries interface {
+	invalidEntries() []error
+}
+
+// InvalidEntries returns the entries of doc that could not be parsed, each as
+// a *LineError. They are kept in the document but yield no configuration.
+func InvalidEntries(doc Document) []error {
+	if invalid, ok := doc.(invalidEntries); ok {
+		return invalid.invalidEntries()
+	}
+	return nil
+}
+
+// ReadDocument reads the configuration file at path, in the format given by
+// its extension. Entries that cannot be parsed are logged; they are kept in
+// the document but yield no configuration.
+func ReadDocument(fs FileSystemReader, path string) (Document, error) {
+	content, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ParseDocument(FormatForPath(path), content)
+	if err != nil {
+		return nil, withPath(path, err)
+	}
+	for _, err := range InvalidEntries(doc) {
+		log.Printf("Skipping %v", err)
+	}
+	return doc, nil
+}
+
+// LineError is an error found on a line of a configuration file.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// FileError is an error found in a configuration file, on Line when it is not
+// zero.
+type FileError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// withPath turns err into a *FileError for the file at path, one for each
+// LineError it holds, so that it reads "path:line: message".
+func withPath(path string, err error) error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, withPath(path, err))
+		}
+		return errors.Join(errs...)
+	}
+	var lineErr *LineError
+	if errors.As(err, &lineErr) {
+		return &FileError{Path: path, Line: lineErr.Line, Err: lineErr.Err}
+	}
+	return &FileError{Path: path, Err: err}
+}
+
+// WriteDocument writes the document to the configuration file at path.
+func WriteDocument(fs FileSystemReader, path string, doc Document) error {
+	return fs.WriteFile(path, doc.String())
+}
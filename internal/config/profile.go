@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profiles returns the names of the profiles used by configs, in the order
+// they first appear.
+func Profiles(configs []Config) []string {
+	var profiles []string
+	seen := map[string]bool{}
+	for _, cfg := range configs {
+		if cfg.Profile != "" && !seen[cfg.Profile] {
+			seen[cfg.Profile] = true
+			profiles = append(profiles, cfg.Profile)
+		}
+	}
+	return profiles
+}
+
+// Resolve returns the entries that apply with the given profile. The shared
+// base entries always apply; an entry of the profile replaces the base entry
+// for the same domain and key in place, and the others are added after the
+// base. With an empty profile only the base applies.
+func Resolve(configs []Config, profile string) ([]Config, error) {
+	var base, layer []Config
+	found := false
+	for _, cfg := range configs {
+		switch cfg.Profile {
+		case "":
+			base = append(base, cfg)
+		case profile:
+			found = true
+			layer = append(layer, cfg)
+		}
+	}
+	if profile != "" && !found {
+		available := Profiles(configs)
+		if len(available) == 0 {
+			return nil, fmt.Errorf("unknown profile %q, the configuration file defines no profiles", profile)
+		}
+		return nil, fmt.Errorf("unknown profile %q, available profiles: %s", profile, strings.Join(available, ", "))
+	}
+
+	resolved := append([]Config{}, base...)
+	for _, cfg := range layer {
+		replaced := false
+		for i := range resolved {
+			if resolved[i].Profile == "" && resolved[i].Domain == cfg.Domain && resolved[i].Key == cfg.Key && resolved[i].Host == cfg.Host && resolved[i].System == cfg.System {
+				resolved[i] = cfg
+				replaced = true
+			}
+		}
+		if !replaced {
+			resolved = append(resolved, cfg)
+		}
+	}
+	return resolved, nil
+}
+
+// sameEntry reports whether a and b configure the same key in the same layer.
+func sameEntry(a, b Config) bool {
+	return a.Profile == b.Profile && a.Domain == b.Domain && a.Key == b.Key && a.Host == b.Host && a.System == b.System
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	configs := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("0"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.notificationcenterui", Key: "doNotDisturb", Value: stringPtr("1"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Absent: true, Profile: "work"},
+	}
+
+	testCases := []struct {
+		profile  string
+		expected []string
+	}{
+		{"", []string{"com.apple.dock autohide 0 boolean", "com.apple.dock tilesize 48 integer"}},
+		{"presentation", []string{
+			"com.apple.dock autohide 1 boolean",
+			"com.apple.dock tilesize 48 integer",
+			"com.apple.notificationcenterui doNotDisturb 1 boolean",
+		}},
+		{"work", []string{"com.apple.dock autohide 0 boolean", "!com.apple.dock tilesize"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.profile, func(t *testing.T) {
+			resolved, err := Resolve(configs, tc.profile)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var lines []string
+			for _, cfg := range resolved {
+				lines = append(lines, FormatConfig(cfg))
+			}
+			if strings.Join(lines, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("Expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestResolve_UnknownProfile(t *testing.T) {
+	configs := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer", Profile: "work"},
+	}
+
+	_, err := Resolve(configs, "home")
+	expected := `unknown profile "home", available profiles: presentation, work`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, err)
+	}
+	if _, err := Resolve(nil, "home"); err == nil {
+		t.Error("Expected an error without profiles, got nil")
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+// restartKeyword starts a restart directive.
+const restartKeyword = "restart"
+
+// Restart is a restart directive of a configuration file. It sets the
+// processes push restarts after changing Domain, replacing the built-in
+// ones; no processes means Domain needs no restart.
+type Restart struct {
+	Domain    string
+	Processes []string
+	Line      int
+}
+
+// restarter is implemented by documents that can hold restart directives.
+type restarter interface {
+	Restarts() []Restart
+}
+
+// restartAppender is implemented by documents that can be given restart
+// directives.
+type restartAppender interface {
+	appendRestarts(restarts []Restart)
+}
+
+// lastRestarts returns one directive per domain, the last one given for it,
+// in the order the domains first appear.
+func lastRestarts(restarts []Restart) []Restart {
+	var last []Restart
+	index := map[string]int{}
+	for _, restart := range restarts {
+		if i, ok := index[restart.Domain]; ok {
+			last[i] = restart
+			continue
+		}
+		index[restart.Domain] = len(last)
+		last = append(last, restart)
+	}
+	return last
+}
+
+// Restarts returns the processes to restart for each domain the files of the
+// tree name in restart directives. A file's directives override those of the
+// files it includes, and later includes override earlier ones.
+func (t *Tree) Restarts() map[string][]string {
+	restarts := map[string][]string{}
+	for _, restart := range t.restarts {
+		restarts[restart.Domain] = restart.Processes
+	}
+	return restarts
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDocument_RestartLines(t *testing.T) {
+	doc := ParseLineDocument("restart com.example.app ExampleApp 'Example Helper'  # both\nrestart com.apple.dock\nrestart\n")
+
+	expected := []Restart{
+		{Domain: "com.example.app", Processes: []string{"ExampleApp", "Example Helper"}, Line: 1},
+		{Domain: "com.apple.dock", Processes: []string{}, Line: 2},
+	}
+	if restarts := doc.Restarts(); !reflect.DeepEqual(restarts, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, restarts)
+	}
+	if doc.Lines[2].Kind != InvalidLine {
+		t.Errorf("Expected restart without a domain to be invalid, got kind %d", doc.Lines[2].Kind)
+	}
+	if len(doc.Configs()) != 0 {
+		t.Errorf("Expected restart lines not to be entries, got %+v", doc.Configs())
+	}
+}
+
+func TestTree_Restarts(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults.yaml": "include: [base.toml, extra]\nrestart:\n  com.apple.dock: []\n  com.example.app: [ExampleApp, ExampleHelper]\n",
+		"/home/me/base.toml":       "restart = { \"com.apple.dock\" = \"Dock\", \"com.example.tool\" = \"Tool\" }\n\n[\"com.apple.dock\"]\ntilesize = 48\n",
+		"/home/me/extra":           "restart com.example.tool OtherTool\n",
+	}}
+
+	tree, err := LoadTree(fs, "/home/me/.mdefaults.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string][]string{
+		"com.apple.dock":   {},
+		"com.example.app":  {"ExampleApp", "ExampleHelper"},
+		"com.example.tool": {"OtherTool"},
+	}
+	if restarts := tree.Restarts(); !reflect.DeepEqual(restarts, expected) {
+		t.Errorf("Expected %v, got %v", expected, restarts)
+	}
+	if len(tree.Configs()) != 1 {
+		t.Errorf("Expected the restart keys not to be read as domains, got %+v", tree.Configs())
+	}
+}
+
+func TestRestarts_Errors(t *testing.T) {
+	if _, err := ParseYAMLDocument("restart: [Dock]\n"); err == nil {
+		t.Error("Expected an error for a YAML restart list")
+	}
+	if _, err := ParseYAMLDocument("restart:\n  com.apple.dock: {name: Dock}\n"); err == nil {
+		t.Error("Expected an error for a YAML restart map value")
+	}
+	if _, err := ParseTOMLDocument("restart = \"Dock\"\n"); err == nil {
+		t.Error("Expected an error for a TOML restart string")
+	}
+	if _, err := ParseTOMLDocument("restart = { \"com.apple.dock\" = 1 }\n"); err == nil {
+		t.Error("Expected an error for a TOML restart number")
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+// CurrentHost is the host of entries that configure the ByHost preferences of
+// this Mac, the ones `defaults -currentHost` reads and writes.
+const CurrentHost = "currentHost"
+
+// currentHostOption and hostOption start an entry line of the ByHost
+// preferences of this Mac or of a named host, like the options of defaults,
+// and systemOption one of the system-wide preferences in /Library/Preferences:
+//
+//	-currentHost com.apple.menuextra.clock ShowSeconds 1 boolean
+//	-host studio com.apple.menuextra.clock ShowSeconds 1 boolean
+//	-system com.apple.loginwindow SHOWFULLNAME 1 boolean
+const (
+	currentHostOption = "-currentHost"
+	hostOption        = "-host"
+	systemOption      = "-system"
+)
+
+var errHostName = errors.New("-host takes a host name followed by the entry")
+
+// errSystemHost is returned for entries that are both system-wide and ByHost;
+// the system preferences have no ByHost part.
+var errSystemHost = errors.New("system entries take no host")
+
+var errScopeOptions = errors.New("an entry takes only one of -currentHost, -host and -system")
+
+// appOption names the domain of an entry line by the application that owns
+// it, like `defaults read -app Safari`. The domain of the entry is then
+// "-app Safari":
+//
+//	-app Safari ShowFullURLInSmartSearchField 1 boolean
+const appOption = defaults.AppOption
+
+var errAppName = errors.New("-app takes an application name followed by the key")
+
+// errSystemDomain is returned for system entries whose domain is an app or the
+// path of a property list; system domains are named by their identifier.
+var errSystemDomain = errors.New("system entries take a domain name, not an app or a path")
+
+// isBare reports whether field i of a line was written without quotes, as
+// quotedFields tells; only bare fields are options.
+func isBare(quoted []bool, i int) bool {
+	return i >= len(quoted) || !quoted[i]
+}
+
+// joinApp joins the -app option in front of the fields of an entry line with
+// the application name that follows it into the domain of the entry. quoted
+// tells which fields were quoted, see quotedFields.
+func joinApp(parts []string, quoted []bool) ([]string, error) {
+	if parts[0] != appOption || !isBare(quoted, 0) {
+		return parts, nil
+	}
+	if len(parts) < 2 {
+		return nil, errAppName
+	}
+	return append([]string{appOption + " " + parts[1]}, parts[2:]...), nil
+}
+
+// cutScope removes the scope option in front of the fields of an entry line
+// and returns the host and system scope it selects, along with the quoted
+// flags of the remaining fields. quoted tells which fields were quoted, see
+// quotedFields; a quoted field is never an option.
+func cutScope(parts []string, quoted []bool) (host string, system bool, rest []string, restQuoted []bool, err error) {
+	option := parts[0]
+	if !isBare(quoted, 0) {
+		option = ""
+	}
+	switch option {
+	case currentHostOption:
+		host, parts = CurrentHost, parts[1:]
+	case hostOption:
+		if len(parts) < 2 {
+			return "", false, nil, nil, errHostName
+		}
+		host, parts = parts[1], parts[2:]
+	case systemOption:
+		system, parts = true, parts[1:]
+	default:
+		return "", false, parts, quoted, nil
+	}
+	if len(parts) == 0 {
+		return "", false, nil, nil, errMissingKey
+	}
+	if len(quoted) >= len(parts) {
+		quoted = quoted[len(quoted)-len(parts):]
+	} else {
+		quoted = nil
+	}
+	if isBare(quoted, 0) && (parts[0] == currentHostOption || parts[0] == hostOption || parts[0] == systemOption) {
+		return "", false, nil, nil, errScopeOptions
+	}
+	return host, system, parts, quoted, nil
+}
+
+// validateScope reports an entry that is both system-wide and ByHost, and a
+// system entry whose domain is an app or a path.
+func validateScope(cfg Config) error {
+	if cfg.System && cfg.Host != "" {
+		return errSystemHost
+	}
+	if _, ok := defaults.CutApp(cfg.Domain); cfg.System && (ok || defaults.IsPathDomain(cfg.Domain)) {
+		return errSystemDomain
+	}
+	return nil
+}
+
+// FormatScope renders the option that starts the entry line of cfg, followed
+// by a space, or nothing for the preferences of the user shared by every
+// host.
+func FormatScope(cfg Config) string {
+	switch {
+	case cfg.System:
+		return systemOption + " "
+	case cfg.Host == "":
+		return ""
+	case cfg.Host == CurrentHost:
+		return currentHostOption + " "
+	}
+	return hostOption + " " + quoteField(cfg.Host) + " "
+}
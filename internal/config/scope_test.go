@@ -0,0 +1,224 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLineDocument_Hosts(t *testing.T) {
+	doc := ParseLineDocument(strings.Join([]string{
+		"-currentHost com.apple.menuextra.clock ShowSeconds 1 boolean # ByHost",
+		"-host studio com.apple.dock tilesize 48 integer",
+		"-currentHost !com.apple.dock mru-spaces",
+		"com.apple.dock tilesize 36 integer",
+		"-host",
+		"-currentHost",
+	}, "\n"))
+
+	configs := doc.Configs()
+	if len(configs) != 4 {
+		t.Fatalf("Expected 4 entries, got %+v", configs)
+	}
+	expected := []struct {
+		host, domain, key string
+		absent            bool
+	}{
+		{CurrentHost, "com.apple.menuextra.clock", "ShowSeconds", false},
+		{"studio", "com.apple.dock", "tilesize", false},
+		{CurrentHost, "com.apple.dock", "mru-spaces", true},
+		{"", "com.apple.dock", "tilesize", false},
+	}
+	for i, e := range expected {
+		cfg := configs[i]
+		if cfg.Host != e.host || cfg.Domain != e.domain || cfg.Key != e.key || cfg.Absent != e.absent {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, e, cfg)
+		}
+	}
+	if configs[0].Comment != "ByHost" {
+		t.Errorf("Expected the comment to be kept, got %q", configs[0].Comment)
+	}
+	for _, i := range []int{4, 5} {
+		if doc.Lines[i].Kind != InvalidLine {
+			t.Errorf("Expected line %d to be invalid, got kind %d", i+1, doc.Lines[i].Kind)
+		}
+	}
+}
+
+func TestLineDocument_UpdateMatchesHost(t *testing.T) {
+	doc := ParseLineDocument("com.apple.dock tilesize 36 integer\n-currentHost com.apple.dock tilesize 36 integer\n")
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer", Host: CurrentHost},
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean", Host: "studio"},
+	})
+
+	expected := "com.apple.dock tilesize 36 integer\n-currentHost com.apple.dock tilesize 48 integer\n-host studio com.apple.dock autohide 1 boolean\n"
+	if doc.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, doc.String())
+	}
+}
+
+func TestYAMLDocument_Hosts(t *testing.T) {
+	doc, err := ParseYAMLDocument("com.apple.menuextra.clock:\n  ShowSeconds: {value: true, type: boolean, host: currentHost}\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if configs := doc.Configs(); len(configs) != 1 || configs[0].Host != CurrentHost {
+		t.Fatalf("Expected a currentHost entry, got %+v", configs)
+	}
+
+	doc.AppendMissing([]Config{{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true, Host: "studio"}})
+	reparsed, err := ParseYAMLDocument(doc.String())
+	if err != nil {
+		t.Fatalf("Expected the document to parse again, got %v\n%s", err, doc.String())
+	}
+	if configs := reparsed.Configs(); len(configs) != 2 || configs[1].Host != "studio" || !configs[1].Absent {
+		t.Errorf("Expected the appended host to round-trip, got %+v", configs)
+	}
+
+	invalid, err := ParseYAMLDocument("com.apple.dock:\n  tilesize: {value: 48, host: [a]}\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(invalid.Configs()) != 0 || len(invalid.invalidEntries()) != 1 {
+		t.Errorf("Expected a host list to make the entry invalid, got %+v", invalid.Configs())
+	}
+}
+
+func TestTOMLDocument_Hosts(t *testing.T) {
+	doc, err := ParseTOMLDocument("[\"com.apple.menuextra.clock\"]\nShowSeconds = { value = true, host = \"currentHost\" }\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	configs := doc.Configs()
+	if len(configs) != 1 || configs[0].Host != CurrentHost || configs[0].Type != "boolean" {
+		t.Fatalf("Expected a currentHost boolean, got %+v", configs)
+	}
+
+	doc.AppendMissing([]Config{
+		{Domain: "com.apple.menuextra.clock", Key: "DateFormat", Value: stringPtr("HH:mm"), Type: "string", Host: CurrentHost},
+		{Domain: "com.apple.menuextra.clock", Key: "FlashDateSeparators", Absent: true, Host: "studio"},
+	})
+	expected := "[\"com.apple.menuextra.clock\"]\n" +
+		"ShowSeconds = { value = true, host = \"currentHost\" }\n" +
+		"DateFormat = { value = \"HH:mm\", host = \"currentHost\" }\n" +
+		"FlashDateSeparators = { absent = true, host = \"studio\" }\n"
+	if doc.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, doc.String())
+	}
+
+	if _, err := ParseTOMLDocument("[\"com.apple.dock\"]\ntilesize = { value = 48, host = 1 }\n"); err == nil {
+		t.Error("Expected an error for a host that is not a string")
+	}
+}
+
+func TestParseLineDocument_System(t *testing.T) {
+	doc := ParseLineDocument(strings.Join([]string{
+		"-system com.apple.loginwindow SHOWFULLNAME 1 boolean",
+		"-system !com.apple.loginwindow GuestEnabled",
+		"-system -currentHost com.apple.loginwindow SHOWFULLNAME 1 boolean",
+	}, "\n"))
+
+	configs := doc.Configs()
+	if len(configs) != 2 || !configs[0].System || !configs[1].System || !configs[1].Absent {
+		t.Fatalf("Expected two system entries, got %+v", configs)
+	}
+	if doc.Lines[2].Kind != InvalidLine {
+		t.Errorf("Expected an entry with two scopes to be invalid, got kind %d", doc.Lines[2].Kind)
+	}
+	for i, cfg := range configs {
+		if line := FormatConfig(cfg); line != doc.Lines[i].Raw {
+			t.Errorf("Expected %s to round-trip, got %s", doc.Lines[i].Raw, line)
+		}
+	}
+}
+
+func TestSystemEntries_YAMLAndTOML(t *testing.T) {
+	yamlDoc, err := ParseYAMLDocument("com.apple.loginwindow:\n  SHOWFULLNAME: {value: true, type: boolean, system: true}\n  GuestEnabled: {absent: true, system: true, host: currentHost}\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if configs := yamlDoc.Configs(); len(configs) != 1 || !configs[0].System {
+		t.Errorf("Expected one system entry, got %+v", configs)
+	}
+	if len(yamlDoc.invalidEntries()) != 1 {
+		t.Errorf("Expected a system entry with a host to be invalid, got %v", yamlDoc.invalidEntries())
+	}
+
+	tomlDoc, err := ParseTOMLDocument("[\"com.apple.loginwindow\"]\nSHOWFULLNAME = { value = true, system = true }\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	configs := tomlDoc.Configs()
+	if len(configs) != 1 || !configs[0].System {
+		t.Fatalf("Expected one system entry, got %+v", configs)
+	}
+	tomlDoc.AppendMissing([]Config{{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Absent: true, System: true}})
+	if !strings.Contains(tomlDoc.String(), "GuestEnabled = { absent = true, system = true }") {
+		t.Errorf("Expected the system scope to be written, got\n%s", tomlDoc.String())
+	}
+	if _, err := ParseTOMLDocument("[\"com.apple.loginwindow\"]\nSHOWFULLNAME = { value = true, system = \"yes\" }\n"); err == nil {
+		t.Error("Expected an error for a system setting that is not a boolean")
+	}
+}
+
+func TestParseLineDocument_AppsAndPaths(t *testing.T) {
+	doc := ParseLineDocument(strings.Join([]string{
+		"-app Safari ShowFullURLInSmartSearchField 1 boolean",
+		"-app 'Visual Studio Code' ApplePressAndHoldEnabled 0 boolean",
+		"!-app Safari AutoOpenSafeDownloads",
+		"~/Library/Containers/com.apple.mail/Data/Library/Preferences/com.apple.mail.plist DisableInlineAttachmentViewing 1 boolean",
+		"/Library/Preferences/com.example.plist Enabled 1 boolean",
+		"-app",
+		"-system -app Safari ShowFullURLInSmartSearchField 1 boolean",
+		"-system ~/Library/Preferences/com.example.plist Enabled 1 boolean",
+	}, "\n"))
+
+	configs := doc.Configs()
+	if len(configs) != 5 {
+		t.Fatalf("Expected 5 entries, got %+v", configs)
+	}
+	expected := []struct {
+		domain, key string
+		absent      bool
+	}{
+		{"-app Safari", "ShowFullURLInSmartSearchField", false},
+		{"-app Visual Studio Code", "ApplePressAndHoldEnabled", false},
+		{"-app Safari", "AutoOpenSafeDownloads", true},
+		{"~/Library/Containers/com.apple.mail/Data/Library/Preferences/com.apple.mail.plist", "DisableInlineAttachmentViewing", false},
+		{"/Library/Preferences/com.example.plist", "Enabled", false},
+	}
+	for i, e := range expected {
+		cfg := configs[i]
+		if cfg.Domain != e.domain || cfg.Key != e.key || cfg.Absent != e.absent {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, e, cfg)
+		}
+		if formatted := FormatConfig(cfg); formatted != doc.Lines[i].Raw {
+			t.Errorf("Entry %d: expected to format as %q, got %q", i, doc.Lines[i].Raw, formatted)
+		}
+	}
+	for _, i := range []int{5, 6, 7} {
+		if doc.Lines[i].Kind != InvalidLine {
+			t.Errorf("Expected line %d to be invalid, got kind %d", i+1, doc.Lines[i].Kind)
+		}
+	}
+}
+
+func TestAppDomains_YAMLAndTOML(t *testing.T) {
+	yamlDoc, err := ParseYAMLDocument("\"-app Safari\":\n  ShowFullURLInSmartSearchField: {value: true, type: boolean}\n  AutoOpenSafeDownloads: {absent: true, system: true}\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tomlDoc, err := ParseTOMLDocument("[\"-app Safari\"]\nShowFullURLInSmartSearchField = true\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for name, configs := range map[string][]Config{"yaml": yamlDoc.Configs(), "toml": tomlDoc.Configs()} {
+		if len(configs) != 1 || configs[0].Domain != "-app Safari" || configs[0].Key != "ShowFullURLInSmartSearchField" {
+			t.Errorf("%s: expected the entry of the Safari app, got %+v", name, configs)
+		}
+	}
+	if len(yamlDoc.invalidEntries()) != 1 {
+		t.Errorf("Expected a system entry of an app to be invalid, got %v", yamlDoc.invalidEntries())
+	}
+}
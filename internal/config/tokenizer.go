@@ -0,0 +1,260 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+// splitFields splits a configuration line into fields. Fields are separated by
+// unquoted whitespace and follow shell-style quoting rules:
+//   - 'single quotes' keep every character literally,
+//   - "double quotes" interpret the escapes \\ \" \n \r \t and \xHH,
+//   - a backslash outside quotes escapes the next character,
+//   - an unquoted # at the start of a field begins a comment, except in the
+//     old lines parseLine recognizes, such as `com.example.app color #fff string`.
+//
+// Quoted sections may be adjacent to unquoted text, e.g. Application' 'Support.
+// The returned offset is where the trailing comment, including the whitespace
+// in front of it, starts; it is len(line) when the line has no comment.
+func splitFields(line string) ([]string, int, error) {
+	fields, _, commentAt, err := tokenize(line)
+	return fields, commentAt, err
+}
+
+// quotedFields reports for each field of line whether any of it was quoted or
+// escaped, so that a quoted field is not taken for an option or a keyword. It
+// returns nil for lines splitFields rejects.
+func quotedFields(line string) []bool {
+	_, quoted, _, err := tokenize(line)
+	if err != nil {
+		return nil
+	}
+	return quoted
+}
+
+// tokenize implements splitFields and quotedFields.
+func tokenize(line string) ([]string, []bool, int, error) {
+	var fields []string
+	var quoted []bool
+	var field strings.Builder
+	inField, inQuotes := false, false
+	fieldEnd := 0
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case isFieldSeparator(c):
+			if inField {
+				fields = append(fields, field.String())
+				quoted = append(quoted, inQuotes)
+				field.Reset()
+				inField, inQuotes = false, false
+				fieldEnd = i
+			}
+		case c == '#' && !inField:
+			return fields, quoted, fieldEnd, nil
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, nil, 0, fmt.Errorf("unterminated single quote at column %d", i+1)
+			}
+			field.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inField, inQuotes = true, true
+		case c == '"':
+			n, err := readDoubleQuoted(line[i:], &field)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("%v at column %d", err, i+1)
+			}
+			i += n - 1
+			inField, inQuotes = true, true
+		case c == '\\':
+			if i+1 >= len(line) {
+				return nil, nil, 0, fmt.Errorf("trailing backslash at column %d", i+1)
+			}
+			field.WriteByte(line[i+1])
+			i++
+			inField, inQuotes = true, true
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+		quoted = append(quoted, inQuotes)
+	}
+	return fields, quoted, len(line), nil
+}
+
+// readDoubleQuoted decodes the double-quoted section at the start of s into field
+// and returns the number of bytes consumed, including both quotes.
+func readDoubleQuoted(s string, field *strings.Builder) (int, error) {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return 0, fmt.Errorf("unterminated double quote")
+			}
+			i++
+			switch s[i] {
+			case '\\', '"':
+				field.WriteByte(s[i])
+			case 'n':
+				field.WriteByte('\n')
+			case 'r':
+				field.WriteByte('\r')
+			case 't':
+				field.WriteByte('\t')
+			case 'x':
+				if b, ok := decodeHexByte(s[i+1:]); ok {
+					field.WriteByte(b)
+					i += 2
+				} else {
+					field.WriteString(`\x`)
+				}
+			default:
+				// Unknown escapes are kept verbatim so that values such as
+				// "C:\path" survive without doubling every backslash.
+				field.WriteByte('\\')
+				field.WriteByte(s[i])
+			}
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("unterminated double quote")
+}
+
+func decodeHexByte(s string) (byte, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	hi, ok1 := hexValue(s[0])
+	lo, ok2 := hexValue(s[1])
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return hi<<4 | lo, true
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func isFieldSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// quoteField returns s in a form that splitFields reads back as exactly s.
+// Plain values are returned unchanged, values that only need protection from
+// splitting are single-quoted, and anything else is double-quoted with escapes.
+func quoteField(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if !needsQuoting(s) {
+		return s
+	}
+	if !strings.Contains(s, "'") && !hasUnprintable(s) {
+		return "'" + s + "'"
+	}
+	return doubleQuote(s)
+}
+
+// absentMarker in front of the domain marks an entry whose key must not exist.
+const absentMarker = '!'
+
+// quoteDomain quotes a domain like quoteField, and also when it would be read
+// back as something else: a domain starting with the absent marker or with
+// the [ of a section line, and one named like a directive or an option. The
+// domain of an app is rendered as the -app option followed by the name.
+func quoteDomain(s string) string {
+	if name, ok := defaults.CutApp(s); ok {
+		return appOption + " " + quoteField(name)
+	}
+	if s != "" && !needsQuoting(s) && isReservedDomain(s) {
+		return "'" + s + "'"
+	}
+	return quoteField(s)
+}
+
+// isReservedDomain reports whether an unquoted domain would not be read back
+// as the domain of an entry.
+func isReservedDomain(s string) bool {
+	switch s {
+	case includeKeyword, restartKeyword, currentHostOption, hostOption, systemOption, appOption:
+		return true
+	}
+	return s[0] == absentMarker || s[0] == '['
+}
+
+func needsQuoting(s string) bool {
+	if s[0] == '#' {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case isFieldSeparator(c), c == '\'', c == '"', c == '\\':
+			return true
+		case c < 0x20 || c == 0x7f:
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+func hasUnprintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return !utf8.ValidString(s)
+}
+
+func doubleQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+			i++
+			continue
+		}
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"plain fields", "com.apple.dock autohide 1 boolean", []string{"com.apple.dock", "autohide", "1", "boolean"}},
+		{"repeated whitespace", "com.apple.dock \t autohide   1", []string{"com.apple.dock", "autohide", "1"}},
+		{"leading and trailing whitespace", "  com.apple.dock autohide  ", []string{"com.apple.dock", "autohide"}},
+		{"single quotes", `d k 'Application Support'`, []string{"d", "k", "Application Support"}},
+		{"single quotes keep backslashes", `d k 'C:\path\n'`, []string{"d", "k", `C:\path\n`}},
+		{"double quotes with escapes", `d k "a \"b\" \\ c\n\t\r"`, []string{"d", "k", "a \"b\" \\ c\n\t\r"}},
+		{"double quotes with hex escape", `d k "\x00\x1B"`, []string{"d", "k", "\x00\x1b"}},
+		{"double quotes keep unknown escapes", `d k "C:\path\x"`, []string{"d", "k", `C:\path\x`}},
+		{"backslash outside quotes", `d k a\ b\'c`, []string{"d", "k", "a b'c"}},
+		{"adjacent quoted sections", `d k Application' 'Support"!"`, []string{"d", "k", "Application Support!"}},
+		{"empty quoted field", `d k "" string`, []string{"d", "k", "", "string"}},
+		{"empty single quoted field", `d k '' string`, []string{"d", "k", "", "string"}},
+		{"multibyte characters", "d k 日本語", []string{"d", "k", "日本語"}},
+		{"empty line", "", nil},
+		{"hash inside a field", "d k a#b", []string{"d", "k", "a#b"}},
+		{"quoted hash", `d k "#value"`, []string{"d", "k", "#value"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, _, err := splitFields(tc.line)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(fields, tc.expected) {
+				t.Errorf("splitFields(%q) = %q, expected %q", tc.line, fields, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSplitFields_Comments(t *testing.T) {
+	testCases := []struct {
+		name            string
+		line            string
+		expectedFields  []string
+		expectedComment string
+	}{
+		{"comment line", "# dock settings", nil, "# dock settings"},
+		{"indented comment line", "  # dock settings", nil, "  # dock settings"},
+		{"trailing comment", "com.apple.dock autohide 1 boolean  # hide the dock", []string{"com.apple.dock", "autohide", "1", "boolean"}, "  # hide the dock"},
+		{"comment without space", "d k v #note", []string{"d", "k", "v"}, " #note"},
+		{"no comment", "d k a#b", []string{"d", "k", "a#b"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, commentAt, err := splitFields(tc.line)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(fields, tc.expectedFields) {
+				t.Errorf("Expected fields %q, got %q", tc.expectedFields, fields)
+			}
+			if comment := tc.line[commentAt:]; comment != tc.expectedComment {
+				t.Errorf("Expected comment %q, got %q", tc.expectedComment, comment)
+			}
+		})
+	}
+}
+
+func TestSplitFields_Errors(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+	}{
+		{"unterminated single quote", "d k 'value"},
+		{"unterminated double quote", `d k "value`},
+		{"escaped closing double quote", `d k "value\"`},
+		{"trailing backslash", `d k value\`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := splitFields(tc.line); err == nil {
+				t.Errorf("Expected error for %q, got nil", tc.line)
+			}
+		})
+	}
+}
+
+func TestQuoteField(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"!@#$%^&*()", "!@#$%^&*()"},
+		{"", `""`},
+		{"Application Support", "'Application Support'"},
+		{`say "hi"`, `'say "hi"'`},
+		{`C:\path`, `'C:\path'`},
+		{"it's", `"it's"`},
+		{"new\nline", `"new\nline"`},
+		{"tab\there", `"tab\there"`},
+		{"\x1b", `"\x1b"`},
+		{"\xff", `"\xff"`},
+		{"#tag", "'#tag'"},
+		{"a#b", "a#b"},
+	}
+
+	for _, tc := range testCases {
+		if quoted := quoteField(tc.value); quoted != tc.expected {
+			t.Errorf("quoteField(%q) = %s, expected %s", tc.value, quoted, tc.expected)
+		}
+	}
+}
+
+func TestQuoteDomain_RoundTripsReservedNames(t *testing.T) {
+	for _, domain := range []string{"restart", "include", "-currentHost", "-host", "-system", "-app", "[base]", "[profile x]", "!com.example.app", "-app Safari"} {
+		assertQuoteRoundTrip(t, domain)
+	}
+}
+
+func TestQuoteField_RoundTripsEveryByte(t *testing.T) {
+	for b := 0; b < 256; b++ {
+		value := "a" + string([]byte{byte(b)}) + "b"
+		assertQuoteRoundTrip(t, value)
+		assertQuoteRoundTrip(t, string([]byte{byte(b)}))
+	}
+}
+
+func FuzzQuoteField(f *testing.F) {
+	f.Add("")
+	f.Add("Application Support")
+	f.Add(`it's "quoted" \ value`)
+	f.Add("(    \"com.apple.Safari\",    foo)")
+	f.Add("\x00\n\r\t\xff")
+	f.Fuzz(func(t *testing.T, value string) {
+		assertQuoteRoundTrip(t, value)
+	})
+}
+
+func assertQuoteRoundTrip(t *testing.T, value string) {
+	t.Helper()
+	line := strings.Join([]string{quoteField("domain"), quoteField(value), quoteField("string")}, " ")
+	fields, _, err := splitFields(line)
+	if err != nil {
+		t.Fatalf("splitFields(%q) returned error: %v", line, err)
+	}
+	if len(fields) != 3 || fields[1] != value {
+		t.Fatalf("Round trip of %q through %q produced %q", value, line, fields)
+	}
+
+	// As a domain, with and without a scope option in front of it.
+	v := "1"
+	for _, cfg := range []Config{
+		{Domain: value, Key: "key", Value: &v, Type: "string"},
+		{Domain: value, Key: "key", Value: &v, Type: "string", Host: CurrentHost},
+		{Domain: value, Key: "key", Absent: true},
+	} {
+		line := FormatConfig(cfg)
+		configs := ParseLineDocument(line).Configs()
+		if len(configs) != 1 || configs[0].Domain != value || configs[0].Host != cfg.Host || configs[0].Absent != cfg.Absent {
+			t.Fatalf("Round trip of domain %q through %q produced %+v", value, line, configs)
+		}
+	}
+}
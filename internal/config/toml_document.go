@@ -0,0 +1,733 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+// TOMLDocument is a configuration file in the TOML format, with a table per
+// domain:
+//
+//	["com.apple.dock"]
+//	autohide = true  # hide the Dock automatically
+//	tilesize = 48
+//	persistent-others = ["a", "b"]
+//	wvous-tl-modifier = { value = 0, type = "float" }
+//	mru-spaces = { absent = true }
+//
+//	["com.apple.menuextra.clock"]
+//	ShowSeconds = { value = true, host = "currentHost" }
+//
+//	[profiles.presentation."com.apple.dock"]
+//	autohide = true
+//
+// Values use the TOML type that matches their defaults type: booleans,
+// integers, floats, datetimes for dates, arrays and inline tables for dicts,
+// and strings for everything else. A table with only the fields value, type,
+// absent, host and system sets the type explicitly, in which case the value
+// must match it, or selects the ByHost preferences of this Mac (currentHost),
+// those of a named host or the system-wide preferences (system = true). Values
+// that do not match their type, and layouts other than key/value pairs in a
+// table per domain, are errors that name the offending line; a type defaults
+// does not know takes a string value. The entries of a profile are in tables
+// named profiles.<profile>.<domain>, a top-level include key names files to
+// include, see LoadTree, and a top-level restart key such as
+// restart = { "com.apple.dock" = "Dock" } sets the processes push restarts
+// after changing a domain. Comments and the order of entries are kept when
+// the document is updated.
+type TOMLDocument struct {
+	lines    []string
+	entries  []*tomlEntry
+	tables   []*tomlTable
+	includes []Include
+	restarts []Restart
+}
+
+type tomlEntry struct {
+	config Config
+	// start and end are the lines of the key/value pair, valueAt the offset
+	// of the value on the first one.
+	start, end int
+	valueAt    int
+	// comment is the text following the value on the last line.
+	comment string
+}
+
+type tomlTable struct {
+	profile, domain string
+	// start is the line of the header and end the last line of its entries.
+	start, end int
+}
+
+// ParseTOMLDocument parses the content of a TOML configuration file. Syntax
+// errors, entries outside a domain table and values that do not match their
+// type are returned as errors naming their line.
+func ParseTOMLDocument(content string) (*TOMLDocument, error) {
+	var data map[string]any
+	if _, err := toml.Decode(content, &data); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &LineError{Line: parseErr.Position.Line, Err: errors.New(parseErr.Message)}
+		}
+		return nil, err
+	}
+
+	doc := &TOMLDocument{lines: strings.Split(content, "\n")}
+	statements, err := scanTOML(doc.lines)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	var table *tomlTable
+	invalidTable := false
+	for _, statement := range statements {
+		line := statement.start + 1
+		if statement.header {
+			table = nil
+			profile, domain, ok := tomlTableName(statement.path)
+			invalidTable = !ok
+			if invalidTable {
+				errs = append(errs, &LineError{Line: line, Err: fmt.Errorf("table [%s] must name a domain or profiles.<profile>.<domain>, quote domains that contain dots", strings.Join(statement.path, "."))})
+				continue
+			}
+			table = &tomlTable{profile: profile, domain: domain, start: statement.start, end: statement.end}
+			doc.tables = append(doc.tables, table)
+			continue
+		}
+		if invalidTable {
+			continue
+		}
+		if table == nil && len(statement.path) == 1 && statement.path[0] == includeKeyword {
+			if err := doc.parseIncludes(data[includeKeyword], line); err != nil {
+				errs = append(errs, &LineError{Line: line, Err: err})
+			}
+			continue
+		}
+		if table == nil && len(statement.path) == 1 && statement.path[0] == restartKeyword {
+			if err := doc.parseRestarts(data[restartKeyword], line); err != nil {
+				errs = append(errs, &LineError{Line: line, Err: err})
+			}
+			continue
+		}
+		if table == nil {
+			errs = append(errs, &LineError{Line: line, Err: fmt.Errorf("%s must be inside a [domain] table", strings.Join(statement.path, "."))})
+			continue
+		}
+		if len(statement.path) != 1 {
+			errs = append(errs, &LineError{Line: line, Err: fmt.Errorf("dotted key %s is not supported, quote keys that contain dots", strings.Join(statement.path, "."))})
+			continue
+		}
+		table.end = statement.end
+		domain, key := table.domain, statement.path[0]
+		keys := data
+		if table.profile != "" {
+			keys = keys[profilesKey].(map[string]any)[table.profile].(map[string]any)
+		}
+		cfg, err := parseTOMLEntry(domain, key, keys[domain].(map[string]any)[key])
+		if err != nil {
+			errs = append(errs, &LineError{Line: line, Err: fmt.Errorf("%s %s: %w", domain, key, err)})
+			continue
+		}
+		cfg.Profile = table.profile
+		cfg.Line = line
+		comment := doc.lines[statement.end][statement.commentAt:]
+		cfg.Comment = commentText(comment)
+		doc.entries = append(doc.entries, &tomlEntry{
+			config:  cfg,
+			start:   statement.start,
+			end:     statement.end,
+			valueAt: statement.valueAt,
+			comment: comment,
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// parseIncludes reads the top-level include key, a path or an array of paths.
+func (d *TOMLDocument) parseIncludes(raw any, line int) error {
+	patterns, ok := raw.([]any)
+	if !ok {
+		patterns = []any{raw}
+	}
+	for _, pattern := range patterns {
+		path, ok := pattern.(string)
+		if !ok {
+			return errors.New("include takes a path or an array of paths")
+		}
+		d.includes = append(d.includes, Include{Pattern: path, Line: line, Position: len(d.entries)})
+	}
+	return nil
+}
+
+// Includes returns the paths of the top-level include key.
+func (d *TOMLDocument) Includes() []Include {
+	return d.includes
+}
+
+// parseRestarts reads the top-level restart key, an inline table from domains
+// to a process or an array of processes.
+func (d *TOMLDocument) parseRestarts(raw any, line int) error {
+	domains, ok := raw.(map[string]any)
+	if !ok {
+		return errors.New("restart takes an inline table from domains to processes")
+	}
+	names := make([]string, 0, len(domains))
+	for domain := range domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+	for _, domain := range names {
+		values, ok := domains[domain].([]any)
+		if !ok {
+			values = []any{domains[domain]}
+		}
+		restart := Restart{Domain: domain, Processes: []string{}, Line: line}
+		for _, value := range values {
+			process, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("restart %s: expected a process or an array of processes", domain)
+			}
+			restart.Processes = append(restart.Processes, process)
+		}
+		d.restarts = append(d.restarts, restart)
+	}
+	return nil
+}
+
+// Restarts returns the directives of the top-level restart key.
+func (d *TOMLDocument) Restarts() []Restart {
+	return d.restarts
+}
+
+// tomlTableName returns the profile and domain a table header names: a domain
+// for the shared base, or profiles.<profile>.<domain>.
+func tomlTableName(path []string) (profile, domain string, ok bool) {
+	switch {
+	case len(path) == 1 && path[0] != profilesKey:
+		return "", path[0], true
+	case len(path) == 3 && path[0] == profilesKey:
+		return path[1], path[2], true
+	}
+	return "", "", false
+}
+
+// tomlSettingFields are the fields of a table that sets the type of a value.
+var tomlSettingFields = map[string]bool{"value": true, "type": true, "absent": true, "host": true, "system": true}
+
+func isTOMLSettings(table map[string]any) bool {
+	if len(table) == 0 {
+		return false
+	}
+	for field := range table {
+		if !tomlSettingFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTOMLEntry(domain, key string, raw any) (Config, error) {
+	cfg := Config{Domain: domain, Key: key}
+	declared := ""
+	if settings, ok := raw.(map[string]any); ok && isTOMLSettings(settings) {
+		if absent, ok := settings["absent"]; ok {
+			if cfg.Absent, ok = absent.(bool); !ok {
+				return Config{}, errors.New("absent must be true or false")
+			}
+		}
+		if valueType, ok := settings["type"]; ok {
+			if declared, ok = valueType.(string); !ok || declared == "" {
+				return Config{}, errors.New("type must be a type name")
+			}
+		}
+		if host, ok := settings["host"]; ok {
+			if cfg.Host, ok = host.(string); !ok || cfg.Host == "" {
+				return Config{}, errors.New("host must be currentHost or a host name")
+			}
+		}
+		if system, ok := settings["system"]; ok {
+			if cfg.System, ok = system.(bool); !ok {
+				return Config{}, errors.New("system must be true or false")
+			}
+		}
+		if err := validateScope(cfg); err != nil {
+			return Config{}, err
+		}
+		raw = settings["value"]
+		if cfg.Absent {
+			if raw != nil || declared != "" {
+				return Config{}, errAbsentValue
+			}
+			return cfg, nil
+		}
+		if raw == nil {
+			return Config{}, errors.New("missing value")
+		}
+	}
+
+	value, valueType, err := tomlToValue(raw, declared)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Value = &value
+	cfg.Type = valueType
+	cfg.Structured = ParseStructured(value, valueType)
+	return cfg, nil
+}
+
+// tomlToValue converts a decoded TOML value into the text of a configuration
+// value. The type is inferred from the TOML type unless declared is set, in
+// which case the value has to match it; a type defaults does not know takes a
+// string, as formatTOMLValue writes it.
+func tomlToValue(raw any, declared string) (string, string, error) {
+	inferred := tomlTypeOf(raw)
+	valueType := declared
+	if valueType == "" {
+		valueType = inferred
+	}
+	switch base := BaseType(valueType); {
+	case base == inferred:
+	case base == "float" && inferred == "integer":
+	case base == "data" && inferred == "string":
+		if _, err := hex.DecodeString(raw.(string)); err != nil {
+			return "", "", fmt.Errorf("data value %q is not hexadecimal", raw)
+		}
+	case !isDefaultsType(base) && inferred == "string":
+		// Like the other formats, keep the text of a type defaults does
+		// not know; lint reports it.
+	case !isDefaultsType(base):
+		return "", "", fmt.Errorf("unknown type %q takes a string value", declared)
+	default:
+		return "", "", fmt.Errorf("%s value %s does not match type %s", inferred, tomlText(raw), declared)
+	}
+
+	switch v := raw.(type) {
+	case []any, map[string]any:
+		return plist.FormatText(tomlToPlist(v)), valueType, nil
+	case string:
+		return v, valueType, nil
+	}
+	return tomlText(raw), valueType, nil
+}
+
+func isDefaultsType(valueType string) bool {
+	switch valueType {
+	case "string", "data", "integer", "float", "boolean", "date", "array", "dict":
+		return true
+	}
+	return false
+}
+
+// tomlTypeOf returns the defaults type matching a decoded TOML value.
+func tomlTypeOf(raw any) string {
+	switch raw.(type) {
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case time.Time:
+		return "date"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "dict"
+	}
+	return "string"
+}
+
+// tomlText returns the text of a decoded TOML scalar as it is stored in a
+// configuration value.
+func tomlText(raw any) string {
+	switch v := raw.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(dateLayouts[0])
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(raw)
+}
+
+func tomlToPlist(raw any) *plist.Value {
+	switch v := raw.(type) {
+	case []any:
+		array := plist.NewArray()
+		for _, element := range v {
+			array.Array = append(array.Array, tomlToPlist(element))
+		}
+		return array
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := plist.NewDict()
+		for _, key := range keys {
+			dict.Dict = append(dict.Dict, plist.DictEntry{Key: key, Value: tomlToPlist(v[key])})
+		}
+		return dict
+	case bool:
+		// defaults prints booleans inside arrays and dicts as 1 and 0.
+		if v {
+			return plist.NewString("1")
+		}
+		return plist.NewString("0")
+	case string:
+		return plist.NewString(v)
+	}
+	return plist.NewString(tomlText(raw))
+}
+
+func (d *TOMLDocument) Configs() []Config {
+	configs := []Config{}
+	for _, entry := range d.entries {
+		configs = append(configs, entry.config)
+	}
+	return configs
+}
+
+// Update sets the value and type of every entry in configs. Lines whose value
+// is already up to date are left untouched, and updated lines keep their
+// trailing comment but lose the marker added by Mark. Absent entries are left
+// alone. Entries that are not in the document yet are appended to their
+// domain's table.
+func (d *TOMLDocument) Update(configs []Config) {
+	for _, cfg := range configs {
+		if cfg.Value == nil {
+			continue
+		}
+		found := false
+		for _, entry := range d.entries {
+			if !sameEntry(entry.config, cfg) {
+				continue
+			}
+			found = true
+			if entry.config.Absent {
+				continue
+			}
+			d.setComment(entry, stripMarker(entry.comment))
+			current := entry.config
+			if current.Type == configType(cfg) && ValuesEqual(current.Type, *current.Value, *cfg.Value) {
+				continue
+			}
+			d.setEntry(entry, cfg)
+		}
+		if !found {
+			d.appendEntry(cfg)
+		}
+	}
+}
+
+// AppendMissing appends the entries of configs whose domain and key are not in
+// the document yet and returns them.
+func (d *TOMLDocument) AppendMissing(configs []Config) []Config {
+	var appended []Config
+	for _, cfg := range configs {
+		if (cfg.Value == nil && !cfg.Absent) || d.has(cfg) {
+			continue
+		}
+		d.appendEntry(cfg)
+		appended = append(appended, cfg)
+	}
+	return appended
+}
+
+// Mark adds a "# mdefaults: note" comment to the entries for the profile,
+// domain and key of cfg, replacing an earlier marker.
+func (d *TOMLDocument) Mark(cfg Config, note string) {
+	for _, entry := range d.entries {
+		if !sameEntry(entry.config, cfg) {
+			continue
+		}
+		comment := stripMarker(entry.comment)
+		cr := ""
+		if strings.HasSuffix(comment, "\r") {
+			comment, cr = strings.TrimSuffix(comment, "\r"), "\r"
+		}
+		d.setComment(entry, comment+" "+markerPrefix+note+cr)
+	}
+}
+
+// String renders the document back to the content of a configuration file.
+func (d *TOMLDocument) String() string {
+	return strings.Join(d.lines, "\n")
+}
+
+func (d *TOMLDocument) has(cfg Config) bool {
+	for _, entry := range d.entries {
+		if sameEntry(entry.config, cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *TOMLDocument) setComment(entry *tomlEntry, comment string) {
+	if comment == entry.comment {
+		return
+	}
+	line := d.lines[entry.end]
+	d.lines[entry.end] = line[:len(line)-len(entry.comment)] + comment
+	entry.comment = comment
+}
+
+// setEntry replaces the value of entry with the one of cfg, keeping the key as
+// it is written and the trailing comment.
+func (d *TOMLDocument) setEntry(entry *tomlEntry, cfg Config) {
+	line := d.lines[entry.start][:entry.valueAt] + formatTOMLValue(cfg) + entry.comment
+	d.splice(entry.start, entry.end-entry.start+1, []string{line})
+	entry.end = entry.start
+	comment := entry.config.Comment
+	entry.config = copyConfig(cfg)
+	entry.config.Comment = comment
+}
+
+// appendEntry adds cfg after the last entry of the table for its profile and
+// domain, adding the table at the end of the document when needed.
+func (d *TOMLDocument) appendEntry(cfg Config) {
+	comment := ""
+	if cfg.Comment != "" {
+		comment = " # " + cfg.Comment
+	}
+	key := formatTOMLKey(cfg.Key)
+	line := key + " = " + formatTOMLValue(cfg) + comment
+	entry := &tomlEntry{config: copyConfig(cfg), valueAt: len(key) + 3, comment: comment}
+
+	var table *tomlTable
+	for _, t := range d.tables {
+		if t.profile == cfg.Profile && t.domain == cfg.Domain {
+			table = t
+		}
+	}
+	if table != nil {
+		entry.start = table.end + 1
+		d.splice(entry.start, 0, []string{line})
+	} else {
+		// Keep the final line break, if any, at the end of the file.
+		at := len(d.lines)
+		if d.lines[at-1] == "" {
+			at--
+		}
+		var added []string
+		if strings.TrimSpace(strings.Join(d.lines[:at], "")) != "" {
+			added = append(added, "")
+		}
+		header := formatTOMLKey(cfg.Domain)
+		if cfg.Profile != "" {
+			header = profilesKey + "." + formatTOMLKey(cfg.Profile) + "." + header
+		}
+		added = append(added, "["+header+"]", line)
+		d.splice(at, 0, added)
+		entry.start = at + len(added) - 1
+		table = &tomlTable{profile: cfg.Profile, domain: cfg.Domain, start: entry.start - 1}
+		d.tables = append(d.tables, table)
+	}
+	entry.end = entry.start
+	table.end = entry.end
+	d.entries = append(d.entries, entry)
+}
+
+// appendRestarts writes the directives as the top-level restart key, on the
+// first line of the document so that it precedes every table. It is meant for
+// documents without a restart key, such as the ones NewDocument creates. A
+// domain given more than once keeps its last directive.
+func (d *TOMLDocument) appendRestarts(restarts []Restart) {
+	fields := []string{}
+	for _, restart := range lastRestarts(restarts) {
+		processes := make([]string, 0, len(restart.Processes))
+		for _, process := range restart.Processes {
+			processes = append(processes, formatTOMLString(process))
+		}
+		value := "[" + strings.Join(processes, ", ") + "]"
+		if len(processes) == 1 {
+			value = processes[0]
+		}
+		fields = append(fields, formatTOMLKey(restart.Domain)+" = "+value)
+		restart.Line = 1
+		d.restarts = append(d.restarts, restart)
+	}
+	d.splice(0, 0, []string{restartKeyword + " = { " + strings.Join(fields, ", ") + " }"})
+}
+
+// splice replaces remove lines at index at with lines, moving the entries and
+// tables that follow.
+func (d *TOMLDocument) splice(at, remove int, lines []string) {
+	d.lines = append(d.lines[:at], append(lines, d.lines[at+remove:]...)...)
+	shift := func(line *int) {
+		if *line >= at+remove {
+			*line += len(lines) - remove
+		}
+	}
+	for _, entry := range d.entries {
+		shift(&entry.start)
+		shift(&entry.end)
+	}
+	for _, table := range d.tables {
+		shift(&table.start)
+		shift(&table.end)
+	}
+}
+
+// copyConfig returns cfg with a copy of its value and its type filled in.
+func copyConfig(cfg Config) Config {
+	if cfg.Value != nil {
+		value := *cfg.Value
+		cfg.Value = &value
+		cfg.Type = configType(cfg)
+	}
+	return cfg
+}
+
+// formatTOMLValue renders the value of cfg. Values whose TOML type does not
+// imply their defaults type are written with an explicit type, and entries of
+// ByHost or system-wide preferences with their scope.
+func formatTOMLValue(cfg Config) string {
+	scope := ""
+	switch {
+	case cfg.System:
+		scope = ", system = true"
+	case cfg.Host != "":
+		scope = ", host = " + formatTOMLString(cfg.Host)
+	}
+	if cfg.Absent {
+		return "{ absent = true" + scope + " }"
+	}
+	valueType := configType(cfg)
+	value, implied := tomlValueText(*cfg.Value, valueType)
+	switch {
+	case implied && scope == "":
+		return value
+	case implied:
+		return "{ value = " + value + scope + " }"
+	}
+	return "{ value = " + value + ", type = " + formatTOMLString(valueType) + scope + " }"
+}
+
+// tomlValueText renders value as TOML and reports whether its TOML type
+// implies valueType. Values that cannot be converted to the TOML type of
+// valueType are written as strings.
+func tomlValueText(value, valueType string) (string, bool) {
+	switch valueType {
+	case "boolean":
+		if b, ok := parseBool(value); ok {
+			return strconv.FormatBool(b), true
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return formatTOMLFloat(f), true
+		}
+	case "date":
+		if t, ok := parseDate(value); ok {
+			return t.Format(time.RFC3339), true
+		}
+	case "string":
+		return formatTOMLString(value), true
+	case "array", "array-add", "dict", "dict-add":
+		if tree, err := plist.ParseText(value); err == nil && tree.IsContainer() {
+			return plistToTOML(tree), valueType == "array"
+		}
+	}
+	return formatTOMLString(value), false
+}
+
+func plistToTOML(v *plist.Value) string {
+	switch v.Type {
+	case "array":
+		elements := make([]string, len(v.Array))
+		for i, element := range v.Array {
+			elements[i] = plistToTOML(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case "dict":
+		if len(v.Dict) == 0 {
+			return "{}"
+		}
+		entries := make([]string, len(v.Dict))
+		for i, entry := range v.Dict {
+			entries[i] = formatTOMLKey(entry.Key) + " = " + plistToTOML(entry.Value)
+		}
+		return "{ " + strings.Join(entries, ", ") + " }"
+	}
+	return formatTOMLString(v.Scalar)
+}
+
+func formatTOMLFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".en") {
+		s += ".0"
+	}
+	return s
+}
+
+// formatTOMLKey returns key as a bare key when possible and quoted otherwise.
+func formatTOMLKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return formatTOMLString(key)
+		}
+	}
+	return key
+}
+
+// formatTOMLString returns s as a TOML basic string.
+func formatTOMLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
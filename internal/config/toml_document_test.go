@@ -0,0 +1,300 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sampleTOMLDocument = `# Dock
+["com.apple.dock"]
+autohide = true  # hide the dock
+tilesize = 48
+persistent-others = [
+  "a", # first
+  "b",
+]
+wvous-tl-modifier = { value = 0, type = "float" }
+mru-spaces = { absent = true }
+
+["com.apple.finder"]
+FXInfoPanesExpanded = { General = 1, Preview = false }
+LastOpened = 2024-01-02T03:04:05Z
+"key.with.dots" = { value = "0a0b", type = "data" }
+`
+
+func TestTOMLDocument_Configs(t *testing.T) {
+	doc, err := ParseTOMLDocument(sampleTOMLDocument)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean", Comment: "hide the dock"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(a, b)"), Type: "array"},
+		{Domain: "com.apple.dock", Key: "wvous-tl-modifier", Value: stringPtr("0"), Type: "float"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+		{Domain: "com.apple.finder", Key: "FXInfoPanesExpanded", Value: stringPtr("{General = 1; Preview = 0;}"), Type: "dict"},
+		{Domain: "com.apple.finder", Key: "LastOpened", Value: stringPtr("2024-01-02 03:04:05 +0000"), Type: "date"},
+		{Domain: "com.apple.finder", Key: "key.with.dots", Value: stringPtr("0a0b"), Type: "data"},
+	}
+	configs := doc.Configs()
+	if len(configs) != len(expected) {
+		t.Fatalf("Expected %d configs, got %d", len(expected), len(configs))
+	}
+	for i, want := range expected {
+		got := configs[i]
+		if got.Domain != want.Domain || got.Key != want.Key || got.Type != want.Type ||
+			got.Absent != want.Absent || got.Comment != want.Comment || (got.Value == nil) != (want.Value == nil) ||
+			(got.Value != nil && *got.Value != *want.Value) {
+			t.Errorf("Config mismatch at index %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestTOMLDocument_UnmodifiedRoundTrip(t *testing.T) {
+	doc, err := ParseTOMLDocument(sampleTOMLDocument)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rendered := doc.String(); rendered != sampleTOMLDocument {
+		t.Errorf("Expected document to round trip, got %q", rendered)
+	}
+}
+
+func TestTOMLDocument_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		lines   []int
+		message string
+	}{
+		{"syntax error", "[\"d\"]\nx =\n", []int{2}, "expected value"},
+		{"unquoted domain", "[com.apple.dock]\nautohide = true\n", []int{1}, "must name a domain"},
+		{"key outside a table", "autohide = true\n", []int{1}, "must be inside a [domain] table"},
+		{"dotted key", "[\"d\"]\na.b = 1\n", []int{2}, "dotted key"},
+		{"array of tables", "[[\"d\"]]\na = 1\n", []int{1}, "arrays of tables"},
+		{"type mismatch", "[\"d\"]\nok = 1\nx = { value = 1.5, type = \"integer\" }\ny = { value = \"yes\", type = \"boolean\" }\n", []int{3, 4}, "does not match type"},
+		{"invalid data", "[\"d\"]\nx = { value = \"zz\", type = \"data\" }\n", []int{2}, "not hexadecimal"},
+		{"unknown type", "[\"d\"]\nx = { value = 1, type = \"number\" }\n", []int{2}, "takes a string value"},
+		{"absent with value", "[\"d\"]\nx = { value = 1, absent = true }\n", []int{2}, errAbsentValue.Error()},
+		{"missing value", "[\"d\"]\nx = { type = \"integer\" }\n", []int{2}, "missing value"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseTOMLDocument(tc.content)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.message) {
+				t.Errorf("Expected error to contain %q, got %v", tc.message, err)
+			}
+			var errs []error
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			} else {
+				errs = []error{err}
+			}
+			if len(errs) != len(tc.lines) {
+				t.Fatalf("Expected %d errors, got %v", len(tc.lines), err)
+			}
+			for i, err := range errs {
+				var lineErr *LineError
+				if !errors.As(err, &lineErr) || lineErr.Line != tc.lines[i] {
+					t.Errorf("Expected an error on line %d, got %v", tc.lines[i], err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadDocument_TOMLErrorNamesFileAndLine(t *testing.T) {
+	fs := &MockFileSystem{ConfigFileContent: "[\"d\"]\nx = { value = 1.5, type = \"integer\" }\n"}
+
+	_, err := ReadDocument(fs, "/home/me/.mdefaults.toml")
+	expected := "/home/me/.mdefaults.toml:2: d x: float value 1.5 does not match type integer"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, err)
+	}
+}
+
+func TestTOMLDocument_Update(t *testing.T) {
+	doc, err := ParseTOMLDocument(sampleTOMLDocument)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr(`(x, "y z")`), Type: "array"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "orientation", Value: stringPtr("left"), Type: "string"},
+		{Domain: "com.example.app", Key: "Ratio", Value: stringPtr("2"), Type: "float"},
+	})
+
+	expected := `# Dock
+["com.apple.dock"]
+autohide = true  # hide the dock
+tilesize = 64
+persistent-others = ["x", "y z"]
+wvous-tl-modifier = { value = 0, type = "float" }
+mru-spaces = { absent = true }
+orientation = "left"
+
+["com.apple.finder"]
+FXInfoPanesExpanded = { General = 1, Preview = false }
+LastOpened = 2024-01-02T03:04:05Z
+"key.with.dots" = { value = "0a0b", type = "data" }
+
+["com.example.app"]
+Ratio = 2.0
+`
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected content:\n%s\nGot content:\n%s", expected, rendered)
+	}
+	if _, err := ParseTOMLDocument(doc.String()); err != nil {
+		t.Errorf("Expected the updated document to parse, got %v", err)
+	}
+}
+
+func TestTOMLDocument_Mark(t *testing.T) {
+	doc, err := ParseTOMLDocument("[\"com.apple.dock\"]\nautohide = true  # hide the dock\r\ntilesize = 48\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "autohide"}, "not pulled, key absent")
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "tilesize"}, "not pulled, domain absent")
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "tilesize"}, "not pulled, timed out")
+
+	expected := "[\"com.apple.dock\"]\nautohide = true  # hide the dock # mdefaults: not pulled, key absent\r\n" +
+		"tilesize = 48 # mdefaults: not pulled, timed out\n"
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+
+	reparsed, err := ParseTOMLDocument(expected)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reparsed.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("36"), Type: "integer"},
+	})
+	expected = "[\"com.apple.dock\"]\nautohide = true  # hide the dock\r\ntilesize = 36\n"
+	if rendered := reparsed.String(); rendered != expected {
+		t.Errorf("Expected Update to remove the markers, got %q", rendered)
+	}
+}
+
+func TestNewDocument_TOML(t *testing.T) {
+	configs := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean", Comment: "hide the dock"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+		{Domain: "com.apple.finder", Key: "FXInfoPanesExpanded", Value: stringPtr("{General = 1;}"), Type: "dict"},
+		{Domain: "com.apple.finder", Key: "Label", Value: stringPtr("say \"hi\""), Type: ""},
+		{Domain: "com.apple.finder", Key: "Tags", Value: stringPtr("(a)"), Type: "array-add"},
+		{Domain: "com.apple.finder", Key: "Broken", Value: stringPtr("abc"), Type: "integer"},
+	}
+
+	doc, err := NewDocument(TOMLFormat, configs, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `["com.apple.dock"]
+autohide = true # hide the dock
+mru-spaces = { absent = true }
+
+["com.apple.finder"]
+FXInfoPanesExpanded = { value = { General = "1" }, type = "dict" }
+Label = "say \"hi\""
+Tags = { value = ["a"], type = "array-add" }
+Broken = { value = "abc", type = "integer" }
+`
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected content:\n%s\nGot content:\n%s", expected, rendered)
+	}
+}
+
+func TestNewDocument_TOMLReparses(t *testing.T) {
+	configs := []Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+		{Domain: "com.apple.finder", Key: "Tags", Value: stringPtr("(a, b)"), Type: "array-add"},
+		{Domain: "com.example.app", Key: "Size", Value: stringPtr("12"), Type: "number"},
+		{Domain: "com.example.app", Key: "Name", Value: stringPtr("x"), Type: "text", Host: CurrentHost},
+	}
+
+	doc, err := NewDocument(TOMLFormat, configs, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	parsed, err := ParseTOMLDocument(doc.String())
+	if err != nil {
+		t.Fatalf("Expected the written document to parse, got %v\n%s", err, doc.String())
+	}
+	if invalid := InvalidEntries(parsed); len(invalid) != 0 {
+		t.Fatalf("Expected no invalid entries, got %v\n%s", invalid, doc.String())
+	}
+	reparsed := parsed.Configs()
+	if len(reparsed) != len(configs) {
+		t.Fatalf("Expected %d entries, got %+v", len(configs), reparsed)
+	}
+	for i, cfg := range configs {
+		got := reparsed[i]
+		if got.Key != cfg.Key || got.Absent != cfg.Absent || got.Host != cfg.Host {
+			t.Errorf("Expected %+v, got %+v", cfg, got)
+			continue
+		}
+		if cfg.Absent {
+			continue
+		}
+		if got.Type != cfg.Type || !ValuesEqual(got.Type, *got.Value, *cfg.Value) {
+			t.Errorf("Expected %s %s, got %s %s", *cfg.Value, cfg.Type, *got.Value, got.Type)
+		}
+	}
+}
+
+func TestTOMLDocument_Profiles(t *testing.T) {
+	content := `["com.apple.dock"]
+autohide = false
+
+[profiles.presentation."com.apple.dock"]
+autohide = true
+`
+	doc, err := ParseTOMLDocument(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	configs := doc.Configs()
+	if len(configs) != 2 || configs[0].Profile != "" || configs[1].Profile != "presentation" || *configs[1].Value != "true" {
+		t.Fatalf("Expected a base and a presentation entry, got %+v", configs)
+	}
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("0"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("36"), Type: "integer", Profile: "work"},
+	})
+	expected := `["com.apple.dock"]
+autohide = false
+
+[profiles.presentation."com.apple.dock"]
+autohide = false
+tilesize = 64
+
+[profiles.work."com.apple.dock"]
+tilesize = 36
+`
+	if rendered := doc.String(); rendered != expected {
+		t.Errorf("Expected content:\n%s\nGot content:\n%s", expected, rendered)
+	}
+
+	if _, err := ParseTOMLDocument("[profiles.presentation]\nx = 1\n"); err == nil {
+		t.Error("Expected a profile table without a domain to be an error, got nil")
+	}
+}
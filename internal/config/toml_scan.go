@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlStatement is a table header or a key/value pair of a TOML file, located
+// by line so that it can be edited in place. Line numbers are 0-based.
+type tomlStatement struct {
+	header bool
+	path   []string
+	// start and end are the first and last line of the statement.
+	start, end int
+	// valueAt is the offset of the value on the start line, and commentAt the
+	// offset of the text following the value on the end line. Both are only
+	// set for key/value pairs.
+	valueAt, commentAt int
+}
+
+// scanTOML locates the table headers and key/value pairs of content, which
+// must already be known to be valid TOML.
+func scanTOML(lines []string) ([]tomlStatement, error) {
+	var statements []tomlStatement
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		at := skipTOMLSpace(line, 0)
+		if at == len(line) || line[at] == '#' {
+			continue
+		}
+		if line[at] == '[' {
+			if strings.HasPrefix(line[at:], "[[") {
+				return nil, &LineError{Line: i + 1, Err: errors.New("arrays of tables are not supported")}
+			}
+			path, _, err := scanTOMLKey(line, at+1)
+			if err != nil {
+				return nil, &LineError{Line: i + 1, Err: err}
+			}
+			statements = append(statements, tomlStatement{header: true, path: path, start: i, end: i})
+			continue
+		}
+		path, next, err := scanTOMLKey(line, at)
+		if err != nil {
+			return nil, &LineError{Line: i + 1, Err: err}
+		}
+		next = skipTOMLSpace(line, next)
+		if next == len(line) || line[next] != '=' {
+			return nil, &LineError{Line: i + 1, Err: errors.New("expected = after the key")}
+		}
+		valueAt := skipTOMLSpace(line, next+1)
+		end, commentAt := scanTOMLValue(lines, i, valueAt)
+		statements = append(statements, tomlStatement{path: path, start: i, end: end, valueAt: valueAt, commentAt: commentAt})
+		i = end
+	}
+	return statements, nil
+}
+
+func skipTOMLSpace(line string, at int) int {
+	for at < len(line) && (line[at] == ' ' || line[at] == '\t' || line[at] == '\r') {
+		at++
+	}
+	return at
+}
+
+// scanTOMLKey reads a dotted key starting at offset at and returns its parts
+// and the offset following it.
+func scanTOMLKey(line string, at int) ([]string, int, error) {
+	var path []string
+	for {
+		at = skipTOMLSpace(line, at)
+		if at == len(line) {
+			return nil, at, errors.New("missing key")
+		}
+		var part string
+		switch line[at] {
+		case '"':
+			end := at + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, at, errors.New("unterminated key")
+			}
+			unquoted, err := strconv.Unquote(line[at : end+1])
+			if err != nil {
+				return nil, at, fmt.Errorf("invalid key %s", line[at:end+1])
+			}
+			part, at = unquoted, end+1
+		case '\'':
+			end := strings.IndexByte(line[at+1:], '\'')
+			if end < 0 {
+				return nil, at, errors.New("unterminated key")
+			}
+			part, at = line[at+1:at+1+end], at+end+2
+		default:
+			end := at
+			for end < len(line) && isBareKeyChar(line[end]) {
+				end++
+			}
+			if end == at {
+				return nil, at, fmt.Errorf("unexpected %q in key", line[at])
+			}
+			part, at = line[at:end], end
+		}
+		path = append(path, part)
+		at = skipTOMLSpace(line, at)
+		if at == len(line) || line[at] != '.' {
+			return path, at, nil
+		}
+		at++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// scanTOMLValue skips the value starting at offset at of line start. It
+// returns the last line of the value and the offset on that line where the
+// text following the value, such as a comment, begins.
+func scanTOMLValue(lines []string, start, at int) (int, int) {
+	depth := 0
+	quote := ""
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		for ; at < len(line); at++ {
+			if quote != "" {
+				switch {
+				case line[at] == '\\' && quote[0] == '"':
+					at++
+				case strings.HasPrefix(line[at:], quote):
+					at += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+			switch line[at] {
+			case '"', '\'':
+				quote = line[at : at+1]
+				if strings.HasPrefix(line[at:], strings.Repeat(quote, 3)) {
+					quote = strings.Repeat(quote, 3)
+					at += 2
+				}
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+			case '#':
+				if depth == 0 {
+					return i, trimTOMLValueEnd(line, at)
+				}
+				at = len(line)
+			}
+		}
+		if depth == 0 && quote == "" {
+			return i, trimTOMLValueEnd(line, len(line))
+		}
+		at = 0
+	}
+	return len(lines) - 1, len(lines[len(lines)-1])
+}
+
+// trimTOMLValueEnd moves end back over the whitespace in front of it, so that
+// the text following a value keeps its leading spaces.
+func trimTOMLValueEnd(line string, end int) int {
+	for end > 0 && (line[end-1] == ' ' || line[end-1] == '\t' || line[end-1] == '\r') {
+		end--
+	}
+	return end
+}
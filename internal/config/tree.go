@@ -0,0 +1,315 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includeKeyword starts an include directive.
+const includeKeyword = "include"
+
+// Include is an include directive of a configuration file.
+type Include struct {
+	// Pattern is the file, glob or directory to include, as written. Relative
+	// paths are relative to the including file.
+	Pattern string
+	Line    int
+	// Profile is the profile section the directive is in. Included entries
+	// of the shared base become entries of that profile.
+	Profile string
+	// Position is the number of entries of the file before the directive.
+	Position int
+}
+
+// includer is implemented by documents that can include other files.
+type includer interface {
+	Includes() []Include
+}
+
+// DirReader is implemented by file systems that can list the files of a
+// directory. Includes naming a directory or a glob need it.
+type DirReader interface {
+	ReadDir(name string) ([]string, error)
+}
+
+// HomeDirReader is implemented by file systems that know the home directory.
+// Includes starting with ~ need it.
+type HomeDirReader interface {
+	UserHomeDir() (string, error)
+}
+
+// File is a configuration file read as part of a Tree.
+type File struct {
+	Path string
+	Doc  Document
+	// content is what was read, to tell whether the document changed.
+	content string
+}
+
+// Tree is a configuration file together with the files it includes.
+type Tree struct {
+	// Files holds the main file first, followed by the included files in
+	// the order they are read.
+	Files   []*File
+	configs []Config
+	// restarts holds the restart directives in the order they apply.
+	restarts []Restart
+}
+
+// LoadTree reads the configuration file at path and the files it includes.
+// Include directives are expanded in place, and an entry replaces the entries
+// for the same profile, domain and key that earlier files gave. Each entry
+// records the file it came from in its Source. Every file is read once;
+// including a file that is still being read is an error.
+func LoadTree(fs FileSystemReader, path string) (*Tree, error) {
+	loader := &treeLoader{fs: fs, tree: &Tree{}, loaded: map[string]bool{}}
+	configs, err := loader.load(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	loader.tree.configs = mergeConfigs(configs)
+	return loader.tree, nil
+}
+
+type treeLoader struct {
+	fs     FileSystemReader
+	tree   *Tree
+	loaded map[string]bool
+}
+
+// load reads path and returns its entries with the included ones expanded.
+// stack holds the files that include it.
+func (l *treeLoader) load(path string, stack []string) ([]Config, error) {
+	path = filepath.Clean(path)
+	for _, including := range stack {
+		if including == path {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, path), " -> "))
+		}
+	}
+	if l.loaded[path] {
+		return nil, nil
+	}
+	l.loaded[path] = true
+
+	doc, err := ReadDocument(l.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	l.tree.Files = append(l.tree.Files, &File{Path: path, Doc: doc, content: doc.String()})
+
+	entries := doc.Configs()
+	for i := range entries {
+		entries[i].Source = path
+		entries[i].SourceProfile = entries[i].Profile
+	}
+	// The directives of the file are added once its includes are loaded, so
+	// that they override the included ones.
+	if r, ok := doc.(restarter); ok {
+		defer func() { l.tree.restarts = append(l.tree.restarts, r.Restarts()...) }()
+	}
+	inc, ok := doc.(includer)
+	if !ok {
+		return entries, nil
+	}
+	var configs []Config
+	next := 0
+	for _, include := range inc.Includes() {
+		configs = append(configs, entries[next:include.Position]...)
+		next = include.Position
+		included, err := l.include(path, include, append(stack, path))
+		if err != nil {
+			return nil, withPath(path, &LineError{Line: include.Line, Err: fmt.Errorf("include %s: %w", include.Pattern, err)})
+		}
+		configs = append(configs, included...)
+	}
+	return append(configs, entries[next:]...), nil
+}
+
+func (l *treeLoader) include(from string, include Include, stack []string) ([]Config, error) {
+	paths, err := l.expand(filepath.Dir(from), include.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	for _, path := range paths {
+		included, err := l.load(path, stack)
+		if err != nil {
+			return nil, err
+		}
+		for i := range included {
+			if included[i].Profile == "" {
+				included[i].Profile = include.Profile
+			}
+		}
+		configs = append(configs, included...)
+	}
+	return configs, nil
+}
+
+// expand returns the files an include pattern names: the file itself, the
+// files of a directory, or the files matching a glob in its last element,
+// sorted by name. Hidden files are left out of directories and globs.
+func (l *treeLoader) expand(dir, pattern string) ([]string, error) {
+	if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+		home, ok := l.fs.(HomeDirReader)
+		if !ok {
+			return nil, errors.New("~ is not supported by this file system")
+		}
+		homeDir, err := home.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		pattern = filepath.Join(homeDir, pattern[1:])
+	} else if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	lister, canList := l.fs.(DirReader)
+	hasMeta := strings.ContainsAny(filepath.Base(pattern), "*?[")
+	if !canList {
+		if hasMeta {
+			return nil, errors.New("globs are not supported by this file system")
+		}
+		return []string{pattern}, nil
+	}
+
+	if !hasMeta {
+		names, err := lister.ReadDir(pattern)
+		if err != nil {
+			// Not a directory; read it as a file.
+			return []string{pattern}, nil
+		}
+		return visibleFiles(pattern, names, "*"), nil
+	}
+	names, err := lister.ReadDir(filepath.Dir(pattern))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := filepath.Match(filepath.Base(pattern), ""); err != nil {
+		return nil, err
+	}
+	return visibleFiles(filepath.Dir(pattern), names, filepath.Base(pattern)), nil
+}
+
+func visibleFiles(dir string, names []string, pattern string) []string {
+	var paths []string
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// mergeConfigs lets entries override the entries for the same profile,
+// domain and key that come from other, earlier files. The overriding entry
+// takes the place of the first one it replaces.
+func mergeConfigs(configs []Config) []Config {
+	var merged []Config
+	for _, cfg := range configs {
+		replaced := false
+		kept := merged[:0]
+		for _, earlier := range merged {
+			if sameEntry(earlier, cfg) && earlier.Source != cfg.Source {
+				if !replaced {
+					kept = append(kept, cfg)
+					replaced = true
+				}
+				continue
+			}
+			kept = append(kept, earlier)
+		}
+		merged = kept
+		if !replaced {
+			merged = append(merged, cfg)
+		}
+	}
+	return merged
+}
+
+// Main returns the configuration file the tree was loaded from.
+func (t *Tree) Main() *File {
+	return t.Files[0]
+}
+
+// Configs returns the entries of all files, with overridden entries removed.
+func (t *Tree) Configs() []Config {
+	return append([]Config{}, t.configs...)
+}
+
+// file returns the file an entry came from, or the main file.
+func (t *Tree) file(source string) *File {
+	for _, f := range t.Files {
+		if f.Path == source {
+			return f
+		}
+	}
+	return t.Main()
+}
+
+// Update sets the values of configs in the files their entries came from.
+// Entries without a known source are added to the main file.
+func (t *Tree) Update(configs []Config) {
+	for _, cfg := range configs {
+		t.file(cfg.Source).Doc.Update([]Config{inSource(cfg)})
+	}
+}
+
+// Mark adds a marker to the entry of cfg in the file it came from.
+func (t *Tree) Mark(cfg Config, note string) {
+	t.file(cfg.Source).Doc.Mark(inSource(cfg), note)
+}
+
+// inSource returns cfg with the profile it has in the file it came from, so
+// that the entries of a file included in a profile section are found there.
+func inSource(cfg Config) Config {
+	if cfg.Source != "" {
+		cfg.Profile = cfg.SourceProfile
+	}
+	return cfg
+}
+
+// AppendMissing appends the entries of configs that no file of the tree
+// configures yet to the main file and returns them.
+func (t *Tree) AppendMissing(configs []Config) []Config {
+	var missing []Config
+	for _, cfg := range configs {
+		found := false
+		for _, existing := range t.configs {
+			if sameEntry(existing, cfg) {
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, cfg)
+		}
+	}
+	appended := t.Main().Doc.AppendMissing(missing)
+	for _, cfg := range appended {
+		cfg.Source = t.Main().Path
+		t.configs = append(t.configs, cfg)
+	}
+	return appended
+}
+
+// Write writes the files whose content changed since they were read.
+func (t *Tree) Write(fs FileSystemReader) error {
+	for _, f := range t.Files {
+		content := f.Doc.String()
+		if content == f.content {
+			continue
+		}
+		if err := fs.WriteFile(f.Path, content); err != nil {
+			return err
+		}
+		f.content = content
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadTree(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults": "com.apple.dock autohide 1 boolean\n" +
+			"include dotfiles/base.conf\n" +
+			"include conf.d\n" +
+			"com.apple.dock tilesize 64 integer\n" +
+			"[profile work]\n" +
+			"include work/*.conf\n",
+		"/home/me/dotfiles/base.conf":    "com.apple.dock autohide 0 boolean\ncom.apple.dock tilesize 48 integer\ncom.apple.finder ShowPathbar 1 boolean\n",
+		"/home/me/conf.d/10-finder":      "com.apple.finder ShowPathbar 0 boolean\n",
+		"/home/me/conf.d/.20-hidden":     "com.apple.finder Hidden 1 boolean\n",
+		"/home/me/work/mail.conf":        "com.apple.mail DisableInlineAttachmentViewing 1 boolean\n",
+		"/home/me/work/notes.txt":        "com.apple.notes Ignored 1 boolean\n",
+		"/home/me/dotfiles/unused.conf":  "com.example.unused key 1 boolean\n",
+		"/home/me/conf.d/30-screencap.y": "com.apple.screencapture type png string\n",
+	}}
+
+	tree, err := LoadTree(fs, "/home/me/.mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		"com.apple.dock autohide 0 boolean from /home/me/dotfiles/base.conf",
+		"com.apple.dock tilesize 64 integer from /home/me/.mdefaults",
+		"com.apple.finder ShowPathbar 0 boolean from /home/me/conf.d/10-finder",
+		"com.apple.screencapture type png string from /home/me/conf.d/30-screencap.y",
+		"work: com.apple.mail DisableInlineAttachmentViewing 1 boolean from /home/me/work/mail.conf",
+	}
+	var got []string
+	for _, cfg := range tree.Configs() {
+		line := FormatConfig(cfg) + " from " + cfg.Source
+		if cfg.Profile != "" {
+			line = cfg.Profile + ": " + line
+		}
+		got = append(got, line)
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if len(tree.Files) != 5 || tree.Main().Path != "/home/me/.mdefaults" {
+		t.Errorf("Expected the main file and 4 included files, got %d files", len(tree.Files))
+	}
+}
+
+func TestLoadTree_IncludeFromHome(t *testing.T) {
+	t.Setenv("HOME", "/elsewhere")
+	fs := &MockFileSystem{HomeDir: "/Users/me", Files: map[string]string{
+		"/etc/mdefaults":                  "include ~/dotfiles/mdefaults\n",
+		"/Users/me/dotfiles/mdefaults":    "com.apple.dock autohide 1 boolean\n",
+		"/elsewhere/dotfiles/mdefaults/x": "com.apple.dock autohide 0 boolean\n",
+	}}
+
+	tree, err := LoadTree(fs, "/etc/mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if configs := tree.Configs(); len(configs) != 1 || configs[0].Source != "/Users/me/dotfiles/mdefaults" {
+		t.Errorf("Expected the file in the home directory of the file system, got %+v", configs)
+	}
+}
+
+func TestLoadTree_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			"cycle",
+			map[string]string{
+				"/home/me/.mdefaults": "include a.conf\n",
+				"/home/me/a.conf":     "com.apple.dock autohide 1 boolean\ninclude .mdefaults\n",
+			},
+			"/home/me/.mdefaults:1: include a.conf: /home/me/a.conf:2: include .mdefaults: include cycle: /home/me/.mdefaults -> /home/me/a.conf -> /home/me/.mdefaults",
+		},
+		{
+			"missing file",
+			map[string]string{"/home/me/.mdefaults": "com.apple.dock autohide 1 boolean\ninclude missing.conf\n"},
+			"/home/me/.mdefaults:2: include missing.conf: file does not exist",
+		},
+		{
+			"invalid included file",
+			map[string]string{
+				"/home/me/.mdefaults": "include base.toml\n",
+				"/home/me/base.toml":  "[\"d\"]\nx = { value = 1.5, type = \"integer\" }\n",
+			},
+			"/home/me/.mdefaults:1: include base.toml: /home/me/base.toml:2: d x: float value 1.5 does not match type integer",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadTree(&MockFileSystem{Files: tc.files}, "/home/me/.mdefaults")
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("Expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadTree_ReadsDiamondIncludesOnce(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults":  "include a.conf\ninclude b.conf\n",
+		"/home/me/a.conf":      "include common.conf\n",
+		"/home/me/b.conf":      "include common.conf\n",
+		"/home/me/common.conf": "com.apple.dock autohide 1 boolean\n",
+	}}
+
+	tree, err := LoadTree(fs, "/home/me/.mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if configs := tree.Configs(); len(configs) != 1 {
+		t.Errorf("Expected 1 config, got %+v", configs)
+	}
+}
+
+func TestTree_UpdateWritesToSourceFiles(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults": "include base.conf\ncom.apple.dock tilesize 64 integer\n",
+		"/home/me/base.conf":  "com.apple.dock autohide 0 boolean\ncom.apple.finder ShowPathbar 1 boolean\n",
+	}}
+	tree, err := LoadTree(fs, "/home/me/.mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	configs := tree.Configs()
+	pulled := configs[0]
+	pulled.Value = stringPtr("1")
+	tree.Update([]Config{pulled})
+	tree.Mark(configs[2], "not pulled, key absent")
+	fs.WriteFileContent = ""
+	if err := tree.Write(fs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "com.apple.dock autohide 1 boolean\ncom.apple.finder ShowPathbar 1 boolean\n"
+	if content := fs.Files["/home/me/base.conf"]; content != expected {
+		t.Errorf("Expected base.conf to be updated to %q, got %q", expected, content)
+	}
+	expected = "include base.conf\ncom.apple.dock tilesize 64 integer # mdefaults: not pulled, key absent\n"
+	if content := fs.Files["/home/me/.mdefaults"]; content != expected {
+		t.Errorf("Expected .mdefaults to be marked as %q, got %q", expected, content)
+	}
+}
+
+func TestTree_UpdateFileIncludedInProfile(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults": "com.apple.dock tilesize 64 integer\n[profile work]\ninclude work.conf\n",
+		"/home/me/work.conf":  "com.apple.mail DisableInlineAttachmentViewing 1 boolean\ncom.apple.mail ConversationViewSortDescending 0 boolean\n",
+	}}
+	tree, err := LoadTree(fs, "/home/me/.mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	configs := tree.Configs()
+	if configs[1].Profile != "work" || configs[1].SourceProfile != "" {
+		t.Fatalf("Expected the included entry to belong to work without a profile in its file, got %+v", configs[1])
+	}
+	pulled := configs[1]
+	pulled.Value = stringPtr("0")
+	tree.Update([]Config{pulled})
+	tree.Mark(configs[2], "not pulled, key absent")
+	if err := tree.Write(fs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := "com.apple.mail DisableInlineAttachmentViewing 0 boolean\ncom.apple.mail ConversationViewSortDescending 0 boolean # mdefaults: not pulled, key absent\n"
+	if content := fs.Files["/home/me/work.conf"]; content != expected {
+		t.Errorf("Expected work.conf to be updated in place to %q, got %q", expected, content)
+	}
+	if content := fs.Files["/home/me/.mdefaults"]; content != "com.apple.dock tilesize 64 integer\n[profile work]\ninclude work.conf\n" {
+		t.Errorf("Expected .mdefaults to be left alone, got %q", content)
+	}
+}
+
+func TestTree_AppendMissingSkipsIncludedKeys(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults": "include base.conf\n",
+		"/home/me/base.conf":  "com.apple.dock autohide 0 boolean\n",
+	}}
+	tree, err := LoadTree(fs, "/home/me/.mdefaults")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	appended := tree.AppendMissing([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+	})
+	if len(appended) != 1 || appended[0].Key != "tilesize" {
+		t.Fatalf("Expected only tilesize to be appended, got %+v", appended)
+	}
+	if err := tree.Write(fs); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if content := fs.Files["/home/me/.mdefaults"]; content != "include base.conf\ncom.apple.dock tilesize 48 integer\n" {
+		t.Errorf("Expected tilesize to be added to the main file, got %q", content)
+	}
+}
+
+func TestIncludes_YAMLAndTOML(t *testing.T) {
+	fs := &MockFileSystem{Files: map[string]string{
+		"/home/me/.mdefaults.yaml": "include: [base.toml]\ncom.apple.dock:\n  tilesize: {value: 64, type: integer}\n",
+		"/home/me/base.toml":       "include = \"finder\"\n\n[\"com.apple.dock\"]\ntilesize = 48\nautohide = true\n",
+		"/home/me/finder":          "com.apple.finder ShowPathbar 1 boolean\n",
+	}}
+
+	tree, err := LoadTree(fs, "/home/me/.mdefaults.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var got []string
+	for _, cfg := range tree.Configs() {
+		got = append(got, FormatConfig(cfg))
+	}
+	expected := "com.apple.finder ShowPathbar 1 boolean\ncom.apple.dock tilesize 64 integer\ncom.apple.dock autohide true boolean"
+	if strings.Join(got, "\n") != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, strings.Join(got, "\n"))
+	}
+}
+
+func TestParseDocument_IncludeLines(t *testing.T) {
+	doc := ParseLineDocument("include base.conf  # shared\ninclude 'My Settings/*.conf'\ninclude\n")
+
+	includes := doc.Includes()
+	if len(includes) != 2 || includes[0].Pattern != "base.conf" || includes[1].Pattern != "My Settings/*.conf" || includes[1].Line != 2 {
+		t.Errorf("Expected two includes, got %+v", includes)
+	}
+	if doc.Lines[2].Kind != InvalidLine {
+		t.Errorf("Expected include without a path to be invalid, got kind %d", doc.Lines[2].Kind)
+	}
+}
@@ -0,0 +1,632 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+	"gopkg.in/yaml.v3"
+)
+
+// dataTag marks data values inside YAML lists and maps. Their text is the
+// hexadecimal form of the bytes.
+const dataTag = "!data"
+
+// YAMLDocument is a configuration file in the YAML format, where each domain
+// maps its keys to their settings, and the top-level profiles key holds the
+// domains of each profile. The top-level include key names files to include,
+// see LoadTree, and the top-level restart key sets the processes push
+// restarts after changing a domain:
+//
+//	include: [~/dotfiles/mdefaults.yaml]
+//	restart:
+//	  com.apple.dock: Dock
+//	  com.example.app: [ExampleApp, ExampleHelper]
+//	com.apple.dock:
+//	  autohide:
+//	    value: true
+//	    type: boolean
+//	    comment: hide the Dock automatically
+//	  persistent-others:
+//	    value: [a, b]
+//	    type: array
+//	  mru-spaces:
+//	    absent: true
+//	com.apple.menuextra.clock:
+//	  ShowSeconds: {value: true, type: boolean, host: currentHost}
+//	profiles:
+//	  presentation:
+//	    com.apple.dock:
+//	      autohide: {value: true, type: boolean}
+//
+// Lists and maps are used for array and dict values, and the type defaults to
+// array, dict or string depending on the value. The host setting selects the
+// ByHost preferences of this Mac (currentHost) or of a named host, and
+// system: true the system-wide preferences. A key without settings has an
+// empty value, like a line without a value in the line format. Comments and
+// the order of domains and keys are kept when the document is updated.
+type YAMLDocument struct {
+	// root is the document node, or nil for an empty file.
+	root     *yaml.Node
+	entries  []*yamlEntry
+	includes []Include
+	restarts []Restart
+	invalid  []error
+	// content is returned by String until the document is modified.
+	content  string
+	modified bool
+}
+
+type yamlEntry struct {
+	config Config
+	// keyNode is the mapping key holding the name of the key; node holds the
+	// settings.
+	keyNode *yaml.Node
+	node    *yaml.Node
+}
+
+// commentNode returns the node holding the comment at the end of the entry's
+// first line: the settings when they are written inline, such as
+// "tilesize: {value: 48} # comment", and the key otherwise.
+func (e *yamlEntry) commentNode() *yaml.Node {
+	if e.node.Kind != yaml.ScalarNode && e.node.Style&yaml.FlowStyle != 0 {
+		return e.node
+	}
+	return e.keyNode
+}
+
+// yamlSyntaxError turns a "yaml: line N: message" error of the YAML parser
+// into a *LineError.
+func yamlSyntaxError(err error) error {
+	rest, ok := strings.CutPrefix(err.Error(), "yaml: line ")
+	if !ok {
+		return err
+	}
+	number, message, ok := strings.Cut(rest, ": ")
+	line, convErr := strconv.Atoi(number)
+	if !ok || convErr != nil {
+		return err
+	}
+	return &LineError{Line: line, Err: errors.New(message)}
+}
+
+// ParseYAMLDocument parses the content of a YAML configuration file. Syntax
+// errors and a top level that is not a map of domains are returned as errors;
+// invalid entries are kept in the document but yield no configuration.
+func ParseYAMLDocument(content string) (*YAMLDocument, error) {
+	doc := &YAMLDocument{content: content}
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &node); err != nil {
+		return nil, yamlSyntaxError(err)
+	}
+	if len(node.Content) == 0 {
+		return doc, nil
+	}
+	doc.root = &node
+	domains := node.Content[0]
+	if isNull(domains) {
+		domains.Kind, domains.Tag, domains.Value = yaml.MappingNode, "", ""
+	}
+	if domains.Kind != yaml.MappingNode {
+		return nil, &LineError{Line: domains.Line, Err: errors.New("expected a map of domains")}
+	}
+	for i := 0; i+1 < len(domains.Content); i += 2 {
+		if domains.Content[i].Value == includeKeyword {
+			if err := doc.parseIncludes(resolve(domains.Content[i+1])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if domains.Content[i].Value == restartKeyword {
+			if err := doc.parseRestarts(resolve(domains.Content[i+1])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if domains.Content[i].Value != profilesKey {
+			continue
+		}
+		profiles := resolve(domains.Content[i+1])
+		if profiles.Kind != yaml.MappingNode && !isNull(profiles) {
+			return nil, &LineError{Line: profiles.Line, Err: errors.New("expected a map of profiles")}
+		}
+		for j := 0; j+1 < len(profiles.Content); j += 2 {
+			profile, profileDomains := profiles.Content[j].Value, resolve(profiles.Content[j+1])
+			if profileDomains.Kind != yaml.MappingNode && !isNull(profileDomains) {
+				return nil, &LineError{Line: profileDomains.Line, Err: fmt.Errorf("profile %s: expected a map of domains", profile)}
+			}
+			doc.parseDomains(profile, profileDomains)
+		}
+	}
+	doc.parseDomains("", domains)
+	sort.SliceStable(doc.entries, func(i, j int) bool {
+		return doc.entries[i].keyNode.Line < doc.entries[j].keyNode.Line
+	})
+	for i := range doc.includes {
+		for _, entry := range doc.entries {
+			if entry.keyNode.Line < doc.includes[i].Line {
+				doc.includes[i].Position++
+			}
+		}
+	}
+	return doc, nil
+}
+
+// parseIncludes reads the top-level include key, a path or a list of paths.
+func (d *YAMLDocument) parseIncludes(node *yaml.Node) error {
+	patterns := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		patterns = node.Content
+	}
+	for _, pattern := range patterns {
+		pattern = resolve(pattern)
+		if pattern.Kind != yaml.ScalarNode || isNull(pattern) {
+			return &LineError{Line: pattern.Line, Err: errors.New("include takes a path or a list of paths")}
+		}
+		d.includes = append(d.includes, Include{Pattern: pattern.Value, Line: pattern.Line})
+	}
+	return nil
+}
+
+// Includes returns the paths of the top-level include key.
+func (d *YAMLDocument) Includes() []Include {
+	return d.includes
+}
+
+// parseRestarts reads the top-level restart key, a map from domains to a
+// process or a list of processes.
+func (d *YAMLDocument) parseRestarts(node *yaml.Node) error {
+	if isNull(node) {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return &LineError{Line: node.Line, Err: errors.New("restart takes a map from domains to processes")}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		domain, value := node.Content[i], resolve(node.Content[i+1])
+		processes := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			processes = value.Content
+		} else if isNull(value) {
+			processes = nil
+		}
+		restart := Restart{Domain: domain.Value, Processes: []string{}, Line: domain.Line}
+		for _, process := range processes {
+			process = resolve(process)
+			if process.Kind != yaml.ScalarNode || isNull(process) {
+				return &LineError{Line: process.Line, Err: fmt.Errorf("restart %s: expected a process or a list of processes", domain.Value)}
+			}
+			restart.Processes = append(restart.Processes, process.Value)
+		}
+		d.restarts = append(d.restarts, restart)
+	}
+	return nil
+}
+
+// Restarts returns the directives of the top-level restart key.
+func (d *YAMLDocument) Restarts() []Restart {
+	return d.restarts
+}
+
+// profilesKey is the top-level key holding the domains of each profile.
+const profilesKey = "profiles"
+
+func (d *YAMLDocument) parseDomains(profile string, domains *yaml.Node) {
+	for i := 0; i+1 < len(domains.Content); i += 2 {
+		domainNode, keys := domains.Content[i], resolve(domains.Content[i+1])
+		if isNull(keys) || (profile == "" && (domainNode.Value == profilesKey || domainNode.Value == includeKeyword || domainNode.Value == restartKeyword)) {
+			continue
+		}
+		if keys.Kind != yaml.MappingNode {
+			d.invalid = append(d.invalid, &LineError{Line: keys.Line, Err: fmt.Errorf("domain %s: expected a map of keys", domainNode.Value)})
+			continue
+		}
+		for j := 0; j+1 < len(keys.Content); j += 2 {
+			keyNode, node := keys.Content[j], keys.Content[j+1]
+			cfg, err := parseYAMLEntry(domainNode.Value, keyNode.Value, resolve(node))
+			if err != nil {
+				d.invalid = append(d.invalid, &LineError{Line: keyNode.Line, Err: fmt.Errorf("%s %s: %w", domainNode.Value, keyNode.Value, err)})
+				continue
+			}
+			cfg.Profile = profile
+			cfg.Line = keyNode.Line
+			d.entries = append(d.entries, &yamlEntry{config: cfg, keyNode: keyNode, node: node})
+		}
+	}
+}
+
+func parseYAMLEntry(domain, key string, node *yaml.Node) (Config, error) {
+	value := ""
+	cfg := Config{Domain: domain, Key: key, Value: &value, Type: "string"}
+	if isNull(node) {
+		return cfg, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return Config{}, errors.New("expected a map with value and type")
+	}
+
+	var valueNode, typeNode *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		field, fieldValue := node.Content[i].Value, resolve(node.Content[i+1])
+		switch field {
+		case "value":
+			valueNode = fieldValue
+		case "type":
+			typeNode = fieldValue
+		case "comment":
+			cfg.Comment = fieldValue.Value
+		case "host":
+			if fieldValue.Kind != yaml.ScalarNode || fieldValue.Value == "" {
+				return Config{}, errors.New("host must be currentHost or a host name")
+			}
+			cfg.Host = fieldValue.Value
+		case "system":
+			if err := fieldValue.Decode(&cfg.System); err != nil {
+				return Config{}, fmt.Errorf("system must be true or false")
+			}
+		case "absent":
+			if err := fieldValue.Decode(&cfg.Absent); err != nil {
+				return Config{}, fmt.Errorf("absent must be true or false")
+			}
+		default:
+			return Config{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	if err := validateScope(cfg); err != nil {
+		return Config{}, err
+	}
+	if cfg.Absent {
+		if valueNode != nil || typeNode != nil {
+			return Config{}, errAbsentValue
+		}
+		cfg.Value = nil
+		cfg.Type = ""
+		return cfg, nil
+	}
+	if typeNode != nil {
+		if typeNode.Kind != yaml.ScalarNode || typeNode.Value == "" {
+			return Config{}, errors.New("type must be a type name")
+		}
+		cfg.Type = typeNode.Value
+	}
+	if valueNode != nil {
+		switch valueNode.Kind {
+		case yaml.ScalarNode:
+			if !isNull(valueNode) {
+				value = valueNode.Value
+			}
+		case yaml.SequenceNode, yaml.MappingNode:
+			tree := yamlToPlist(valueNode)
+			if typeNode == nil {
+				cfg.Type = tree.Type
+			} else if BaseType(cfg.Type) != tree.Type {
+				return Config{}, fmt.Errorf("a %s value cannot have type %s", tree.Type, cfg.Type)
+			}
+			value = plist.FormatText(tree)
+		}
+	}
+	cfg.Structured = ParseStructured(value, cfg.Type)
+	return cfg, nil
+}
+
+// Configs returns the entries of the document in file order.
+func (d *YAMLDocument) Configs() []Config {
+	configs := []Config{}
+	for _, entry := range d.entries {
+		configs = append(configs, entry.config)
+	}
+	return configs
+}
+
+// Update sets the value and type of every entry in configs. Settings that are
+// already up to date are left untouched, as are comments and absent entries.
+// Entries that are not in the document yet are appended to their domain.
+func (d *YAMLDocument) Update(configs []Config) {
+	for _, cfg := range configs {
+		if cfg.Value == nil {
+			continue
+		}
+		found := false
+		for _, entry := range d.entries {
+			if !sameEntry(entry.config, cfg) {
+				continue
+			}
+			found = true
+			if entry.config.Absent {
+				continue
+			}
+			d.setLineComment(entry.commentNode(), stripMarker(entry.commentNode().LineComment))
+			current := entry.config
+			if current.Type == configType(cfg) && ValuesEqual(current.Type, *current.Value, *cfg.Value) {
+				continue
+			}
+			d.setEntry(entry, cfg)
+		}
+		if !found {
+			d.appendEntry(cfg)
+		}
+	}
+}
+
+// AppendMissing appends the entries of configs whose domain and key are not in
+// the document yet and returns them.
+func (d *YAMLDocument) AppendMissing(configs []Config) []Config {
+	var appended []Config
+	for _, cfg := range configs {
+		if (cfg.Value == nil && !cfg.Absent) || d.has(cfg) {
+			continue
+		}
+		d.appendEntry(cfg)
+		appended = append(appended, cfg)
+	}
+	return appended
+}
+
+// Mark adds a "# mdefaults: note" comment to the entries for the profile,
+// domain and key of cfg, replacing an earlier marker.
+func (d *YAMLDocument) Mark(cfg Config, note string) {
+	for _, entry := range d.entries {
+		if !sameEntry(entry.config, cfg) {
+			continue
+		}
+		node := entry.commentNode()
+		comment := stripMarker(node.LineComment)
+		if comment != "" {
+			comment += " "
+		}
+		d.setLineComment(node, comment+markerPrefix+note)
+	}
+}
+
+// String renders the document. An unmodified document is returned exactly as
+// it was read.
+func (d *YAMLDocument) String() string {
+	if !d.modified {
+		return d.content
+	}
+	if d.root == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(d.root); err != nil {
+		log.Printf("Failed to encode YAML configuration: %v", err)
+		return d.content
+	}
+	return buf.String()
+}
+
+func (d *YAMLDocument) invalidEntries() []error {
+	return d.invalid
+}
+
+func (d *YAMLDocument) has(cfg Config) bool {
+	for _, entry := range d.entries {
+		if sameEntry(entry.config, cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *YAMLDocument) setLineComment(node *yaml.Node, comment string) {
+	if node.LineComment != comment {
+		node.LineComment = comment
+		d.modified = true
+	}
+}
+
+// setEntry writes the value and type of cfg into the settings of entry,
+// keeping its other fields.
+func (d *YAMLDocument) setEntry(entry *yamlEntry, cfg Config) {
+	node := resolve(entry.node)
+	if node.Kind != yaml.MappingNode {
+		*node = yaml.Node{Kind: yaml.MappingNode}
+	}
+	setField(node, "value", valueNode(cfg))
+	setField(node, "type", scalarNode(configType(cfg)))
+	value := *cfg.Value
+	comment := entry.config.Comment
+	entry.config = cfg
+	entry.config.Value = &value
+	entry.config.Type = configType(cfg)
+	entry.config.Comment = comment
+	d.modified = true
+}
+
+// appendEntry adds cfg at the end of its domain, adding the domain and the
+// profile at the end of the document when needed.
+func (d *YAMLDocument) appendEntry(cfg Config) {
+	if d.root == nil {
+		d.root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	domains := d.root.Content[0]
+	if cfg.Profile != "" {
+		domains = mappingField(mappingField(domains, profilesKey), cfg.Profile)
+	}
+	keys := mappingField(domains, cfg.Domain)
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	if cfg.Absent {
+		setField(node, "absent", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	} else {
+		setField(node, "value", valueNode(cfg))
+		setField(node, "type", scalarNode(configType(cfg)))
+	}
+	if cfg.Host != "" {
+		setField(node, "host", scalarNode(cfg.Host))
+	}
+	if cfg.System {
+		setField(node, "system", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+	if cfg.Comment != "" {
+		setField(node, "comment", scalarNode(cfg.Comment))
+	}
+	keyNode := scalarNode(cfg.Key)
+	keys.Content = append(keys.Content, keyNode, node)
+
+	entry := &yamlEntry{config: cfg, keyNode: keyNode, node: node}
+	if cfg.Value != nil {
+		value := *cfg.Value
+		entry.config.Value = &value
+		entry.config.Type = configType(cfg)
+	}
+	d.entries = append(d.entries, entry)
+	d.modified = true
+}
+
+// appendRestarts adds the directives to the top-level restart key, which is
+// put first in a new document. A domain with one process maps to its name and
+// one with several to a list.
+func (d *YAMLDocument) appendRestarts(restarts []Restart) {
+	if d.root == nil {
+		d.root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	domains := d.root.Content[0]
+	node := mappingField(domains, restartKeyword)
+	for _, restart := range restarts {
+		var processes *yaml.Node
+		switch len(restart.Processes) {
+		case 0:
+			processes = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		case 1:
+			processes = scalarNode(restart.Processes[0])
+		default:
+			processes = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, process := range restart.Processes {
+				processes.Content = append(processes.Content, scalarNode(process))
+			}
+		}
+		setField(node, restart.Domain, processes)
+	}
+	d.restarts = append(d.restarts, restarts...)
+	d.modified = true
+}
+
+// mappingField returns the map stored under field of a mapping node, adding it
+// when it is missing.
+func mappingField(node *yaml.Node, field string) *yaml.Node {
+	var value *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == field {
+			value = resolve(node.Content[i+1])
+		}
+	}
+	if value == nil {
+		value = &yaml.Node{Kind: yaml.MappingNode}
+		node.Content = append(node.Content, scalarNode(field), value)
+	} else if value.Kind != yaml.MappingNode {
+		*value = yaml.Node{Kind: yaml.MappingNode}
+	}
+	return value
+}
+
+// setField sets field of a mapping node, appending it when it is missing.
+func setField(node *yaml.Node, field string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == field {
+			// Keep comments written next to the old value.
+			value.LineComment = node.Content[i+1].LineComment
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, scalarNode(field), value)
+}
+
+// valueNode renders the value of cfg, using YAML lists and maps for arrays and
+// dicts.
+func valueNode(cfg Config) *yaml.Node {
+	if IsStructuredType(configType(cfg)) {
+		if tree, err := plist.ParseText(*cfg.Value); err == nil && tree.IsContainer() {
+			return plistToYAML(tree)
+		}
+	}
+	return scalarNode(*cfg.Value)
+}
+
+// scalarNode returns a plain scalar for s. Values are always read back as
+// their text, so only text that YAML reads as null has to be quoted.
+func scalarNode(s string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+func plistToYAML(v *plist.Value) *yaml.Node {
+	switch v.Type {
+	case "array":
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, element := range v.Array {
+			node.Content = append(node.Content, plistToYAML(element))
+		}
+		node.Style = flowStyleFor(node)
+		return node
+	case "dict":
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, entry := range v.Dict {
+			node.Content = append(node.Content, scalarNode(entry.Key), plistToYAML(entry.Value))
+		}
+		node.Style = flowStyleFor(node)
+		return node
+	case "data":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: dataTag, Value: v.Scalar}
+	}
+	return scalarNode(v.Scalar)
+}
+
+// flowStyleFor keeps lists and maps of scalars on one line.
+func flowStyleFor(node *yaml.Node) yaml.Style {
+	for _, child := range node.Content {
+		if child.Kind != yaml.ScalarNode {
+			return 0
+		}
+	}
+	return yaml.FlowStyle
+}
+
+func yamlToPlist(node *yaml.Node) *plist.Value {
+	node = resolve(node)
+	switch node.Kind {
+	case yaml.SequenceNode:
+		array := plist.NewArray()
+		for _, child := range node.Content {
+			array.Array = append(array.Array, yamlToPlist(child))
+		}
+		return array
+	case yaml.MappingNode:
+		dict := plist.NewDict()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			dict.Dict = append(dict.Dict, plist.DictEntry{Key: node.Content[i].Value, Value: yamlToPlist(node.Content[i+1])})
+		}
+		return dict
+	}
+	if node.Tag == dataTag {
+		return &plist.Value{Type: "data", Scalar: strings.ToLower(node.Value)}
+	}
+	if isNull(node) {
+		return plist.NewString("")
+	}
+	return plist.NewString(node.Value)
+}
+
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
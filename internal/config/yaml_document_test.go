@@ -0,0 +1,371 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const sampleYAML = `# Dock settings
+com.apple.dock:
+  autohide:
+    value: true
+    type: boolean
+    comment: hide the Dock automatically
+  tilesize: {value: 48, type: integer}
+  persistent-others:
+    value: [a, "b c"]
+  wvous-tl-corner:
+  mru-spaces:
+    absent: true
+com.apple.finder:
+  FXInfoPanesExpanded:
+    value:
+      General: true
+      Preview: false
+`
+
+func TestParseYAMLDocument_Configs(t *testing.T) {
+	doc, err := ParseYAMLDocument(sampleYAML)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []struct {
+		domain, key, value, valueType string
+		absent                        bool
+	}{
+		{"com.apple.dock", "autohide", "true", "boolean", false},
+		{"com.apple.dock", "tilesize", "48", "integer", false},
+		{"com.apple.dock", "persistent-others", `(a, "b c")`, "array", false},
+		{"com.apple.dock", "wvous-tl-corner", "", "string", false},
+		{"com.apple.dock", "mru-spaces", "", "", true},
+		{"com.apple.finder", "FXInfoPanesExpanded", "{General = true; Preview = false;}", "dict", false},
+	}
+	configs := doc.Configs()
+	if len(configs) != len(expected) {
+		t.Fatalf("Expected %d configs, got %d", len(expected), len(configs))
+	}
+	for i, e := range expected {
+		cfg := configs[i]
+		if cfg.Domain != e.domain || cfg.Key != e.key || cfg.Type != e.valueType || cfg.Absent != e.absent {
+			t.Errorf("Expected %+v, got %+v", e, cfg)
+			continue
+		}
+		if !e.absent && *cfg.Value != e.value {
+			t.Errorf("Expected value %q for %s, got %q", e.value, e.key, *cfg.Value)
+		}
+	}
+	if configs[0].Comment != "hide the Dock automatically" {
+		t.Errorf("Expected comment, got %q", configs[0].Comment)
+	}
+	if configs[2].Structured == nil || configs[5].Structured == nil {
+		t.Error("Expected lists and maps to be parsed as structured values")
+	}
+}
+
+func TestParseYAMLDocument_UnmodifiedRoundTrip(t *testing.T) {
+	doc, err := ParseYAMLDocument(sampleYAML)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	doc.Update(doc.Configs())
+	if doc.String() != sampleYAML {
+		t.Errorf("Expected the document to be unchanged, got:\n%s", doc.String())
+	}
+}
+
+func TestParseYAMLDocument_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"syntax error", "com.apple.dock: [unterminated\n"},
+		{"top level list", "- com.apple.dock\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseYAMLDocument(tc.content); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestParseYAMLDocument_InvalidEntries(t *testing.T) {
+	content := `com.apple.dock:
+  autohide: 1
+  tilesize: {value: 48, colour: blue}
+  mru-spaces: {absent: true, value: 1}
+  persistent-others: {value: [a], type: integer}
+  orientation: {value: left}
+com.apple.finder: [a]
+`
+	doc, err := ParseYAMLDocument(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	configs := doc.Configs()
+	if len(configs) != 1 || configs[0].Key != "orientation" {
+		t.Errorf("Expected only orientation to be valid, got %+v", configs)
+	}
+	invalid := doc.invalidEntries()
+	if len(invalid) != 5 {
+		t.Fatalf("Expected 5 invalid entries, got %v", invalid)
+	}
+	if !strings.HasPrefix(invalid[0].Error(), "line 2: com.apple.dock autohide:") {
+		t.Errorf("Expected the line number and entry in the error, got %v", invalid[0])
+	}
+	if doc.String() != content {
+		t.Error("Expected invalid entries to be kept in the document")
+	}
+}
+
+func TestYAMLDocument_Update(t *testing.T) {
+	doc, err := ParseYAMLDocument(sampleYAML)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "wvous-tl-corner", Value: stringPtr("2"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.finder", Key: "FXInfoPanesExpanded", Value: stringPtr("{General = 1; Preview = 1;}"), Type: "dict"},
+		{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.screencapture", Key: "location", Value: stringPtr("~"), Type: "string"},
+	})
+
+	expected := `# Dock settings
+com.apple.dock:
+  autohide:
+    value: true
+    type: boolean
+    comment: hide the Dock automatically
+  tilesize: {value: 64, type: integer}
+  persistent-others:
+    value: [a, "b c"]
+  wvous-tl-corner:
+    value: 2
+    type: integer
+  mru-spaces:
+    absent: true
+com.apple.finder:
+  FXInfoPanesExpanded:
+    value: {General: 1, Preview: 1}
+    type: dict
+  ShowPathbar:
+    value: 1
+    type: boolean
+com.apple.screencapture:
+  location:
+    value: "~"
+    type: string
+`
+	if doc.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, doc.String())
+	}
+
+	reparsed, err := ParseYAMLDocument(doc.String())
+	if err != nil {
+		t.Fatalf("Expected the updated document to parse, got %v", err)
+	}
+	if configs := reparsed.Configs(); *configs[len(configs)-1].Value != "~" {
+		t.Errorf("Expected ~ to stay a string, got %q", *configs[len(configs)-1].Value)
+	}
+}
+
+func TestYAMLDocument_Mark(t *testing.T) {
+	doc, err := ParseYAMLDocument("com.apple.dock:\n  autohide: # keep hidden\n    value: true\n    type: boolean\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "autohide"}, "not pulled, key absent")
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "autohide"}, "not pulled, timed out")
+
+	expected := "com.apple.dock:\n  autohide: # keep hidden # mdefaults: not pulled, timed out\n    value: true\n    type: boolean\n"
+	if doc.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, doc.String())
+	}
+
+	marked, err := ParseYAMLDocument(doc.String())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	marked.Update([]Config{{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"}})
+	expected = "com.apple.dock:\n  autohide: # keep hidden\n    value: true\n    type: boolean\n"
+	if marked.String() != expected {
+		t.Errorf("Expected Update to remove the marker, got %q", marked.String())
+	}
+}
+
+func TestYAMLDocument_MarkInlineEntry(t *testing.T) {
+	doc, err := ParseYAMLDocument("com.apple.dock:\n  tilesize: {value: 48, type: integer} # big\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	doc.Mark(Config{Domain: "com.apple.dock", Key: "tilesize"}, "not pulled, key absent")
+
+	expected := "com.apple.dock:\n  tilesize: {value: 48, type: integer} # big # mdefaults: not pulled, key absent\n"
+	if doc.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, doc.String())
+	}
+}
+
+func TestYAMLDocument_Profiles(t *testing.T) {
+	content := `com.apple.dock:
+  autohide: {value: false, type: boolean}
+profiles:
+  presentation:
+    com.apple.dock:
+      autohide: {value: true, type: boolean}
+com.apple.finder:
+  ShowPathbar: {value: true, type: boolean}
+`
+	doc, err := ParseYAMLDocument(content)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var entries []string
+	for _, cfg := range doc.Configs() {
+		entries = append(entries, cfg.Profile+":"+cfg.Key+"="+*cfg.Value)
+	}
+	expected := ":autohide=false presentation:autohide=true :ShowPathbar=true"
+	if got := strings.Join(entries, " "); got != expected {
+		t.Errorf("Expected entries in file order %q, got %q", expected, got)
+	}
+
+	doc.Update([]Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("0"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.notificationcenterui", Key: "doNotDisturb", Value: stringPtr("1"), Type: "boolean", Profile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("64"), Type: "integer", Profile: "work"},
+	})
+	expectedContent := `com.apple.dock:
+  autohide: {value: false, type: boolean}
+profiles:
+  presentation:
+    com.apple.dock:
+      autohide: {value: 0, type: boolean}
+    com.apple.notificationcenterui:
+      doNotDisturb:
+        value: 1
+        type: boolean
+  work:
+    com.apple.dock:
+      tilesize:
+        value: 64
+        type: integer
+com.apple.finder:
+  ShowPathbar: {value: true, type: boolean}
+`
+	if rendered := doc.String(); rendered != expectedContent {
+		t.Errorf("Expected content:\n%s\nGot content:\n%s", expectedContent, rendered)
+	}
+}
+
+func TestNewDocument_ConvertsBetweenFormats(t *testing.T) {
+	line := ParseLineDocument("# Dock\n" +
+		"com.apple.dock autohide 1 boolean  # hide the Dock\n" +
+		"com.apple.dock persistent-others '(a, \"b c\")' array\n" +
+		"!com.apple.dock mru-spaces\n" +
+		"com.apple.screencapture name 'Screen Shot'\n")
+
+	yamlDoc, err := NewDocument(YAMLFormat, line.Configs(), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expectedYAML := `com.apple.dock:
+  autohide:
+    value: 1
+    type: boolean
+    comment: hide the Dock
+  persistent-others:
+    value: [a, b c]
+    type: array
+  mru-spaces:
+    absent: true
+com.apple.screencapture:
+  name:
+    value: Screen Shot
+    type: string
+`
+	if yamlDoc.String() != expectedYAML {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expectedYAML, yamlDoc.String())
+	}
+
+	parsed, err := ParseYAMLDocument(yamlDoc.String())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	back, err := NewDocument(LineFormat, parsed.Configs(), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expectedLines := "com.apple.dock autohide 1 boolean # hide the Dock\n" +
+		"com.apple.dock persistent-others '(a, \"b c\")' array\n" +
+		"!com.apple.dock mru-spaces\n" +
+		"com.apple.screencapture name 'Screen Shot' string\n"
+	if back.String() != expectedLines {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expectedLines, back.String())
+	}
+}
+
+func TestNewDocument_CarriesRestarts(t *testing.T) {
+	line := ParseLineDocument("restart com.apple.dock Dock\n" +
+		"restart com.example.app ExampleApp 'Example Helper'\n" +
+		"restart com.apple.finder\n" +
+		"com.apple.dock autohide 1 boolean\n")
+	// Sorted by domain, as the TOML format keeps them.
+	expected := []Restart{
+		{Domain: "com.apple.dock", Processes: []string{"Dock"}},
+		{Domain: "com.apple.finder", Processes: []string{}},
+		{Domain: "com.example.app", Processes: []string{"ExampleApp", "Example Helper"}},
+	}
+
+	for _, format := range []Format{LineFormat, YAMLFormat, TOMLFormat} {
+		doc, err := NewDocument(format, line.Configs(), line.Restarts())
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", format, err)
+		}
+		parsed, err := ParseDocument(format, doc.String())
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v\n%s", format, err, doc.String())
+		}
+		restarts := parsed.(restarter).Restarts()
+		for i := range restarts {
+			restarts[i].Line = 0
+			if restarts[i].Processes == nil {
+				restarts[i].Processes = []string{}
+			}
+		}
+		sort.Slice(restarts, func(i, j int) bool { return restarts[i].Domain < restarts[j].Domain })
+		if !reflect.DeepEqual(restarts, expected) {
+			t.Errorf("%s: expected restarts %v, got %v\n%s", format, expected, restarts, doc.String())
+		}
+		if configs := parsed.Configs(); len(configs) != 1 || configs[0].Key != "autohide" {
+			t.Errorf("%s: expected the autohide entry, got %v", format, configs)
+		}
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	testCases := map[string]Format{
+		"/Users/me/.mdefaults":      LineFormat,
+		"/Users/me/.mdefaults.yaml": YAMLFormat,
+		"/Users/me/dock.YML":        YAMLFormat,
+		"/Users/me/.mdefaults.toml": TOMLFormat,
+		"/Users/me/dock.txt":        LineFormat,
+	}
+	for path, expected := range testCases {
+		if format := FormatForPath(path); format != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, path, format)
+		}
+	}
+}
@@ -2,32 +2,56 @@ package defaults
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"github.com/fumiya-kume/mdefaults/internal/plist"
 )
 
+// ErrKeyNotFound is returned by Read when the domain exists but has no value
+// for the key.
+var ErrKeyNotFound = errors.New("key does not exist")
+
+// ErrDomainNotFound is returned by Read when the domain does not exist.
+var ErrDomainNotFound = errors.New("domain does not exist")
+
 // DefaultsCommand interface defines methods for reading and writing defaults.
 type DefaultsCommand interface {
 	Read(ctx context.Context) (string, error)
 	ReadType(ctx context.Context) (string, error)
 	Write(ctx context.Context, value string) error
 	WriteWithType(ctx context.Context, value string, valueType string) error
+	WriteArgs(value string, valueType string) ([]string, error)
+	Delete(ctx context.Context) error
+	DeleteArgs() []string
 	Domain() string
 	Key() string
+	Scope() Scope
 }
 
 // DefaultsCommandImpl is an implementation of the DefaultsCommand interface.
 type DefaultsCommandImpl struct {
 	domain string
 	key    string
+	scope  Scope
+	fs     fileSystem
 }
 
 // NewDefaultsCommandImpl creates a new DefaultsCommandImpl with the given domain and key.
 func NewDefaultsCommandImpl(domain, key string) *DefaultsCommandImpl {
+	return NewScopedDefaultsCommandImpl(domain, key, Scope{})
+}
+
+// NewScopedDefaultsCommandImpl creates a new DefaultsCommandImpl for the key
+// of domain in the preferences selected by scope.
+func NewScopedDefaultsCommandImpl(domain, key string, scope Scope) *DefaultsCommandImpl {
 	return &DefaultsCommandImpl{
 		domain: domain,
 		key:    key,
+		scope:  scope,
+		fs:     osFileSystem{},
 	}
 }
 
@@ -39,24 +63,64 @@ func (d *DefaultsCommandImpl) Key() string {
 	return d.key
 }
 
+func (d *DefaultsCommandImpl) Scope() Scope {
+	return d.scope
+}
+
 // Read executes a command to read a default setting.
 func (d *DefaultsCommandImpl) Read(ctx context.Context) (string, error) {
 	if d.domain == "" || d.key == "" {
 		return "", fmt.Errorf("domain and key cannot be empty")
 	}
-	output, err := exec.CommandContext(ctx, "defaults", "read", d.domain, d.key).Output()
+	output, err := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "read", d.domain, d.key)...).Output()
 	if err != nil {
-		return "", err
+		return "", readError(ctx, err)
 	}
 	return string(output), nil
 }
 
+// readError turns the failure of `defaults read` into ErrKeyNotFound,
+// ErrDomainNotFound or the context error when the message printed by defaults
+// or the context allow it.
+func readError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	stderr := strings.TrimSpace(string(exitErr.Stderr))
+	return classifyReadError(stderr, err)
+}
+
+// classifyReadError maps the messages of `defaults read`:
+//
+//	The domain/default pair of (com.apple.dock, foo) does not exist
+//	Domain com.example.missing does not exist
+//
+// and reports the permission errors of system domains as
+// ErrPrivilegesRequired.
+func classifyReadError(stderr string, err error) error {
+	switch {
+	case strings.Contains(stderr, "Permission denied") || strings.Contains(stderr, "Operation not permitted"):
+		return fmt.Errorf("%w: %s", ErrPrivilegesRequired, stderr)
+	case strings.Contains(stderr, "domain/default pair"):
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, stderr)
+	case strings.HasPrefix(stderr, "Domain ") && strings.HasSuffix(stderr, "does not exist"):
+		return fmt.Errorf("%w: %s", ErrDomainNotFound, stderr)
+	case stderr != "":
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	return err
+}
+
 // ReadType executes a command to read the type of a default setting.
 func (d *DefaultsCommandImpl) ReadType(ctx context.Context) (string, error) {
 	if d.domain == "" || d.key == "" {
 		return "", fmt.Errorf("domain and key cannot be empty")
 	}
-	output, err := exec.CommandContext(ctx, "defaults", "read-type", d.domain, d.key).Output()
+	output, err := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "read-type", d.domain, d.key)...).Output()
 	if err != nil {
 		return "string", nil
 	}
@@ -75,33 +139,127 @@ func (d *DefaultsCommandImpl) Write(ctx context.Context, value string) error {
 	if d.domain == "" || d.key == "" {
 		return fmt.Errorf("domain and key cannot be empty")
 	}
-	_, err := exec.CommandContext(ctx, "defaults", "write", d.domain, d.key, value).Output()
+	_, err := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "write", d.domain, d.key, value)...).Output()
 	if err != nil {
-		return err
+		return d.scope.privilegeError(err)
 	}
 	return nil
 }
 
+// WriteWithType executes a command to write a default setting with the type flag
+// matching valueType. Array and dict values are given as old-style property
+// lists and are expanded into the element arguments of -array or -dict.
 func (d *DefaultsCommandImpl) WriteWithType(ctx context.Context, value string, valueType string) error {
 	if d.domain == "" || d.key == "" {
 		return fmt.Errorf("domain and key cannot be empty")
 	}
-	
-	typeFlag := mapInternalTypeToFlag(valueType)
-	var args []string
-	if typeFlag == "" || valueType == "string" {
-		args = []string{"defaults", "write", d.domain, d.key, value}
-	} else {
-		args = []string{"defaults", "write", d.domain, d.key, typeFlag, value}
-	}
-	
-	_, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+
+	args, err := d.WriteArgs(value, valueType)
 	if err != nil {
 		return err
 	}
+
+	_, err = exec.CommandContext(ctx, "defaults", args...).Output()
+	if err != nil {
+		return d.scope.privilegeError(err)
+	}
 	return nil
 }
 
+// WriteArgs returns the arguments of the `defaults` invocation that
+// WriteWithType runs to store value as valueType.
+func (d *DefaultsCommandImpl) WriteArgs(value string, valueType string) ([]string, error) {
+	if d.domain == "" || d.key == "" {
+		return nil, fmt.Errorf("domain and key cannot be empty")
+	}
+	args, err := writeArgs(d.scope.domainArgs(d.fs, d.domain), d.key, value, valueType)
+	if err != nil {
+		return nil, err
+	}
+	return append(d.scope.options(), args...), nil
+}
+
+// writeArgs returns the arguments of the `defaults write` invocation that stores
+// value as valueType in the domain named by domainArgs.
+func writeArgs(domainArgs []string, key, value, valueType string) ([]string, error) {
+	typeFlag := mapInternalTypeToFlag(valueType)
+	head := append(append([]string{"write"}, domainArgs...), key)
+	switch {
+	case typeFlag == "" || valueType == "string":
+		return append(head, value), nil
+	case isStructuredFlag(typeFlag):
+		tree, err := plist.ParseText(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value for %s: %w", valueType, key, err)
+		}
+		elements, err := structuredArgs(tree, typeFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value for %s: %w", valueType, key, err)
+		}
+		return append(append(head, typeFlag), elements...), nil
+	default:
+		return append(head, typeFlag, value), nil
+	}
+}
+
+// Delete executes a command to remove a default setting.
+func (d *DefaultsCommandImpl) Delete(ctx context.Context) error {
+	if d.domain == "" || d.key == "" {
+		return fmt.Errorf("domain and key cannot be empty")
+	}
+	_, err := exec.CommandContext(ctx, "defaults", d.DeleteArgs()...).Output()
+	if err != nil {
+		return d.scope.privilegeError(err)
+	}
+	return nil
+}
+
+// DeleteArgs returns the arguments of the defaults invocation Delete runs.
+func (d *DefaultsCommandImpl) DeleteArgs() []string {
+	return d.scope.args(d.fs, "delete", d.domain, d.key)
+}
+
+func isStructuredFlag(typeFlag string) bool {
+	switch typeFlag {
+	case "-array", "-array-add", "-dict", "-dict-add":
+		return true
+	}
+	return false
+}
+
+// structuredArgs returns the arguments following -array/-array-add (one per
+// element) or -dict/-dict-add (alternating keys and values).
+func structuredArgs(tree *plist.Value, typeFlag string) ([]string, error) {
+	if strings.HasPrefix(typeFlag, "-array") {
+		if tree.Type != "array" {
+			return nil, fmt.Errorf("expected an array, got %s", tree.Type)
+		}
+		args := make([]string, 0, len(tree.Array))
+		for _, element := range tree.Array {
+			args = append(args, elementArg(element))
+		}
+		return args, nil
+	}
+	if tree.Type != "dict" {
+		return nil, fmt.Errorf("expected a dict, got %s", tree.Type)
+	}
+	args := make([]string, 0, 2*len(tree.Dict))
+	for _, entry := range tree.Dict {
+		args = append(args, entry.Key, elementArg(entry.Value))
+	}
+	return args, nil
+}
+
+// elementArg renders an array element or dict value. Strings are passed as they
+// are; nested arrays, dicts and data are passed as old-style property lists,
+// which defaults parses back into the matching type.
+func elementArg(v *plist.Value) string {
+	if v.Type == "string" {
+		return v.Scalar
+	}
+	return plist.FormatText(v)
+}
+
 func mapMacOSTypeToInternal(macOSType string) string {
 	switch strings.ToLower(macOSType) {
 	case "integer":
@@ -125,6 +283,12 @@ func mapMacOSTypeToInternal(macOSType string) string {
 	}
 }
 
+// IsKnownType reports whether valueType is a type WriteWithType writes with
+// its own flag, or string. Other types are written as strings.
+func IsKnownType(valueType string) bool {
+	return valueType == "string" || mapInternalTypeToFlag(valueType) != ""
+}
+
 func mapInternalTypeToFlag(internalType string) string {
 	switch internalType {
 	case "integer":
@@ -139,6 +303,10 @@ func mapInternalTypeToFlag(internalType string) string {
 		return "-array"
 	case "dict":
 		return "-dict"
+	case "array-add":
+		return "-array-add"
+	case "dict-add":
+		return "-dict-add"
 	case "data":
 		return "-data"
 	case "string":
@@ -147,3 +315,26 @@ func mapInternalTypeToFlag(internalType string) string {
 		return ""
 	}
 }
+
+// FormatCommand renders a defaults invocation as a shell command line, quoting
+// arguments where needed so that it can be copied into a terminal.
+func FormatCommand(args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, "defaults")
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:=@%+,", c)) {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}
+	}
+	return s
+}
@@ -3,6 +3,8 @@ package defaults
 import (
 	"context"
 	"errors"
+	"io/fs"
+	"os"
 	"testing"
 )
 
@@ -216,3 +218,178 @@ func TestDefaultsCommandImplWriteEmptyDomainOrKey(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultsCommandImplWriteArgsEmptyDomainOrKey(t *testing.T) {
+	defaults := NewDefaultsCommandImpl("", "setting")
+	if _, err := defaults.WriteArgs("test", "string"); err == nil {
+		t.Errorf("Expected error for empty domain, got nil")
+	}
+}
+
+func TestDefaultsCommandImplHostArgs(t *testing.T) {
+	testCases := []struct {
+		host          string
+		expectedWrite string
+		expectedDel   string
+	}{
+		{"", "defaults write com.apple.menuextra.clock ShowSeconds -bool 1", "defaults delete com.apple.menuextra.clock ShowSeconds"},
+		{CurrentHost, "defaults -currentHost write com.apple.menuextra.clock ShowSeconds -bool 1", "defaults -currentHost delete com.apple.menuextra.clock ShowSeconds"},
+		{"studio", "defaults -host studio write com.apple.menuextra.clock ShowSeconds -bool 1", "defaults -host studio delete com.apple.menuextra.clock ShowSeconds"},
+	}
+
+	for _, tc := range testCases {
+		cmd := NewScopedDefaultsCommandImpl("com.apple.menuextra.clock", "ShowSeconds", Scope{Host: tc.host})
+		args, err := cmd.WriteArgs("1", "boolean")
+		if err != nil {
+			t.Fatalf("WriteArgs returned error: %v", err)
+		}
+		if command := FormatCommand(args); command != tc.expectedWrite {
+			t.Errorf("Expected %s, got %s", tc.expectedWrite, command)
+		}
+		if command := FormatCommand(cmd.DeleteArgs()); command != tc.expectedDel {
+			t.Errorf("Expected %s, got %s", tc.expectedDel, command)
+		}
+		if cmd.Scope().Host != tc.host {
+			t.Errorf("Expected host %q, got %q", tc.host, cmd.Scope().Host)
+		}
+	}
+}
+
+func TestDefaultsCommandImplSystemArgs(t *testing.T) {
+	testCases := []struct {
+		domain   string
+		expected string
+	}{
+		{"com.apple.loginwindow", "defaults write /Library/Preferences/com.apple.loginwindow SHOWFULLNAME -bool 1"},
+		{"NSGlobalDomain", "defaults write /Library/Preferences/.GlobalPreferences SHOWFULLNAME -bool 1"},
+		{"-g", "defaults write /Library/Preferences/.GlobalPreferences SHOWFULLNAME -bool 1"},
+	}
+
+	for _, tc := range testCases {
+		cmd := NewScopedDefaultsCommandImpl(tc.domain, "SHOWFULLNAME", Scope{System: true})
+		args, err := cmd.WriteArgs("1", "boolean")
+		if err != nil {
+			t.Fatalf("WriteArgs returned error: %v", err)
+		}
+		if command := FormatCommand(args); command != tc.expected {
+			t.Errorf("Expected %s, got %s", tc.expected, command)
+		}
+		if cmd.Domain() != tc.domain {
+			t.Errorf("Expected the domain without its path, got %s", cmd.Domain())
+		}
+	}
+}
+
+// testFileSystem has a home directory and the files listed in exists.
+type testFileSystem struct {
+	home   string
+	exists map[string]bool
+}
+
+func (f testFileSystem) UserHomeDir() (string, error) {
+	return f.home, nil
+}
+
+func (f testFileSystem) Stat(name string) (os.FileInfo, error) {
+	if f.exists[name] {
+		return nil, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+func TestDefaultsCommandImplDomainArgs(t *testing.T) {
+	files := testFileSystem{home: "/Users/me", exists: map[string]bool{
+		"/Users/me/Library/Containers/com.apple.Safari/Data/Library/Preferences/com.apple.Safari.plist": true,
+	}}
+
+	testCases := []struct {
+		name     string
+		domain   string
+		scope    Scope
+		expected string
+	}{
+		{"app", "-app Safari", Scope{}, "defaults write -app Safari ShowFullURLInSmartSearchField -bool 1"},
+		{"absolute path", "/Users/me/Library/Preferences/com.example.plist", Scope{}, "defaults write /Users/me/Library/Preferences/com.example.plist ShowFullURLInSmartSearchField -bool 1"},
+		{"home path", "~/Library/Preferences/com.example.plist", Scope{}, "defaults write /Users/me/Library/Preferences/com.example.plist ShowFullURLInSmartSearchField -bool 1"},
+		{"container", "com.apple.Safari", Scope{}, "defaults write /Users/me/Library/Containers/com.apple.Safari/Data/Library/Preferences/com.apple.Safari.plist ShowFullURLInSmartSearchField -bool 1"},
+		{"no container", "com.apple.dock", Scope{}, "defaults write com.apple.dock ShowFullURLInSmartSearchField -bool 1"},
+		{"container by host", "com.apple.Safari", Scope{Host: CurrentHost}, "defaults -currentHost write com.apple.Safari ShowFullURLInSmartSearchField -bool 1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := NewScopedDefaultsCommandImpl(tc.domain, "ShowFullURLInSmartSearchField", tc.scope)
+			cmd.fs = files
+			args, err := cmd.WriteArgs("1", "boolean")
+			if err != nil {
+				t.Fatalf("WriteArgs returned error: %v", err)
+			}
+			if command := FormatCommand(args); command != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, command)
+			}
+			if cmd.Domain() != tc.domain {
+				t.Errorf("Expected the domain %s as configured, got %s", tc.domain, cmd.Domain())
+			}
+		})
+	}
+}
+
+func TestFormatCommand(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"write", "com.apple.dock", "tilesize", "-int", "48"}, "defaults write com.apple.dock tilesize -int 48"},
+		{[]string{"write", "d", "k", ""}, "defaults write d k ''"},
+		{[]string{"write", "d", "k", "Screen Shot"}, "defaults write d k 'Screen Shot'"},
+		{[]string{"write", "d", "k", "it's"}, `defaults write d k 'it'\''s'`},
+		{[]string{"write", "d", "k", "-array", "(a, b)"}, "defaults write d k -array '(a, b)'"},
+	}
+
+	for _, tc := range testCases {
+		if command := FormatCommand(tc.args); command != tc.expected {
+			t.Errorf("FormatCommand(%q) = %s, expected %s", tc.args, command, tc.expected)
+		}
+	}
+}
+
+func TestDefaultsCommandImplDeleteEmptyDomainOrKey(t *testing.T) {
+	defaults := NewDefaultsCommandImpl("com.example.app", "")
+	if err := defaults.Delete(context.Background()); err == nil {
+		t.Errorf("Expected error for empty key, got nil")
+	}
+}
+
+func TestMockDefaultsCommandDelete(t *testing.T) {
+	defaults := &MockDefaultsCommand{DeleteError: errors.New("delete error")}
+	if err := defaults.Delete(context.Background()); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+	if !defaults.Deleted {
+		t.Errorf("Expected Delete to be recorded")
+	}
+}
+
+func TestClassifyReadError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	testCases := []struct {
+		name     string
+		stderr   string
+		expected error
+	}{
+		{"key absent", "The domain/default pair of (com.apple.dock, foo) does not exist", ErrKeyNotFound},
+		{"domain absent", "Domain com.example.missing does not exist", ErrDomainNotFound},
+		{"permission denied", "Could not write domain /Library/Preferences/com.apple.loginwindow; Permission denied", ErrPrivilegesRequired},
+		{"other failure", "Could not read", exitErr},
+		{"no message", "", exitErr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyReadError(tc.stderr, exitErr)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package defaults
 
 import (
 	"context"
+	"reflect"
 	"testing"
 )
 
@@ -43,6 +44,8 @@ func TestMapInternalTypeToFlag(t *testing.T) {
 		{"date", "-date"},
 		{"array", "-array"},
 		{"dict", "-dict"},
+		{"array-add", "-array-add"},
+		{"dict-add", "-dict-add"},
 		{"data", "-data"},
 		{"unknown", ""},
 		{"", ""},
@@ -83,3 +86,61 @@ func TestMockDefaultsCommandWriteWithType(t *testing.T) {
 		t.Errorf("Expected no error, got %v", err)
 	}
 }
+
+func TestWriteArgs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		valueType string
+		expected  []string
+	}{
+		{"string", "hello world", "string", []string{"write", "d", "k", "hello world"}},
+		{"untyped", "hello", "", []string{"write", "d", "k", "hello"}},
+		{"integer", "42", "integer", []string{"write", "d", "k", "-int", "42"}},
+		{"boolean", "true", "boolean", []string{"write", "d", "k", "-bool", "true"}},
+		{"empty array", "()", "array", []string{"write", "d", "k", "-array"}},
+		{"array", `("com.apple.Safari", "System Settings")`, "array", []string{"write", "d", "k", "-array", "com.apple.Safari", "System Settings"}},
+		{"array add", `(foo)`, "array-add", []string{"write", "d", "k", "-array-add", "foo"}},
+		{"dict", `{autohide = 1; "tile-type" = "file-tile";}`, "dict", []string{"write", "d", "k", "-dict", "autohide", "1", "tile-type", "file-tile"}},
+		{"dict add", `{a = b;}`, "dict-add", []string{"write", "d", "k", "-dict-add", "a", "b"}},
+		{
+			"nested values",
+			`({"tile-data" = {"file-label" = Safari;}; "tile-type" = "file-tile";}, (a, b), <0a0b>)`,
+			"array",
+			[]string{"write", "d", "k", "-array", `{tile-data = {file-label = Safari;}; tile-type = file-tile;}`, "(a, b)", "<0a0b>"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := writeArgs([]string{"d"}, "k", tc.value, tc.valueType)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("writeArgs() = %q, expected %q", args, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWriteArgs_InvalidStructuredValues(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		valueType string
+	}{
+		{"malformed array", "(a, b", "array"},
+		{"dict given for array", "{a = b;}", "array"},
+		{"array given for dict", "(a)", "dict"},
+		{"flattened value", "a b c", "array"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := writeArgs([]string{"d"}, "k", tc.value, tc.valueType); err == nil {
+				t.Errorf("Expected error for %q, got nil", tc.value)
+			}
+		})
+	}
+}
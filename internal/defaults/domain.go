@@ -0,0 +1,127 @@
+package defaults
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AppOption names a domain by the application that owns it, like
+// `defaults read -app Safari`. A domain of the form "-app <Name>" is passed to
+// defaults as the option and the name.
+const AppOption = "-app"
+
+// containersDir holds the data of sandboxed apps, relative to the home
+// directory.
+const containersDir = "Library/Containers"
+
+// systemGlobalPreferences is the file of NSGlobalDomain in
+// SystemPreferencesDir.
+const systemGlobalPreferences = ".GlobalPreferences"
+
+// isGlobalDomain reports whether domain is one of the names defaults accepts
+// for NSGlobalDomain.
+func isGlobalDomain(domain string) bool {
+	switch domain {
+	case "NSGlobalDomain", "-g", "-globalDomain", "Apple Global Domain":
+		return true
+	}
+	return false
+}
+
+// fileSystem is what naming a domain needs from the file system: the home
+// directory, which "~/" paths and app containers are relative to, and whether
+// the container of a sandboxed app exists.
+type fileSystem interface {
+	UserHomeDir() (string, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// osFileSystem is the fileSystem of the running user.
+type osFileSystem struct{}
+
+func (osFileSystem) UserHomeDir() (string, error) {
+	return os.UserHomeDir()
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// CutApp returns the application name of an "-app <Name>" domain, and
+// whether domain is one.
+func CutApp(domain string) (string, bool) {
+	name, ok := strings.CutPrefix(domain, AppOption+" ")
+	return name, ok && name != ""
+}
+
+// IsPathDomain reports whether domain is the path of a property list, either
+// absolute or relative to the home directory with "~/".
+func IsPathDomain(domain string) bool {
+	return strings.HasPrefix(domain, "/") || strings.HasPrefix(domain, "~/")
+}
+
+// containerPath returns the property list that the sandboxed app bundle keeps
+// in its container under home.
+func containerPath(home, bundle string) string {
+	return filepath.Join(home, containersDir, bundle, "Data", "Library", "Preferences", bundle+".plist")
+}
+
+// domainArgs returns how domain is named on the defaults command line: the
+// option and name of an app, the expanded path of a property list, the path
+// of a system domain, or the container property list of a sandboxed app when
+// the container exists. Paths and containers are looked up in fs.
+func (s Scope) domainArgs(fs fileSystem, domain string) []string {
+	if name, ok := CutApp(domain); ok {
+		return []string{AppOption, name}
+	}
+	if IsPathDomain(domain) {
+		return []string{expandHome(fs, domain)}
+	}
+	if s.System {
+		if isGlobalDomain(domain) {
+			return []string{path.Join(SystemPreferencesDir, systemGlobalPreferences)}
+		}
+		return []string{path.Join(SystemPreferencesDir, domain)}
+	}
+	// ByHost preferences live in a ByHost directory of the container, which
+	// defaults finds by itself.
+	if s.Host == "" {
+		if plist, ok := containerPlist(fs, domain); ok {
+			return []string{plist}
+		}
+	}
+	return []string{domain}
+}
+
+// expandHome replaces the leading "~/" of name with the home directory. The
+// name is kept when the home directory is unknown.
+func expandHome(fs fileSystem, name string) string {
+	rest, ok := strings.CutPrefix(name, "~/")
+	if !ok {
+		return name
+	}
+	home, err := fs.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, rest)
+}
+
+// containerPlist returns the property list of the sandboxed app whose bundle
+// identifier is domain, if its container exists.
+func containerPlist(fs fileSystem, domain string) (string, bool) {
+	if domain == "" || strings.ContainsAny(domain, "/ ") || isGlobalDomain(domain) {
+		return "", false
+	}
+	home, err := fs.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	plist := containerPath(home, domain)
+	if _, err := fs.Stat(plist); err != nil {
+		return "", false
+	}
+	return plist, true
+}
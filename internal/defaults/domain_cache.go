@@ -0,0 +1,115 @@
+package defaults
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+// DomainCache answers Read and ReadType for many keys from a single
+// `defaults export` per domain instead of running `defaults read` and
+// `defaults read-type` for every key. It is safe for concurrent use.
+type DomainCache struct {
+	newDomainCmd func(domain string, scope Scope) DomainCommand
+
+	mu      sync.Mutex
+	domains map[scopedDomain]*exportedDomain
+}
+
+// scopedDomain identifies a domain in a scope; the ByHost and system-wide
+// preferences of a domain are exported separately from those of the user.
+type scopedDomain struct {
+	domain string
+	scope  Scope
+}
+
+// exportedDomain is the parsed export of one domain. tree is nil when the
+// export failed, in which case keys are read one by one.
+type exportedDomain struct {
+	once sync.Once
+	tree *plist.Value
+}
+
+// NewDomainCache creates a DomainCache that exports domains with `defaults
+// export`.
+func NewDomainCache() *DomainCache {
+	return NewDomainCacheWith(func(domain string, scope Scope) DomainCommand {
+		return NewScopedDomainCommandImpl(domain, scope)
+	})
+}
+
+// NewDomainCacheWith creates a DomainCache that exports domains with the
+// commands returned by newDomainCmd for each domain and scope.
+func NewDomainCacheWith(newDomainCmd func(domain string, scope Scope) DomainCommand) *DomainCache {
+	return &DomainCache{newDomainCmd: newDomainCmd, domains: map[scopedDomain]*exportedDomain{}}
+}
+
+// Command returns a DefaultsCommand for the domain, key and scope of fallback
+// that reads through the cache. Reads fall back to fallback when the domain
+// cannot be exported; writes and deletes always go to fallback.
+func (c *DomainCache) Command(fallback DefaultsCommand) DefaultsCommand {
+	return &cachedCommand{DefaultsCommand: fallback, cache: c}
+}
+
+// lookup returns the exported tree of domain in scope, exporting it on first
+// use. It returns nil when the domain cannot be exported or is empty;
+// `defaults export` prints an empty dictionary for a missing domain, and only
+// a per-key read tells that apart from a missing key.
+func (c *DomainCache) lookup(ctx context.Context, domain string, scope Scope) *plist.Value {
+	c.mu.Lock()
+	exported, ok := c.domains[scopedDomain{domain, scope}]
+	if !ok {
+		exported = &exportedDomain{}
+		c.domains[scopedDomain{domain, scope}] = exported
+	}
+	c.mu.Unlock()
+
+	exported.once.Do(func() {
+		output, err := c.newDomainCmd(domain, scope).Export(ctx)
+		if err != nil {
+			return
+		}
+		tree, _, err := plist.Decode(output)
+		if err != nil || tree.Type != "dict" || len(tree.Dict) == 0 {
+			return
+		}
+		exported.tree = tree
+	})
+	return exported.tree
+}
+
+// cachedCommand reads one key through a DomainCache.
+type cachedCommand struct {
+	DefaultsCommand
+	cache *DomainCache
+}
+
+// Read returns the value the way `defaults read` prints it.
+func (d *cachedCommand) Read(ctx context.Context) (string, error) {
+	tree := d.cache.lookup(ctx, d.Domain(), d.Scope())
+	if tree == nil {
+		return d.DefaultsCommand.Read(ctx)
+	}
+	value := tree.Get(d.Key())
+	if value == nil {
+		return "", fmt.Errorf("%w: %s %s", ErrKeyNotFound, d.Domain(), d.Key())
+	}
+	if value.IsContainer() || value.Type == "data" {
+		return plist.FormatText(value), nil
+	}
+	return value.Scalar, nil
+}
+
+// ReadType returns the type recorded in the export.
+func (d *cachedCommand) ReadType(ctx context.Context) (string, error) {
+	tree := d.cache.lookup(ctx, d.Domain(), d.Scope())
+	if tree == nil {
+		return d.DefaultsCommand.ReadType(ctx)
+	}
+	if value := tree.Get(d.Key()); value != nil {
+		return value.Type, nil
+	}
+	return "string", nil
+}
@@ -0,0 +1,122 @@
+package defaults
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const dockExport = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>autohide</key>
+	<true/>
+	<key>tilesize</key>
+	<integer>48</integer>
+	<key>persistent-others</key>
+	<array>
+		<string>Downloads</string>
+		<string>Documents Folder</string>
+	</array>
+</dict>
+</plist>
+`
+
+func TestDomainCache_ReadsFromOneExport(t *testing.T) {
+	domainCmd := &MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport}
+	cache := NewDomainCacheWith(func(domain string, scope Scope) DomainCommand { return domainCmd })
+	fallback := &MockDefaultsCommand{DomainVal: "com.apple.dock", ReadError: errors.New("not expected")}
+
+	testCases := []struct {
+		key       string
+		value     string
+		valueType string
+	}{
+		{"autohide", "1", "boolean"},
+		{"tilesize", "48", "integer"},
+		{"persistent-others", `(Downloads, "Documents Folder")`, "array"},
+	}
+	for _, tc := range testCases {
+		fallback.KeyVal = tc.key
+		cmd := cache.Command(fallback)
+		value, err := cmd.Read(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", tc.key, err)
+		}
+		valueType, _ := cmd.ReadType(context.Background())
+		if value != tc.value || valueType != tc.valueType {
+			t.Errorf("Expected %s to be %s %s, got %s %s", tc.key, tc.valueType, tc.value, valueType, value)
+		}
+	}
+	if domainCmd.Exports != 1 {
+		t.Errorf("Expected one export, got %d", domainCmd.Exports)
+	}
+}
+
+func TestDomainCache_MissingKey(t *testing.T) {
+	domainCmd := &MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport}
+	cache := NewDomainCacheWith(func(domain string, scope Scope) DomainCommand { return domainCmd })
+
+	cmd := cache.Command(&MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "missing"})
+	if _, err := cmd.Read(context.Background()); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestDomainCache_FallsBackToPerKeyReads(t *testing.T) {
+	testCases := []struct {
+		name      string
+		domainCmd *MockDomainCommand
+	}{
+		{"export fails", &MockDomainCommand{DomainVal: "com.example.app", ExportError: errors.New("exit status 1")}},
+		{"not a property list", &MockDomainCommand{DomainVal: "com.example.app", ExportResult: "<plist><dict>"}},
+		{"empty domain", &MockDomainCommand{DomainVal: "com.example.app", ExportResult: "<plist><dict/></plist>"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := NewDomainCacheWith(func(domain string, scope Scope) DomainCommand { return tc.domainCmd })
+			fallback := &MockDefaultsCommand{DomainVal: "com.example.app", KeyVal: "theme", ReadResult: "dark", ReadTypeResult: "string"}
+
+			value, err := cache.Command(fallback).Read(context.Background())
+			if err != nil || value != "dark" {
+				t.Errorf("Expected the fallback value dark, got %q (%v)", value, err)
+			}
+		})
+	}
+}
+
+func TestDomainCache_WritesGoToFallback(t *testing.T) {
+	domainCmd := &MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport}
+	cache := NewDomainCacheWith(func(domain string, scope Scope) DomainCommand { return domainCmd })
+	fallback := &MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize"}
+
+	if err := cache.Command(fallback).Write(context.Background(), "64"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(fallback.WrittenValues) != 1 || fallback.WrittenValues[0] != "64" {
+		t.Errorf("Expected the write to reach the fallback, got %q", fallback.WrittenValues)
+	}
+}
+
+func TestDomainCache_ExportsEachHostSeparately(t *testing.T) {
+	exported := map[string]int{}
+	cache := NewDomainCacheWith(func(domain string, scope Scope) DomainCommand {
+		exported[scope.Host]++
+		result := dockExport
+		if scope.Host == CurrentHost {
+			result = "<plist><dict><key>autohide</key><false/></dict></plist>"
+		}
+		return &MockDomainCommand{DomainVal: domain, ExportResult: result}
+	})
+
+	global, _ := cache.Command(&MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide"}).Read(context.Background())
+	byHost, _ := cache.Command(&MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ScopeVal: Scope{Host: CurrentHost}}).Read(context.Background())
+
+	if global != "1" || byHost != "0" {
+		t.Errorf("Expected 1 globally and 0 for the current host, got %s and %s", global, byHost)
+	}
+	if exported[""] != 1 || exported[CurrentHost] != 1 {
+		t.Errorf("Expected one export per host, got %v", exported)
+	}
+}
@@ -0,0 +1,78 @@
+package defaults
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// DomainCommand reads a whole defaults domain.
+type DomainCommand interface {
+	Read(ctx context.Context) (string, error)
+	Export(ctx context.Context) ([]byte, error)
+	Import(ctx context.Context, plist []byte) error
+	Domain() string
+}
+
+// DomainCommandImpl is an implementation of the DomainCommand interface.
+type DomainCommandImpl struct {
+	domain string
+	scope  Scope
+	fs     fileSystem
+}
+
+// NewDomainCommandImpl creates a new DomainCommandImpl for the given domain.
+func NewDomainCommandImpl(domain string) *DomainCommandImpl {
+	return NewScopedDomainCommandImpl(domain, Scope{})
+}
+
+// NewScopedDomainCommandImpl creates a new DomainCommandImpl for domain in the
+// preferences selected by scope.
+func NewScopedDomainCommandImpl(domain string, scope Scope) *DomainCommandImpl {
+	return &DomainCommandImpl{domain: domain, scope: scope, fs: osFileSystem{}}
+}
+
+func (d *DomainCommandImpl) Domain() string {
+	return d.domain
+}
+
+// Read executes `defaults read <domain>`, which prints every key of the domain
+// as an old-style property list dictionary.
+func (d *DomainCommandImpl) Read(ctx context.Context) (string, error) {
+	if d.domain == "" {
+		return "", fmt.Errorf("domain cannot be empty")
+	}
+	output, err := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "read", d.domain)...).Output()
+	if err != nil {
+		return "", readError(ctx, err)
+	}
+	return string(output), nil
+}
+
+// Export executes `defaults export <domain> -`, which prints the domain as an
+// XML property list. Unlike Read, the output records the type of every value.
+func (d *DomainCommandImpl) Export(ctx context.Context) ([]byte, error) {
+	if d.domain == "" {
+		return nil, fmt.Errorf("domain cannot be empty")
+	}
+	output, err := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "export", d.domain, "-")...).Output()
+	if err != nil {
+		return nil, readError(ctx, err)
+	}
+	return output, nil
+}
+
+// Import executes `defaults import <domain> -` with plist, an XML property
+// list, on standard input. It replaces the whole domain in one step.
+func (d *DomainCommandImpl) Import(ctx context.Context, plist []byte) error {
+	if d.domain == "" {
+		return fmt.Errorf("domain cannot be empty")
+	}
+	cmd := exec.CommandContext(ctx, "defaults", d.scope.args(d.fs, "import", d.domain, "-")...)
+	cmd.Stdin = bytes.NewReader(plist)
+	if _, err := cmd.Output(); err != nil {
+		return d.scope.privilegeError(readError(ctx, err))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package defaults
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDomainCommandImplReadEmptyDomain(t *testing.T) {
+	cmd := NewDomainCommandImpl("")
+	if _, err := cmd.Read(context.Background()); err == nil {
+		t.Errorf("Expected error for empty domain, got nil")
+	}
+}
+
+func TestDomainCommandImplExportEmptyDomain(t *testing.T) {
+	cmd := NewDomainCommandImpl("")
+	if _, err := cmd.Export(context.Background()); err == nil {
+		t.Errorf("Expected error for empty domain, got nil")
+	}
+}
+
+func TestDomainCommandImplImportEmptyDomain(t *testing.T) {
+	cmd := NewDomainCommandImpl("")
+	if err := cmd.Import(context.Background(), nil); err == nil {
+		t.Errorf("Expected error for empty domain, got nil")
+	}
+}
+
+func TestDomainCommandImplDomain(t *testing.T) {
+	cmd := NewDomainCommandImpl("com.apple.dock")
+	if cmd.Domain() != "com.apple.dock" {
+		t.Errorf("Expected domain com.apple.dock, got %s", cmd.Domain())
+	}
+}
@@ -2,21 +2,38 @@ package defaults
 
 import (
 	"context"
+	"time"
 )
 
 // MockDefaultsCommand is a mock implementation of the DefaultsCommand interface for testing.
 type MockDefaultsCommand struct {
-	ReadResult      string
-	ReadError       error
-	ReadTypeResult  string
-	ReadTypeError   error
-	WriteError      error
-	WriteTypeError  error
-	DomainVal       string
-	KeyVal          string
+	ReadResult     string
+	ReadError      error
+	ReadTypeResult string
+	ReadTypeError  error
+	WriteError     error
+	WriteTypeError error
+	DomainVal      string
+	KeyVal         string
+	ScopeVal       Scope
+	DeleteError    error
+	// WrittenValues records the values passed to Write and WriteWithType.
+	WrittenValues []string
+	// Deleted records whether Delete was called.
+	Deleted bool
+	// ReadDelay makes Read take this long, or fail with the context error
+	// when the context ends first.
+	ReadDelay time.Duration
 }
 
 func (m *MockDefaultsCommand) Read(ctx context.Context) (string, error) {
+	if m.ReadDelay > 0 {
+		select {
+		case <-time.After(m.ReadDelay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
 	return m.ReadResult, m.ReadError
 }
 
@@ -28,13 +45,32 @@ func (m *MockDefaultsCommand) ReadType(ctx context.Context) (string, error) {
 }
 
 func (m *MockDefaultsCommand) Write(ctx context.Context, value string) error {
+	m.WrittenValues = append(m.WrittenValues, value)
 	return m.WriteError
 }
 
 func (m *MockDefaultsCommand) WriteWithType(ctx context.Context, value string, valueType string) error {
+	m.WrittenValues = append(m.WrittenValues, value)
 	return m.WriteTypeError
 }
 
+func (m *MockDefaultsCommand) WriteArgs(value string, valueType string) ([]string, error) {
+	args, err := writeArgs(m.ScopeVal.domainArgs(osFileSystem{}, m.DomainVal), m.KeyVal, value, valueType)
+	if err != nil {
+		return nil, err
+	}
+	return append(m.ScopeVal.options(), args...), nil
+}
+
+func (m *MockDefaultsCommand) Delete(ctx context.Context) error {
+	m.Deleted = true
+	return m.DeleteError
+}
+
+func (m *MockDefaultsCommand) DeleteArgs() []string {
+	return m.ScopeVal.args(osFileSystem{}, "delete", m.DomainVal, m.KeyVal)
+}
+
 func (m *MockDefaultsCommand) Domain() string {
 	return m.DomainVal
 }
@@ -42,3 +78,7 @@ func (m *MockDefaultsCommand) Domain() string {
 func (m *MockDefaultsCommand) Key() string {
 	return m.KeyVal
 }
+
+func (m *MockDefaultsCommand) Scope() Scope {
+	return m.ScopeVal
+}
@@ -0,0 +1,37 @@
+package defaults
+
+import (
+	"context"
+)
+
+// MockDomainCommand is a mock implementation of the DomainCommand interface for testing.
+type MockDomainCommand struct {
+	ReadResult   string
+	ReadError    error
+	ExportResult string
+	ExportError  error
+	ImportError  error
+	DomainVal    string
+	// Exports counts the calls of Export.
+	Exports int
+	// Imported records the property lists passed to Import.
+	Imported [][]byte
+}
+
+func (m *MockDomainCommand) Read(ctx context.Context) (string, error) {
+	return m.ReadResult, m.ReadError
+}
+
+func (m *MockDomainCommand) Export(ctx context.Context) ([]byte, error) {
+	m.Exports++
+	return []byte(m.ExportResult), m.ExportError
+}
+
+func (m *MockDomainCommand) Import(ctx context.Context, plist []byte) error {
+	m.Imported = append(m.Imported, plist)
+	return m.ImportError
+}
+
+func (m *MockDomainCommand) Domain() string {
+	return m.DomainVal
+}
@@ -0,0 +1,18 @@
+package defaults
+
+import "context"
+
+// MockPrivilegedRunner is a mock implementation of the PrivilegedRunner interface for testing.
+type MockPrivilegedRunner struct {
+	// Errors holds the errors Run returns; missing ones are nil.
+	Errors []error
+	// Invocations records the invocations of every call of Run.
+	Invocations [][][]string
+}
+
+func (m *MockPrivilegedRunner) Run(ctx context.Context, invocations [][]string) []error {
+	m.Invocations = append(m.Invocations, invocations)
+	errs := make([]error, len(invocations))
+	copy(errs, m.Errors)
+	return errs
+}
@@ -0,0 +1,134 @@
+package defaults
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SudoMode selects how SudoRunner gets root privileges.
+type SudoMode int
+
+const (
+	// SudoPrompt runs sudo, which asks for the password when it has no
+	// cached credentials.
+	SudoPrompt SudoMode = iota
+	// SudoNonInteractive runs sudo -n, which fails instead of asking. It
+	// suits pre-authorized setups such as NOPASSWD rules or credentials
+	// cached by an earlier `sudo -v`.
+	SudoNonInteractive
+)
+
+func (m SudoMode) String() string {
+	switch m {
+	case SudoPrompt:
+		return "prompt"
+	case SudoNonInteractive:
+		return "non-interactive"
+	}
+	return "unknown"
+}
+
+// ParseSudoMode parses the name of a SudoMode.
+func ParseSudoMode(name string) (SudoMode, error) {
+	for _, mode := range []SudoMode{SudoPrompt, SudoNonInteractive} {
+		if name == mode.String() {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sudo mode %q, expected prompt or non-interactive", name)
+}
+
+// PrivilegedRunner runs defaults invocations with root privileges.
+type PrivilegedRunner interface {
+	// Run runs every invocation, given as the arguments of defaults, and
+	// returns the error of each in order.
+	Run(ctx context.Context, invocations [][]string) []error
+}
+
+// SudoRunner runs all invocations in a single shell started with sudo, so
+// that the password is asked for at most once. It runs the shell directly
+// when mdefaults already runs as root.
+type SudoRunner struct {
+	Mode SudoMode
+}
+
+// Run runs the invocations in one privileged shell.
+func (r SudoRunner) Run(ctx context.Context, invocations [][]string) []error {
+	script := privilegedScript(invocations)
+	var cmd *exec.Cmd
+	switch {
+	case os.Geteuid() == 0:
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", script)
+	case r.Mode == SudoNonInteractive:
+		cmd = exec.CommandContext(ctx, "sudo", "-n", "/bin/sh", "-c", script)
+	default:
+		cmd = exec.CommandContext(ctx, "sudo", "/bin/sh", "-c", script)
+		cmd.Stdin = os.Stdin
+	}
+	return runPrivileged(ctx, cmd, len(invocations))
+}
+
+// statusPrefix starts the line the privileged shell prints with the exit
+// status of each invocation.
+const statusPrefix = "mdefaults-status "
+
+// privilegedScript returns a shell script running every invocation, with its
+// error output folded into the standard output, followed by a status line.
+func privilegedScript(invocations [][]string) string {
+	var script strings.Builder
+	for _, args := range invocations {
+		fmt.Fprintf(&script, "%s 2>&1; echo \"%s$?\"\n", FormatCommand(args), statusPrefix)
+	}
+	return script.String()
+}
+
+// runPrivileged runs the shell of privilegedScript and returns the error of
+// each of its n invocations. Invocations without a status line never ran,
+// because sudo failed or the context ended first.
+func runPrivileged(ctx context.Context, cmd *exec.Cmd, n int) []error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, runErr := cmd.Output()
+
+	errs := make([]error, n)
+	i := 0
+	var message []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if status, ok := strings.CutPrefix(line, statusPrefix); ok && i < n {
+			if status != "0" {
+				errs[i] = fmt.Errorf("exit status %s", status)
+				if len(message) > 0 {
+					errs[i] = fmt.Errorf("exit status %s: %s", status, strings.Join(message, " "))
+				}
+			}
+			i++
+			message = nil
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			message = append(message, line)
+		}
+	}
+	for ; i < n; i++ {
+		errs[i] = notRunError(ctx, runErr, strings.TrimSpace(stderr.String()))
+	}
+	return errs
+}
+
+// notRunError explains why the privileged shell did not run an invocation.
+func notRunError(ctx context.Context, runErr error, stderr string) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	switch {
+	case stderr != "":
+		return fmt.Errorf("%w: %s", ErrPrivilegesRequired, stderr)
+	case runErr != nil:
+		return fmt.Errorf("%w: %v", ErrPrivilegesRequired, runErr)
+	}
+	return fmt.Errorf("%w: the privileged shell stopped early", ErrPrivilegesRequired)
+}
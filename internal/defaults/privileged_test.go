@@ -0,0 +1,85 @@
+package defaults
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSudoMode(t *testing.T) {
+	for _, mode := range []SudoMode{SudoPrompt, SudoNonInteractive} {
+		if parsed, err := ParseSudoMode(mode.String()); err != nil || parsed != mode {
+			t.Errorf("Expected %s to parse, got %v (%v)", mode, parsed, err)
+		}
+	}
+	if _, err := ParseSudoMode("always"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestPrivilegedScript(t *testing.T) {
+	script := privilegedScript([][]string{
+		{"write", "/Library/Preferences/com.apple.loginwindow", "LoginwindowText", "Property of Example"},
+		{"delete", "/Library/Preferences/com.apple.loginwindow", "SHOWFULLNAME"},
+	})
+
+	expected := `defaults write /Library/Preferences/com.apple.loginwindow LoginwindowText 'Property of Example' 2>&1; echo "mdefaults-status $?"
+defaults delete /Library/Preferences/com.apple.loginwindow SHOWFULLNAME 2>&1; echo "mdefaults-status $?"
+`
+	if script != expected {
+		t.Errorf("Expected script:\n%s\nGot:\n%s", expected, script)
+	}
+}
+
+// fakeDefaults puts a defaults script that fails for the key "locked" first
+// on PATH.
+func fakeDefaults(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$3\" = locked ]; then echo \"Could not write domain $2; Permission denied\" >&2; exit 1; fi\n"
+	if err := os.WriteFile(filepath.Join(dir, "defaults"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunPrivileged(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	fakeDefaults(t)
+	invocations := [][]string{
+		{"write", "/Library/Preferences/com.apple.loginwindow", "SHOWFULLNAME", "-bool", "1"},
+		{"write", "/Library/Preferences/com.apple.loginwindow", "locked", "1"},
+		{"delete", "/Library/Preferences/com.apple.loginwindow", "GuestEnabled"},
+	}
+
+	cmd := exec.Command("sh", "-c", privilegedScript(invocations))
+	errs := runPrivileged(context.Background(), cmd, len(invocations))
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("Expected the first and last invocations to succeed, got %v", errs)
+	}
+	if errs[1] == nil || !strings.Contains(errs[1].Error(), "Permission denied") {
+		t.Errorf("Expected the message of defaults, got %v", errs[1])
+	}
+}
+
+func TestRunPrivileged_ShellDoesNotRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	cmd := exec.Command("sh", "-c", "echo 'sudo: a password is required' >&2; exit 1")
+
+	errs := runPrivileged(context.Background(), cmd, 2)
+
+	for _, err := range errs {
+		if !errors.Is(err, ErrPrivilegesRequired) || !strings.Contains(err.Error(), "a password is required") {
+			t.Errorf("Expected ErrPrivilegesRequired with the message of sudo, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package defaults
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// CurrentHost selects the ByHost preferences of this Mac, which defaults
+// reaches with -currentHost.
+const CurrentHost = "currentHost"
+
+// SystemPreferencesDir holds the system-wide preferences, such as those of the
+// login window and software update.
+const SystemPreferencesDir = "/Library/Preferences"
+
+// ErrPrivilegesRequired is returned when the system-wide preferences cannot
+// be written, or read, without root privileges.
+var ErrPrivilegesRequired = errors.New("administrator privileges are required for system domains")
+
+// Scope selects the preferences a defaults command reads and writes.
+type Scope struct {
+	// Host is empty for the preferences shared by every host, CurrentHost
+	// for the ByHost preferences of this Mac, or the name of another host.
+	Host string
+	// System selects the system-wide preferences in SystemPreferencesDir
+	// instead of those of the user. Only root can write them.
+	System bool
+}
+
+// options returns the options in front of the defaults command: none for
+// the preferences shared by every host, -currentHost for CurrentHost and
+// -host <name> otherwise.
+func (s Scope) options() []string {
+	switch s.Host {
+	case "":
+		return nil
+	case CurrentHost:
+		return []string{"-currentHost"}
+	}
+	return []string{"-host", s.Host}
+}
+
+// args returns the arguments of the defaults invocation running command on
+// domain, followed by rest. Paths and containers are looked up in fs.
+func (s Scope) args(fs fileSystem, command, domain string, rest ...string) []string {
+	args := append(s.options(), command)
+	args = append(args, s.domainArgs(fs, domain)...)
+	return append(args, rest...)
+}
+
+// privilegeError wraps err with ErrPrivilegesRequired when a write to a
+// system domain failed without root privileges.
+func (s Scope) privilegeError(err error) error {
+	if err == nil || !s.System || os.Geteuid() == 0 {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrPrivilegesRequired, err)
+}
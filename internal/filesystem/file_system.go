@@ -2,6 +2,8 @@ package filesystem
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fumiya-kume/mdefaults/internal/config"
 )
@@ -47,10 +49,73 @@ func (f *OSFileSystem) ReadFile(name string) (string, error) {
 	return string(content), nil
 }
 
-// createConfigFileIfMissing checks for the existence of the config file and creates it if it doesn't exist
-func CreateConfigFileIfMissing(fs FileSystem) error {
-	if _, err := fs.Stat(config.ConfigFilePath); os.IsNotExist(err) {
-		file, err := fs.Create(config.ConfigFilePath)
+// ConfigEnv is the environment variable that names the configuration file.
+const ConfigEnv = "MDEFAULTS_CONFIG"
+
+// configFileExtensions are tried, in order, for each location before falling
+// back to the line format.
+var configFileExtensions = []string{".yaml", ".yml", ".toml"}
+
+// ResolveConfigFilePath returns the configuration file to use, in this order:
+// the explicit path given with --config, $MDEFAULTS_CONFIG, config with one
+// of the extensions or none in $XDG_CONFIG_HOME/mdefaults
+// (~/.config/mdefaults) when one exists, ~/.mdefaults with one of the
+// extensions when one exists, and ~/.mdefaults otherwise. A leading ~ of an
+// explicit path is expanded.
+func ResolveConfigFilePath(fs FileSystem, explicit string) (string, error) {
+	homeDir, err := fs.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if explicit == "" {
+		explicit = os.Getenv(ConfigEnv)
+	}
+	if explicit != "" {
+		return expandHome(homeDir, explicit), nil
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" || !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	if path, ok := existingConfigFile(fs, filepath.Join(configHome, "mdefaults", "config"), true); ok {
+		return path, nil
+	}
+	path := config.DefaultConfigFilePath(homeDir)
+	if found, ok := existingConfigFile(fs, path, false); ok {
+		return found, nil
+	}
+	return path, nil
+}
+
+// existingConfigFile returns base with the first extension that exists, or
+// base itself when withoutExtension is set and it exists.
+func existingConfigFile(fs FileSystem, base string, withoutExtension bool) (string, bool) {
+	for _, ext := range configFileExtensions {
+		if _, err := fs.Stat(base + ext); err == nil {
+			return base + ext, true
+		}
+	}
+	if withoutExtension {
+		if _, err := fs.Stat(base); err == nil {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+func expandHome(homeDir, path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir, path[1:])
+	}
+	return path
+}
+
+// CreateConfigFileIfMissing creates an empty configuration file at path if it
+// doesn't exist.
+func CreateConfigFileIfMissing(fs FileSystem, path string) error {
+	if _, err := fs.Stat(path); os.IsNotExist(err) {
+		file, err := fs.Create(path)
 		if err != nil {
 			return err
 		}
@@ -59,7 +124,29 @@ func CreateConfigFileIfMissing(fs FileSystem) error {
 	return nil
 }
 
-// readConfigFileString reads the config file and returns its content as a string
-func ReadConfigFileString(fs FileSystem) (string, error) {
-	return fs.ReadFile(config.ConfigFilePath)
+// ReadConfigFileString reads the configuration file at path and returns its
+// content as a string.
+func ReadConfigFileString(fs FileSystem, path string) (string, error) {
+	return fs.ReadFile(path)
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (f *OSFileSystem) MkdirAll(path string) error {
+	return os.MkdirAll(path, 0755)
+}
+
+// ReadDir returns the names of the files in a directory, leaving out
+// subdirectories.
+func (f *OSFileSystem) ReadDir(name string) ([]string, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
 }
@@ -12,6 +12,8 @@ type MockFileSystem struct {
 	ConfigFileContent string
 	WriteFileErr      error
 	WriteFileContent  string
+	// Existing, when set, lists the only paths Stat finds.
+	Existing map[string]bool
 }
 
 // UserHomeDir returns the home directory for the mock file system.
@@ -24,6 +26,9 @@ func (m *MockFileSystem) Stat(name string) (os.FileInfo, error) {
 	if m.StatError != nil {
 		return nil, m.StatError
 	}
+	if m.Existing != nil && !m.Existing[name] {
+		return nil, os.ErrNotExist
+	}
 	if m.ConfigFileContent != "" {
 		return nil, os.ErrNotExist
 	}
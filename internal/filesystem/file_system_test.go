@@ -3,6 +3,7 @@ package filesystem_test
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/fumiya-kume/mdefaults/internal/filesystem"
@@ -15,7 +16,7 @@ func TestSetupConfigFile_CreatesFileIfNotExist(t *testing.T) {
 		CreateErr: nil,
 	}
 
-	err := filesystem.CreateConfigFileIfMissing(fs)
+	err := filesystem.CreateConfigFileIfMissing(fs, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Failed to create config file: %v", err)
 	}
@@ -28,7 +29,7 @@ func TestSetupConfigFile_DoesNotCreateFileIfExists(t *testing.T) {
 		CreateErr: nil,
 	}
 
-	err := filesystem.CreateConfigFileIfMissing(fs)
+	err := filesystem.CreateConfigFileIfMissing(fs, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Failed to create config file: %v", err)
 	}
@@ -41,7 +42,7 @@ func TestSetupConfigFile_HandleUserHomeDirError(t *testing.T) {
 		CreateErr: nil,
 	}
 
-	err := filesystem.CreateConfigFileIfMissing(fs)
+	err := filesystem.CreateConfigFileIfMissing(fs, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Failed to create config file: %v", err)
 	}
@@ -52,7 +53,7 @@ func TestReadConfigFileString_Success(t *testing.T) {
 		ConfigFileContent: "com.apple.dock autohide 1\ncom.apple.finder ShowPathbar true\n",
 	}
 
-	content, err := filesystem.ReadConfigFileString(mockFS)
+	content, err := filesystem.ReadConfigFileString(mockFS, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -68,7 +69,7 @@ func TestReadConfigFileString_Empty(t *testing.T) {
 		ConfigFileContent: "",
 	}
 
-	content, err := filesystem.ReadConfigFileString(mockFS)
+	content, err := filesystem.ReadConfigFileString(mockFS, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -84,7 +85,7 @@ func TestReadConfigFileString_Error(t *testing.T) {
 		StatError: errors.New("read error"),
 	}
 
-	_, err := filesystem.ReadConfigFileString(mockFS)
+	_, err := filesystem.ReadConfigFileString(mockFS, "/mock/home/.mdefaults")
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -99,7 +100,7 @@ func TestReadConfigFileString_MalformedContent(t *testing.T) {
 		ConfigFileContent: "com.apple.dock autohide\nmalformed line without key\ncom.apple.finder ShowPathbar true\n",
 	}
 
-	content, err := filesystem.ReadConfigFileString(mockFS)
+	content, err := filesystem.ReadConfigFileString(mockFS, "/mock/home/.mdefaults")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -109,3 +110,62 @@ func TestReadConfigFileString_MalformedContent(t *testing.T) {
 		t.Errorf("Expected content %q, got %q", expectedContent, content)
 	}
 }
+
+func TestOSFileSystem_MkdirAllAndReadDir(t *testing.T) {
+	fs := filesystem.NewOSFileSystem()
+	dir := filepath.Join(t.TempDir(), "state", "snapshots")
+
+	if err := fs.MkdirAll(dir); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := fs.WriteFile(filepath.Join(dir, "a.json"), "{}"); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	names, err := fs.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(names) != 1 || names[0] != "a.json" {
+		t.Errorf("Expected [a.json], got %q", names)
+	}
+}
+
+func TestResolveConfigFilePath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		explicit string
+		env      string
+		xdg      string
+		existing []string
+		expected string
+	}{
+		{"default", "", "", "", nil, "/mock/home/.mdefaults"},
+		{"home yaml", "", "", "", []string{"/mock/home/.mdefaults.yaml", "/mock/home/.mdefaults"}, "/mock/home/.mdefaults.yaml"},
+		{"home toml", "", "", "", []string{"/mock/home/.mdefaults.toml"}, "/mock/home/.mdefaults.toml"},
+		{"xdg default directory", "", "", "", []string{"/mock/home/.config/mdefaults/config", "/mock/home/.mdefaults"}, "/mock/home/.config/mdefaults/config"},
+		{"xdg config home", "", "", "/mock/xdg", []string{"/mock/xdg/mdefaults/config.toml", "/mock/home/.config/mdefaults/config"}, "/mock/xdg/mdefaults/config.toml"},
+		{"relative xdg config home", "", "", "xdg", []string{"/mock/home/.config/mdefaults/config.yml"}, "/mock/home/.config/mdefaults/config.yml"},
+		{"environment", "", "/repo/mdefaults.yaml", "", []string{"/mock/home/.mdefaults.yaml"}, "/repo/mdefaults.yaml"},
+		{"flag", "~/dotfiles/mdefaults", "/repo/mdefaults.yaml", "", nil, "/mock/home/dotfiles/mdefaults"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(filesystem.ConfigEnv, tc.env)
+			t.Setenv("XDG_CONFIG_HOME", tc.xdg)
+			fs := &filesystem.MockFileSystem{HomeDir: "/mock/home", Existing: map[string]bool{}}
+			for _, path := range tc.existing {
+				fs.Existing[path] = true
+			}
+
+			path, err := filesystem.ResolveConfigFilePath(fs, tc.explicit)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if path != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+// Status describes how a configuration entry compares to the live system.
+type Status int
+
+const (
+	// InSync means the system already has the configured value and type.
+	InSync Status = iota
+	// Added means the config file has no value for the entry yet while the
+	// system has one; pull would add it to the file.
+	Added
+	// Changed means the system value differs from the configured one.
+	Changed
+	// TypeMismatch means the values match but their types differ.
+	TypeMismatch
+	// MissingOnSystem means the key or its domain does not exist on the
+	// system.
+	MissingOnSystem
+	// PresentOnSystem means the configuration marks the key as absent but
+	// the system has a value for it.
+	PresentOnSystem
+	// ReadFailed means the key could not be read for another reason, such as
+	// a timeout or a failing defaults command. Result.Err tells why.
+	ReadFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case InSync:
+		return "in-sync"
+	case Added:
+		return "added"
+	case Changed:
+		return "changed"
+	case TypeMismatch:
+		return "type-mismatch"
+	case MissingOnSystem:
+		return "missing-on-system"
+	case PresentOnSystem:
+		return "present-on-system"
+	case ReadFailed:
+		return "read-failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the comparison of one configuration entry with the system.
+type Result struct {
+	Config      config.Config
+	Status      Status
+	SystemValue string
+	SystemType  string
+	// Err is why the key could not be read, for ReadFailed.
+	Err error
+}
+
+// Diff compares the configurations with the values currently set on the system.
+func Diff(configs []config.Config) []Result {
+	defaultsCmds := make([]defaults.DefaultsCommand, 0, len(configs))
+	for i := 0; i < len(configs); i++ {
+		defaultsCmds = append(defaultsCmds, defaults.NewScopedDefaultsCommandImpl(configs[i].Domain, configs[i].Key, defaults.Scope{Host: configs[i].Host, System: configs[i].System}))
+	}
+	return DiffImpl(configs, defaultsCmds)
+}
+
+// DiffImpl compares each configuration with the value read through the
+// defaults command at the same index.
+func DiffImpl(configs []config.Config, defaultsCmds []defaults.DefaultsCommand) []Result {
+	results := make([]Result, 0, len(configs))
+	for i, cfg := range configs {
+		results = append(results, compare(cfg, defaultsCmds[i]))
+	}
+	return results
+}
+
+func compare(cfg config.Config, defaultsCmd defaults.DefaultsCommand) Result {
+	result := Result{Config: cfg}
+
+	value, err := defaultsCmd.Read(context.Background())
+	switch {
+	case err == nil:
+	case errors.Is(err, defaults.ErrKeyNotFound) || errors.Is(err, defaults.ErrDomainNotFound):
+		result.Status = MissingOnSystem
+		if cfg.Absent {
+			result.Status = InSync
+		}
+		return result
+	default:
+		result.Status = ReadFailed
+		result.Err = err
+		return result
+	}
+	valueType, err := defaultsCmd.ReadType(context.Background())
+	if err != nil {
+		valueType = "string"
+	}
+	result.SystemValue, _ = config.NormalizeSystemValue(value, valueType)
+	result.SystemType = valueType
+	if cfg.Absent {
+		result.Status = PresentOnSystem
+		return result
+	}
+
+	configValue := ""
+	if cfg.Value != nil {
+		configValue = *cfg.Value
+	}
+	configType := config.BaseType(cfg.Type)
+
+	switch {
+	case configValue == "" && configType == "string" && result.SystemValue != "":
+		result.Status = Added
+	case !config.ValuesEqual(cfg.Type, configValue, result.SystemValue):
+		result.Status = Changed
+	case configType != result.SystemType:
+		result.Status = TypeMismatch
+	default:
+		result.Status = InSync
+	}
+	return result
+}
+
+// HasDrift reports whether any result is not in sync.
+func HasDrift(results []Result) bool {
+	for _, result := range results {
+		if result.Status != InSync {
+			return true
+		}
+	}
+	return false
+}
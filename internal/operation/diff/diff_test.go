@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+func TestDiffImpl(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         config.Config
+		defaultsCmd    *defaults.MockDefaultsCommand
+		expectedStatus Status
+	}{
+		{
+			"in sync",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+			&defaults.MockDefaultsCommand{ReadResult: "1\n", ReadTypeResult: "boolean"},
+			InSync,
+		},
+		{
+			"changed",
+			config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+			&defaults.MockDefaultsCommand{ReadResult: "64\n", ReadTypeResult: "integer"},
+			Changed,
+		},
+		{
+			"type mismatch",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "string"},
+			&defaults.MockDefaultsCommand{ReadResult: "1\n", ReadTypeResult: "boolean"},
+			TypeMismatch,
+		},
+		{
+			"added",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr(""), Type: "string"},
+			&defaults.MockDefaultsCommand{ReadResult: "1\n", ReadTypeResult: "boolean"},
+			Added,
+		},
+		{
+			"missing on system",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+			&defaults.MockDefaultsCommand{ReadError: defaults.ErrKeyNotFound},
+			MissingOnSystem,
+		},
+		{
+			"absent and missing",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{ReadError: defaults.ErrKeyNotFound},
+			InSync,
+		},
+		{
+			"missing domain",
+			config.Config{Domain: "com.example.app", Key: "Theme", Value: stringPtr("dark"), Type: "string"},
+			&defaults.MockDefaultsCommand{ReadError: defaults.ErrDomainNotFound},
+			MissingOnSystem,
+		},
+		{
+			"read failed",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+			&defaults.MockDefaultsCommand{ReadError: errors.New("signal: killed")},
+			ReadFailed,
+		},
+		{
+			"absent and read failed",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{ReadError: context.DeadlineExceeded},
+			ReadFailed,
+		},
+		{
+			"absent but present",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{ReadResult: "1\n", ReadTypeResult: "boolean"},
+			PresentOnSystem,
+		},
+		{
+			"structured in sync",
+			config.Config{Domain: "com.apple.finder", Key: "FXInfoPanesExpanded", Value: stringPtr("{General = 1; Preview = 0;}"), Type: "dict"},
+			&defaults.MockDefaultsCommand{ReadResult: "{\n    Preview = 0;\n    General = 1;\n}\n", ReadTypeResult: "dict"},
+			InSync,
+		},
+		{
+			"array-add contained",
+			config.Config{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(b)"), Type: "array-add"},
+			&defaults.MockDefaultsCommand{ReadResult: "(\n    a,\n    b\n)\n", ReadTypeResult: "array"},
+			InSync,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results := DiffImpl([]config.Config{tc.config}, []defaults.DefaultsCommand{tc.defaultsCmd})
+			if len(results) != 1 {
+				t.Fatalf("Expected 1 result, got %d", len(results))
+			}
+			if results[0].Status != tc.expectedStatus {
+				t.Errorf("Expected status %s, got %s", tc.expectedStatus, results[0].Status)
+			}
+		})
+	}
+}
+
+func TestDiffImpl_SystemValue(t *testing.T) {
+	configs := []config.Config{{Domain: "com.apple.dock", Key: "persistent-apps", Value: stringPtr("()"), Type: "array"}}
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{ReadResult: "(\n    \"com.apple.Safari\"\n)\n", ReadTypeResult: "array"},
+	}
+
+	results := DiffImpl(configs, defaultsCmds)
+
+	if results[0].SystemValue != "(com.apple.Safari)" {
+		t.Errorf("Expected normalized system value, got %q", results[0].SystemValue)
+	}
+	if results[0].SystemType != "array" {
+		t.Errorf("Expected system type array, got %s", results[0].SystemType)
+	}
+}
+
+func TestHasDrift(t *testing.T) {
+	if HasDrift(nil) {
+		t.Error("Expected no drift for empty results")
+	}
+	if HasDrift([]Result{{Status: InSync}, {Status: InSync}}) {
+		t.Error("Expected no drift when everything is in sync")
+	}
+	if !HasDrift([]Result{{Status: InSync}, {Status: MissingOnSystem}}) {
+		t.Error("Expected drift when an entry is missing on the system")
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	expected := map[Status]string{
+		InSync:          "in-sync",
+		Added:           "added",
+		Changed:         "changed",
+		TypeMismatch:    "type-mismatch",
+		MissingOnSystem: "missing-on-system",
+		PresentOnSystem: "present-on-system",
+		Status(42):      "unknown",
+	}
+	for status, name := range expected {
+		if status.String() != name {
+			t.Errorf("Expected %s, got %s", name, status.String())
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
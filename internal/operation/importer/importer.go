@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+// Filter selects the keys of a domain to import. Empty fields match every key;
+// when both are set a key has to match both.
+type Filter struct {
+	// Glob is a shell pattern such as "tile*".
+	Glob string
+	// Regexp is matched against the key unanchored.
+	Regexp *regexp.Regexp
+}
+
+// NewFilter builds a filter from a glob and a regular expression, either of
+// which may be empty.
+func NewFilter(glob, expr string) (Filter, error) {
+	filter := Filter{Glob: glob}
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return Filter{}, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	if expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		filter.Regexp = re
+	}
+	return filter, nil
+}
+
+// Match reports whether key passes the filter.
+func (f Filter) Match(key string) bool {
+	if f.Glob != "" {
+		if ok, _ := path.Match(f.Glob, key); !ok {
+			return false
+		}
+	}
+	if f.Regexp != nil && !f.Regexp.MatchString(key) {
+		return false
+	}
+	return true
+}
+
+// Import reads every key of domain that passes the filter, together with its
+// value and type.
+func Import(domain string, filter Filter) ([]config.Config, error) {
+	newKeyCmd := func(key string) defaults.DefaultsCommand {
+		return defaults.NewDefaultsCommandImpl(domain, key)
+	}
+	return ImportImpl(defaults.NewDomainCommandImpl(domain), newKeyCmd, filter)
+}
+
+// ImportImpl lists the keys of the domain read by domainCmd and detects the
+// type of each matching key with the command returned by newKeyCmd.
+func ImportImpl(domainCmd defaults.DomainCommand, newKeyCmd func(key string) defaults.DefaultsCommand, filter Filter) ([]config.Config, error) {
+	output, err := domainCmd.Read(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := plist.ParseText(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse domain %s: %w", domainCmd.Domain(), err)
+	}
+	if tree.Type != "dict" {
+		return nil, fmt.Errorf("domain %s is not a dictionary", domainCmd.Domain())
+	}
+
+	configs := []config.Config{}
+	for _, entry := range tree.Dict {
+		if !filter.Match(entry.Key) {
+			continue
+		}
+		valueType, err := newKeyCmd(entry.Key).ReadType(context.Background())
+		if err != nil {
+			valueType = "string"
+		}
+		value := entry.Value.Scalar
+		if entry.Value.IsContainer() {
+			value = plist.FormatText(entry.Value)
+		}
+		configs = append(configs, config.Config{
+			Domain:     domainCmd.Domain(),
+			Key:        entry.Key,
+			Value:      &value,
+			Type:       valueType,
+			Structured: config.ParseStructured(value, valueType),
+		})
+	}
+	return configs, nil
+}
@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+const dockDomain = `{
+    autohide = 1;
+    "persistent-others" =     (
+        a,
+        "b c"
+    );
+    "recent-apps" =     (
+    );
+    tilesize = 48;
+    "wvous-tl-corner" = 2;
+}
+`
+
+func mockKeyCommands(types map[string]string) func(key string) defaults.DefaultsCommand {
+	return func(key string) defaults.DefaultsCommand {
+		return &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: key, ReadTypeResult: types[key]}
+	}
+}
+
+func TestImportImpl(t *testing.T) {
+	domainCmd := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ReadResult: dockDomain}
+	types := map[string]string{
+		"autohide":          "boolean",
+		"persistent-others": "array",
+		"recent-apps":       "array",
+		"tilesize":          "integer",
+		"wvous-tl-corner":   "integer",
+	}
+
+	configs, err := ImportImpl(domainCmd, mockKeyCommands(types), Filter{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []struct{ key, value, valueType string }{
+		{"autohide", "1", "boolean"},
+		{"persistent-others", `(a, "b c")`, "array"},
+		{"recent-apps", "()", "array"},
+		{"tilesize", "48", "integer"},
+		{"wvous-tl-corner", "2", "integer"},
+	}
+	if len(configs) != len(expected) {
+		t.Fatalf("Expected %d configs, got %d", len(expected), len(configs))
+	}
+	for i, e := range expected {
+		cfg := configs[i]
+		if cfg.Domain != "com.apple.dock" || cfg.Key != e.key || *cfg.Value != e.value || cfg.Type != e.valueType {
+			t.Errorf("Expected %s %s %s, got %s %s %s", e.key, e.value, e.valueType, cfg.Key, *cfg.Value, cfg.Type)
+		}
+	}
+	if configs[1].Structured == nil {
+		t.Error("Expected the array to be parsed")
+	}
+}
+
+func TestImportImpl_Filter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		glob     string
+		expr     string
+		expected []string
+	}{
+		{"glob", "*-corner", "", []string{"wvous-tl-corner"}},
+		{"regexp", "", "^(autohide|tilesize)$", []string{"autohide", "tilesize"}},
+		{"both", "*-*", "apps", []string{"recent-apps"}},
+		{"no match", "nothing*", "", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := NewFilter(tc.glob, tc.expr)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			domainCmd := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ReadResult: dockDomain}
+			configs, err := ImportImpl(domainCmd, mockKeyCommands(nil), filter)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var keys []string
+			for _, cfg := range configs {
+				keys = append(keys, cfg.Key)
+			}
+			if len(keys) != len(tc.expected) {
+				t.Fatalf("Expected %q, got %q", tc.expected, keys)
+			}
+			for i := range keys {
+				if keys[i] != tc.expected[i] {
+					t.Errorf("Expected %q, got %q", tc.expected, keys)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	if _, err := NewFilter("[", ""); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+	if _, err := NewFilter("", "("); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+}
+
+func TestImportImpl_Errors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		domainCmd *defaults.MockDomainCommand
+	}{
+		{"read error", &defaults.MockDomainCommand{DomainVal: "com.example.app", ReadError: defaults.ErrDomainNotFound}},
+		{"not a property list", &defaults.MockDomainCommand{DomainVal: "com.example.app", ReadResult: "{ unterminated"}},
+		{"not a dictionary", &defaults.MockDomainCommand{DomainVal: "com.example.app", ReadResult: "(a, b)"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ImportImpl(tc.domainCmd, mockKeyCommands(nil), Filter{}); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestImportImpl_ReadErrorKeepsCause(t *testing.T) {
+	domainCmd := &defaults.MockDomainCommand{DomainVal: "com.example.app", ReadError: defaults.ErrDomainNotFound}
+	_, err := ImportImpl(domainCmd, mockKeyCommands(nil), Filter{})
+	if !errors.Is(err, defaults.ErrDomainNotFound) {
+		t.Errorf("Expected ErrDomainNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+)
+
+// Diagnostic is a problem found on a line of a configuration file. Line is
+// zero for problems with the whole file, and Path is empty for problems that
+// are not found in a file.
+type Diagnostic struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	switch {
+	case d.Path == "":
+		return d.Message
+	case d.Line == 0:
+		return fmt.Sprintf("%s: %s", d.Path, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.Path, d.Line, d.Message)
+}
+
+// entryKey identifies the entries that configure the same key. An entry
+// given twice in one file silently replaces the first one.
+type entryKey struct {
+	profile, domain, key, host string
+	system                     bool
+}
+
+// Lint checks the configuration files without touching the system. It reports
+// lines that cannot be parsed, entries given twice in a file, unknown types,
+// which push would write as strings, and values that are not valid for their
+// type. The diagnostics of each file are in line order.
+func Lint(files []*config.File) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, file := range files {
+		diagnostics = append(diagnostics, lintFile(file)...)
+	}
+	return diagnostics
+}
+
+// LoadErrors returns the diagnostics of an error config.LoadTree returned,
+// such as a syntax error or a broken include. A problem in an included file is
+// reported at its own line rather than at the include directive.
+func LoadErrors(err error) []Diagnostic {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var diagnostics []Diagnostic
+		for _, err := range joined.Unwrap() {
+			diagnostics = append(diagnostics, LoadErrors(err)...)
+		}
+		return diagnostics
+	}
+	var fileErr *config.FileError
+	if !errors.As(err, &fileErr) {
+		return []Diagnostic{{Message: err.Error()}}
+	}
+	var included *config.FileError
+	if errors.As(fileErr.Err, &included) {
+		// Skip the "include pattern:" wrapping down to the errors of the
+		// included files.
+		inner := fileErr.Err
+		for {
+			if _, ok := inner.(*config.FileError); ok {
+				break
+			}
+			if _, ok := inner.(interface{ Unwrap() []error }); ok {
+				break
+			}
+			inner = errors.Unwrap(inner)
+		}
+		return LoadErrors(inner)
+	}
+	return []Diagnostic{{Path: fileErr.Path, Line: fileErr.Line, Message: fileErr.Err.Error()}}
+}
+
+func lintFile(file *config.File) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, err := range config.InvalidEntries(file.Doc) {
+		var lineErr *config.LineError
+		if errors.As(err, &lineErr) {
+			diagnostics = append(diagnostics, Diagnostic{Path: file.Path, Line: lineErr.Line, Message: lineErr.Err.Error()})
+		}
+	}
+
+	first := map[entryKey]int{}
+	for _, cfg := range file.Doc.Configs() {
+		key := entryKey{profile: cfg.Profile, domain: cfg.Domain, key: cfg.Key, host: cfg.Host, system: cfg.System}
+		if line, ok := first[key]; ok {
+			diagnostics = append(diagnostics, Diagnostic{Path: file.Path, Line: cfg.Line, Message: fmt.Sprintf("%s %s: duplicate entry, first given on line %d", cfg.Domain, cfg.Key, line)})
+		} else {
+			first[key] = cfg.Line
+		}
+		if err := checkValue(cfg); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Path: file.Path, Line: cfg.Line, Message: fmt.Sprintf("%s %s: %v", cfg.Domain, cfg.Key, err)})
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics
+}
+
+// checkValue reports a type that push would not write with its own flag and a
+// value that cannot be written as its type.
+func checkValue(cfg config.Config) error {
+	if cfg.Absent || cfg.Value == nil {
+		return nil
+	}
+	if cfg.Type != "" && !defaults.IsKnownType(cfg.Type) {
+		return fmt.Errorf("unknown type %q, the value would be written as a string", cfg.Type)
+	}
+	_, err := config.PlistValue(*cfg.Value, cfg.Type)
+	return err
+}
@@ -0,0 +1,83 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+)
+
+func TestLint_LineFormat(t *testing.T) {
+	doc := config.ParseLineDocument(strings.Join([]string{
+		"# Dock",
+		"com.apple.dock tilesize 48 integer",
+		"com.apple.dock autohide maybe boolean",
+		"com.apple.dock tilesize 36 integer",
+		"-currentHost com.apple.dock tilesize 36 integer",
+		"com.apple.dock orientation left strin",
+		"com.apple.dock mineffect 'genie effect string",
+		"com.apple.dock magnification abc integer",
+		"com.apple.finder FXRemoveOldTrashItems 2024-13-01 date",
+		"com.apple.dock persistent-others '(a, b' dict",
+		"com.apple.dock largesize 1.5 float",
+		"!com.apple.dock mru-spaces",
+	}, "\n"))
+
+	diagnostics := Lint([]*config.File{{Path: "/Users/me/.mdefaults", Doc: doc}})
+
+	expected := []string{
+		`/Users/me/.mdefaults:3: com.apple.dock autohide: invalid boolean "maybe"`,
+		"/Users/me/.mdefaults:4: com.apple.dock tilesize: duplicate entry, first given on line 2",
+		`/Users/me/.mdefaults:6: com.apple.dock orientation: unknown type "strin", the value would be written as a string`,
+		"/Users/me/.mdefaults:7: unterminated single quote at column 26",
+		`/Users/me/.mdefaults:8: com.apple.dock magnification: invalid integer "abc"`,
+		`/Users/me/.mdefaults:9: com.apple.finder FXRemoveOldTrashItems: invalid date "2024-13-01"`,
+		"/Users/me/.mdefaults:10: com.apple.dock persistent-others: invalid dict value",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if !strings.HasPrefix(d.String(), expected[i]) {
+			t.Errorf("Diagnostic %d: expected %q, got %q", i, expected[i], d.String())
+		}
+	}
+}
+
+func TestLint_YAMLFormat(t *testing.T) {
+	doc, err := config.ParseYAMLDocument(strings.Join([]string{
+		"com.apple.dock:",
+		"  tilesize: {value: 48, type: integer}",
+		"  autohide: {value: true, type: bool}",
+		"  orientation: {value: left, colour: blue}",
+		"profiles:",
+		"  work:",
+		"    com.apple.dock:",
+		"      tilesize: {value: 36, type: integer}",
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	diagnostics := Lint([]*config.File{{Path: "mdefaults.yaml", Doc: doc}})
+
+	expected := []string{
+		`mdefaults.yaml:3: com.apple.dock autohide: unknown type "bool", the value would be written as a string`,
+		`mdefaults.yaml:4: com.apple.dock orientation: unknown field "colour"`,
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.String() != expected[i] {
+			t.Errorf("Diagnostic %d: expected %q, got %q", i, expected[i], d.String())
+		}
+	}
+}
+
+func TestLint_Clean(t *testing.T) {
+	doc := config.ParseLineDocument("com.apple.dock tilesize 48 integer\ncom.apple.dock autohide yes boolean\ncom.apple.dock orientation\n")
+	if diagnostics := Lint([]*config.File{{Path: ".mdefaults", Doc: doc}}); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diagnostics)
+	}
+}
@@ -2,40 +2,150 @@ package pull
 
 import (
 	"context"
-	"strings"
+	"errors"
 
 	"github.com/fumiya-kume/mdefaults/internal/config"
 	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
-func Pull(configs []config.Config) ([]config.Config, error) {
+// Reason classifies why a key could not be pulled.
+type Reason int
+
+const (
+	// KeyAbsent means the domain exists but does not have the key.
+	KeyAbsent Reason = iota
+	// DomainAbsent means the domain does not exist, e.g. because the app is
+	// not installed on this machine.
+	DomainAbsent
+	// CommandFailed means defaults failed for another reason.
+	CommandFailed
+	// TimedOut means defaults did not answer within the per-key timeout.
+	TimedOut
+)
+
+func (r Reason) String() string {
+	switch r {
+	case KeyAbsent:
+		return "key absent"
+	case DomainAbsent:
+		return "domain absent"
+	case CommandFailed:
+		return "command failed"
+	case TimedOut:
+		return "timed out"
+	}
+	return "unknown"
+}
+
+// Failure describes a key that could not be read from the system.
+type Failure struct {
+	Config config.Config
+	Reason Reason
+	Err    error
+}
+
+// Pull reads the current values of the configurations from the system, reading
+// several keys at the same time within limits. Each domain is exported once
+// and its keys are read from the export; keys of a domain that cannot be
+// exported are read one by one. Absent entries are not read; they only tell
+// push to delete a key.
+func Pull(ctx context.Context, configs []config.Config, limits parallel.Limits) ([]config.Config, []Failure, error) {
+	cache := defaults.NewDomainCache()
 	defaultsCmds := make([]defaults.DefaultsCommand, 0, len(configs))
 	for i := 0; i < len(configs); i++ {
-		defaultsCmds = append(defaultsCmds, defaults.NewDefaultsCommandImpl(configs[i].Domain, configs[i].Key))
+		if configs[i].Absent {
+			continue
+		}
+		defaultsCmds = append(defaultsCmds, cache.Command(defaults.NewScopedDefaultsCommandImpl(configs[i].Domain, configs[i].Key, defaults.Scope{Host: configs[i].Host, System: configs[i].System})))
+	}
+	pulled, failures, err := PullImpl(ctx, defaultsCmds, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The commands only know domains, keys and scopes; keep the profile and
+	// file each entry came from so that it is written back to the same place.
+	for i := range pulled {
+		setOrigin(configs, &pulled[i])
 	}
-	return PullImpl(defaultsCmds)
+	for i := range failures {
+		setOrigin(configs, &failures[i].Config)
+	}
+	return pulled, failures, nil
 }
 
-func PullImpl(defaultsCmds []defaults.DefaultsCommand) ([]config.Config, error) {
+// setOrigin copies the profile and source of the entry of configs for the
+// domain, key and scope of cfg to cfg.
+func setOrigin(configs []config.Config, cfg *config.Config) {
+	for _, c := range configs {
+		if !c.Absent && c.Domain == cfg.Domain && c.Key == cfg.Key && c.Host == cfg.Host && c.System == cfg.System {
+			cfg.Profile, cfg.Source, cfg.SourceProfile = c.Profile, c.Source, c.SourceProfile
+			return
+		}
+	}
+}
+
+// PullImpl reads every key from the system. Keys that cannot be read are
+// reported as failures instead of values. Both are returned in the order of
+// defaultsCmds. When ctx is cancelled PullImpl stops and returns its error.
+func PullImpl(ctx context.Context, defaultsCmds []defaults.DefaultsCommand, limits parallel.Limits) ([]config.Config, []Failure, error) {
+	values := make([]*config.Config, len(defaultsCmds))
+	failures := make([]*Failure, len(defaultsCmds))
+	err := limits.Each(ctx, len(defaultsCmds), func(ctx context.Context, i int) {
+		values[i], failures[i] = pullKey(ctx, defaultsCmds[i])
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
 	updatedConfigs := make([]config.Config, 0, len(defaultsCmds))
-	for i := 0; i < len(defaultsCmds); i++ {
-		value, err := defaultsCmds[i].Read(context.Background())
-		if err != nil {
+	var failed []Failure
+	for i := range defaultsCmds {
+		if failures[i] != nil {
+			failed = append(failed, *failures[i])
 			continue
 		}
-		value = strings.ReplaceAll(value, "\n", "")
-		
-		valueType, err := defaultsCmds[i].ReadType(context.Background())
-		if err != nil {
-			valueType = "string"
+		updatedConfigs = append(updatedConfigs, *values[i])
+	}
+	return updatedConfigs, failed, nil
+}
+
+// pullKey reads the value and type of one key.
+func pullKey(ctx context.Context, defaultsCmd defaults.DefaultsCommand) (*config.Config, *Failure) {
+	value, err := defaultsCmd.Read(ctx)
+	if err != nil {
+		return nil, &Failure{
+			Config: config.Config{Domain: defaultsCmd.Domain(), Key: defaultsCmd.Key(), Host: defaultsCmd.Scope().Host, System: defaultsCmd.Scope().System},
+			Reason: classify(err),
+			Err:    err,
 		}
-		
-		updatedConfigs = append(updatedConfigs, config.Config{
-			Domain: defaultsCmds[i].Domain(),
-			Key:    defaultsCmds[i].Key(),
-			Value:  &value,
-			Type:   valueType,
-		})
-	}
-	return updatedConfigs, nil
+	}
+
+	valueType, err := defaultsCmd.ReadType(ctx)
+	if err != nil {
+		valueType = "string"
+	}
+	value, structured := config.NormalizeSystemValue(value, valueType)
+
+	return &config.Config{
+		Domain:     defaultsCmd.Domain(),
+		Key:        defaultsCmd.Key(),
+		Value:      &value,
+		Type:       valueType,
+		Structured: structured,
+		Host:       defaultsCmd.Scope().Host,
+		System:     defaultsCmd.Scope().System,
+	}, nil
+}
+
+func classify(err error) Reason {
+	switch {
+	case errors.Is(err, defaults.ErrKeyNotFound):
+		return KeyAbsent
+	case errors.Is(err, defaults.ErrDomainNotFound):
+		return DomainAbsent
+	case errors.Is(err, context.DeadlineExceeded):
+		return TimedOut
+	}
+	return CommandFailed
 }
@@ -1,11 +1,15 @@
 package pull
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/fumiya-kume/mdefaults/internal/config"
 	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
 func TestPull_Success(t *testing.T) {
@@ -13,7 +17,7 @@ func TestPull_Success(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1"},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -36,10 +40,41 @@ func TestPull_ReadError(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadError: errors.New("read error")},
 	}
 
-	updatedConfigs, _ := PullImpl(defaultsCmds)
+	updatedConfigs, failures, _ := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if len(updatedConfigs) != 0 {
 		t.Errorf("Expected 0 configs, got %d", len(updatedConfigs))
 	}
+	if len(failures) != 1 || failures[0].Config.Key != "autohide" || failures[0].Reason != CommandFailed {
+		t.Errorf("Expected autohide to be reported as a command failure, got %+v", failures)
+	}
+}
+
+func TestPull_ClassifiesFailures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected Reason
+	}{
+		{"key absent", fmt.Errorf("%w: The domain/default pair of (com.apple.dock, foo) does not exist", defaults.ErrKeyNotFound), KeyAbsent},
+		{"domain absent", fmt.Errorf("%w: Domain com.example.app does not exist", defaults.ErrDomainNotFound), DomainAbsent},
+		{"timeout", context.DeadlineExceeded, TimedOut},
+		{"command failure", errors.New("exit status 1"), CommandFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaultsCmds := []defaults.DefaultsCommand{
+				&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "foo", ReadError: tc.err},
+			}
+			_, failures, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(failures) != 1 || failures[0].Reason != tc.expected {
+				t.Errorf("Expected %s, got %+v", tc.expected, failures)
+			}
+		})
+	}
 }
 
 func TestPull_MultipleConfigs(t *testing.T) {
@@ -48,7 +83,7 @@ func TestPull_MultipleConfigs(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "ShowPathbar", ReadResult: "true"},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -66,7 +101,7 @@ func TestPull_MultipleConfigs(t *testing.T) {
 func TestPull_EmptyConfigs(t *testing.T) {
 	defaultsCmds := []defaults.DefaultsCommand{}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -81,7 +116,7 @@ func TestPull_MixedResults(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "ShowPathbar", ReadError: errors.New("read error")},
 	}
 
-	updatedConfigs, _ := PullImpl(defaultsCmds)
+	updatedConfigs, _, _ := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if len(updatedConfigs) != 1 {
 		t.Errorf("Expected 1 config, got %d", len(updatedConfigs))
 	}
@@ -95,7 +130,7 @@ func TestPull_InvalidConfig(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "", KeyVal: "", ReadError: errors.New("invalid config")},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -110,7 +145,7 @@ func TestPull_MaxConfigs(t *testing.T) {
 		maxConfigs[i] = &defaults.MockDefaultsCommand{DomainVal: fmt.Sprintf("domain%d", i), KeyVal: fmt.Sprintf("key%d", i), ReadResult: "value"}
 	}
 
-	updatedConfigs, err := PullImpl(maxConfigs)
+	updatedConfigs, _, err := PullImpl(context.Background(), maxConfigs, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -124,7 +159,7 @@ func TestPull_ErrorHandling(t *testing.T) {
 		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadError: errors.New("unexpected error")},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected nil error, got %v", err)
 	}
@@ -132,3 +167,136 @@ func TestPull_ErrorHandling(t *testing.T) {
 		t.Errorf("Expected 0 configs, got %d", len(updatedConfigs))
 	}
 }
+
+func TestPull_ValuesRoundTripThroughConfigFile(t *testing.T) {
+	readResults := []string{
+		"1\n",
+		"/Users/me/Library/Application Support/Screenshots\n",
+		"Screen Shot\n",
+		"it's a \"quoted\" value\n",
+		"(\n    \"com.apple.Safari\",\n    \"com.apple.mail\"\n)\n",
+		"{\n    \"tile-type\" = \"file-tile\";\n}\n",
+		"C:\\path\\to\\file\n",
+		"\t leading and trailing whitespace \t\n",
+		"\n",
+	}
+	defaultsCmds := make([]defaults.DefaultsCommand, 0, len(readResults))
+	for i, result := range readResults {
+		defaultsCmds = append(defaultsCmds, &defaults.MockDefaultsCommand{DomainVal: "com.example.app", KeyVal: fmt.Sprintf("key %d", i), ReadResult: result})
+	}
+
+	pulledConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+
+	fs := &config.MockFileSystem{ConfigFileContent: config.GenerateConfigFileContent(pulledConfigs)}
+	readConfigs, err := config.ReadConfigFile(fs, config.DefaultConfigFilePath("/mock/home"))
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if len(readConfigs) != len(pulledConfigs) {
+		t.Fatalf("Expected %d configs, got %d", len(pulledConfigs), len(readConfigs))
+	}
+	for i := range pulledConfigs {
+		if readConfigs[i].Key != pulledConfigs[i].Key || *readConfigs[i].Value != *pulledConfigs[i].Value || readConfigs[i].Type != pulledConfigs[i].Type {
+			t.Errorf("Round trip mismatch: pulled %q %q %s, read back %q %q %s",
+				pulledConfigs[i].Key, *pulledConfigs[i].Value, pulledConfigs[i].Type,
+				readConfigs[i].Key, *readConfigs[i].Value, readConfigs[i].Type)
+		}
+	}
+}
+
+func TestPull_ConcurrentReadsKeepOrder(t *testing.T) {
+	var defaultsCmds []defaults.DefaultsCommand
+	for i := 0; i < 20; i++ {
+		defaultsCmds = append(defaultsCmds, &defaults.MockDefaultsCommand{
+			DomainVal:  "com.example.app",
+			KeyVal:     fmt.Sprintf("key%02d", i),
+			ReadResult: fmt.Sprint(i),
+			// Later keys answer first.
+			ReadDelay: time.Duration(20-i) * time.Millisecond,
+		})
+	}
+
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{Jobs: 5})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	for i, cfg := range updatedConfigs {
+		if cfg.Key != fmt.Sprintf("key%02d", i) || *cfg.Value != fmt.Sprint(i) {
+			t.Errorf("Expected key%02d = %d at index %d, got %s = %s", i, i, i, cfg.Key, *cfg.Value)
+		}
+	}
+}
+
+func TestPull_TimesOutSlowKeys(t *testing.T) {
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.example.hung", KeyVal: "key", ReadDelay: time.Minute},
+	}
+
+	updatedConfigs, failures, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if len(updatedConfigs) != 1 || len(failures) != 1 || failures[0].Reason != TimedOut {
+		t.Errorf("Expected the hung key to time out, got %+v and %+v", updatedConfigs, failures)
+	}
+}
+
+func TestPull_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1"},
+	}
+
+	if _, _, err := PullImpl(ctx, defaultsCmds, parallel.Limits{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSetOrigin(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "autohide", Profile: "presentation", Source: "/home/me/.mdefaults", SourceProfile: "presentation"},
+		{Domain: "com.apple.dock", Key: "tilesize", Absent: true, Profile: "work"},
+		{Domain: "com.apple.dock", Key: "tilesize", Source: "/home/me/base.conf"},
+		{Domain: "com.apple.mail", Key: "DisableInlineAttachmentViewing", Profile: "work", Source: "/home/me/work.conf"},
+	}
+
+	cfg := config.Config{Domain: "com.apple.dock", Key: "autohide"}
+	if setOrigin(configs, &cfg); cfg.Profile != "presentation" || cfg.Source != "/home/me/.mdefaults" || cfg.SourceProfile != "presentation" {
+		t.Errorf("Expected presentation from /home/me/.mdefaults, got %q from %q", cfg.Profile, cfg.Source)
+	}
+	cfg = config.Config{Domain: "com.apple.dock", Key: "tilesize"}
+	if setOrigin(configs, &cfg); cfg.Profile != "" || cfg.Source != "/home/me/base.conf" {
+		t.Errorf("Expected the base entry from /home/me/base.conf, got %q from %q", cfg.Profile, cfg.Source)
+	}
+	cfg = config.Config{Domain: "com.apple.mail", Key: "DisableInlineAttachmentViewing"}
+	if setOrigin(configs, &cfg); cfg.Profile != "work" || cfg.SourceProfile != "" {
+		t.Errorf("Expected the work profile without a profile in its file, got %q and %q", cfg.Profile, cfg.SourceProfile)
+	}
+	cfg = config.Config{Domain: "com.apple.dock", Key: "autohide", Host: config.CurrentHost}
+	if setOrigin(configs, &cfg); cfg.Profile != "" || cfg.Source != "" {
+		t.Errorf("Expected no origin for another host, got %q from %q", cfg.Profile, cfg.Source)
+	}
+}
+
+func TestPull_KeepsHost(t *testing.T) {
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.menuextra.clock", KeyVal: "ShowSeconds", ScopeVal: defaults.Scope{Host: defaults.CurrentHost}, ReadResult: "1", ReadTypeResult: "boolean"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.menuextra.clock", KeyVal: "DateFormat", ScopeVal: defaults.Scope{Host: "studio"}, ReadError: defaults.ErrKeyNotFound},
+	}
+
+	pulled, failures, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
+	if err != nil {
+		t.Fatalf("Expected nil error, got %v", err)
+	}
+	if len(pulled) != 1 || pulled[0].Host != config.CurrentHost {
+		t.Errorf("Expected the pulled entry to keep its host, got %+v", pulled)
+	}
+	if len(failures) != 1 || failures[0].Config.Host != "studio" {
+		t.Errorf("Expected the failure to keep its host, got %+v", failures)
+	}
+}
@@ -1,10 +1,12 @@
 package pull
 
 import (
+	"context"
 	"testing"
 
 	"github.com/fumiya-kume/mdefaults/internal/config"
 	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
 func TestPullImplWithTypes(t *testing.T) {
@@ -23,7 +25,7 @@ func TestPullImplWithTypes(t *testing.T) {
 		},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -60,7 +62,7 @@ func TestPullImplWithTypeDetectionFailure(t *testing.T) {
 		},
 	}
 
-	updatedConfigs, err := PullImpl(defaultsCmds)
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -74,6 +76,69 @@ func TestPullImplWithTypeDetectionFailure(t *testing.T) {
 	}
 }
 
+func TestPullImplWithStructuredValues(t *testing.T) {
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{
+			DomainVal:      "com.apple.dock",
+			KeyVal:         "persistent-apps",
+			ReadResult:     "(\n        {\n        \"tile-data\" =         {\n            \"file-label\" = Safari;\n        };\n        \"tile-type\" = \"file-tile\";\n    }\n)\n",
+			ReadTypeResult: "array",
+		},
+		&defaults.MockDefaultsCommand{
+			DomainVal:      "com.apple.finder",
+			KeyVal:         "FXInfoPanesExpanded",
+			ReadResult:     "{\n    General = 1;\n    Preview = 0;\n}\n",
+			ReadTypeResult: "dict",
+		},
+	}
+
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(updatedConfigs) != 2 {
+		t.Fatalf("Expected 2 configs, got %d", len(updatedConfigs))
+	}
+
+	expectedValues := []string{
+		`({tile-data = {file-label = Safari;}; tile-type = file-tile;})`,
+		`{General = 1; Preview = 0;}`,
+	}
+	for i, expected := range expectedValues {
+		if *updatedConfigs[i].Value != expected {
+			t.Errorf("Expected value %s, got %s", expected, *updatedConfigs[i].Value)
+		}
+		if updatedConfigs[i].Structured == nil {
+			t.Errorf("Expected structured value for %s", updatedConfigs[i].Key)
+		}
+	}
+	if label := updatedConfigs[0].Structured.Array[0].Get("tile-data").Get("file-label"); label == nil || label.Scalar != "Safari" {
+		t.Errorf("Expected nested file-label Safari, got %+v", label)
+	}
+}
+
+func TestPullImplWithUnparsableStructuredValue(t *testing.T) {
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{
+			DomainVal:      "com.example.app",
+			KeyVal:         "blob",
+			ReadResult:     "{length = 512, bytes = 0x01020304 ... 0a0b0c0d}\n",
+			ReadTypeResult: "dict",
+		},
+	}
+
+	updatedConfigs, _, err := PullImpl(context.Background(), defaultsCmds, parallel.Limits{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updatedConfigs[0].Structured != nil {
+		t.Errorf("Expected no structured value, got %+v", updatedConfigs[0].Structured)
+	}
+	if *updatedConfigs[0].Value != "{length = 512, bytes = 0x01020304 ... 0a0b0c0d}" {
+		t.Errorf("Expected raw value to be kept, got %s", *updatedConfigs[0].Value)
+	}
+}
+
 type MockError struct{}
 
 func (e *MockError) Error() string {
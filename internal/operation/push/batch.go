@@ -0,0 +1,91 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+// importDomain writes the write and delete steps among indexes, which all
+// belong to the domain of domainCmd, with one `defaults import` of the current
+// domain merged with their changes. It returns the indexes it wrote. Nothing
+// is written, and nil is returned, when there are fewer than two changes or
+// the domain cannot be exported, merged or imported; the steps are then
+// written key by key.
+func importDomain(ctx context.Context, domainCmd defaults.DomainCommand, steps []Step, indexes []int) map[int]bool {
+	var changes []int
+	for _, i := range indexes {
+		if steps[i].Action == ActionWrite || steps[i].Action == ActionDelete {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) < 2 {
+		return nil
+	}
+
+	output, err := domainCmd.Export(ctx)
+	if err != nil {
+		log.Printf("Failed to export %s, writing keys one by one: %v", domainCmd.Domain(), err)
+		return nil
+	}
+	tree, _, err := plist.Decode(output)
+	if err == nil && tree.Type != "dict" {
+		err = fmt.Errorf("expected a dict, got %s", tree.Type)
+	}
+	if err != nil {
+		log.Printf("Failed to parse the export of %s, writing keys one by one: %v", domainCmd.Domain(), err)
+		return nil
+	}
+
+	for _, i := range changes {
+		if err := merge(tree, steps[i]); err != nil {
+			log.Printf("Failed to merge %s, writing keys one by one: %v", steps[i].Config.Key, err)
+			return nil
+		}
+	}
+	data, err := plist.FormatXML(tree)
+	if err == nil {
+		err = domainCmd.Import(ctx, data)
+	}
+	if err != nil {
+		log.Printf("Failed to import %s, writing keys one by one: %v", domainCmd.Domain(), err)
+		return nil
+	}
+
+	written := make(map[int]bool, len(changes))
+	for _, i := range changes {
+		written[i] = true
+	}
+	return written
+}
+
+// merge applies the change of a write or delete step to the domain tree the
+// way `defaults write` or `defaults delete` would.
+func merge(tree *plist.Value, step Step) error {
+	cfg := step.Config
+	if step.Action == ActionDelete {
+		tree.Delete(cfg.Key)
+		return nil
+	}
+	value, err := config.PlistValue(*cfg.Value, cfg.Type)
+	if err != nil {
+		return err
+	}
+	current := tree.Get(cfg.Key)
+	switch {
+	case cfg.Type == "array-add" && current != nil && current.Type == "array":
+		value = plist.NewArray(append(append([]*plist.Value{}, current.Array...), value.Array...)...)
+	case cfg.Type == "dict-add" && current != nil && current.Type == "dict":
+		merged := plist.NewDict(append([]plist.DictEntry{}, current.Dict...)...)
+		for _, entry := range value.Dict {
+			merged.Set(entry.Key, entry.Value)
+		}
+		value = merged
+	}
+	tree.Set(cfg.Key, value)
+	return nil
+}
@@ -0,0 +1,119 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+)
+
+const dockExport = `<plist version="1.0">
+<dict>
+	<key>autohide</key>
+	<false/>
+	<key>mru-spaces</key>
+	<true/>
+	<key>persistent-others</key>
+	<array>
+		<string>Downloads</string>
+	</array>
+</dict>
+</plist>
+`
+
+func batchSteps() ([]Step, []*defaults.MockDefaultsCommand) {
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+		{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(Applications)"), Type: "array-add"},
+	}
+	var steps []Step
+	var defaultsCmds []*defaults.MockDefaultsCommand
+	for _, cfg := range configs {
+		defaultsCmd := &defaults.MockDefaultsCommand{DomainVal: cfg.Domain, KeyVal: cfg.Key}
+		action := ActionWrite
+		if cfg.Absent {
+			action = ActionDelete
+		}
+		steps = append(steps, Step{Config: cfg, Action: action, defaultsCmd: defaultsCmd})
+		defaultsCmds = append(defaultsCmds, defaultsCmd)
+	}
+	return steps, defaultsCmds
+}
+
+func TestApply_BatchImportsMergedDomain(t *testing.T) {
+	steps, defaultsCmds := batchSteps()
+	domainCmd := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport}
+	opts := Options{Batch: true, NewDomainCmd: func(domain string, scope defaults.Scope) defaults.DomainCommand { return domainCmd }}
+
+	results := Apply(context.Background(), steps, opts)
+
+	for _, result := range results {
+		if result.Status != StatusApplied {
+			t.Errorf("Expected %s to be applied, got %s (%v)", result.Config.Key, result.Status, result.Err)
+		}
+	}
+	for _, defaultsCmd := range defaultsCmds {
+		if len(defaultsCmd.WrittenValues) != 0 || defaultsCmd.Deleted {
+			t.Errorf("Expected no per-key write for %s", defaultsCmd.KeyVal)
+		}
+	}
+	if len(domainCmd.Imported) != 1 {
+		t.Fatalf("Expected one import, got %d", len(domainCmd.Imported))
+	}
+	tree, err := plist.ParseXML(domainCmd.Imported[0])
+	if err != nil {
+		t.Fatalf("Expected an XML property list, got %v", err)
+	}
+	expected := `{autohide = 1; persistent-others = (Downloads, Applications); tilesize = 48;}`
+	if got := plist.FormatText(tree); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestApply_BatchFallsBackToPerKeyWrites(t *testing.T) {
+	testCases := []struct {
+		name      string
+		domainCmd *defaults.MockDomainCommand
+	}{
+		{"export fails", &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportError: errors.New("exit status 1")}},
+		{"import fails", &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport, ImportError: errors.New("exit status 1")}},
+		{"not a dict", &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: "<plist><array/></plist>"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, defaultsCmds := batchSteps()
+			opts := Options{Batch: true, NewDomainCmd: func(domain string, scope defaults.Scope) defaults.DomainCommand { return tc.domainCmd }}
+
+			results := Apply(context.Background(), steps, opts)
+
+			if Failed(results) {
+				t.Errorf("Expected every entry to be written, got %+v", results)
+			}
+			if len(defaultsCmds[0].WrittenValues) != 1 || !defaultsCmds[2].Deleted {
+				t.Errorf("Expected the keys to be written one by one")
+			}
+		})
+	}
+}
+
+func TestApply_BatchFallsBackOnInvalidValue(t *testing.T) {
+	steps, defaultsCmds := batchSteps()
+	steps[1].Config.Value = stringPtr("large")
+	domainCmd := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: dockExport}
+	opts := Options{Batch: true, NewDomainCmd: func(domain string, scope defaults.Scope) defaults.DomainCommand { return domainCmd }}
+
+	Apply(context.Background(), steps, opts)
+
+	if len(domainCmd.Imported) != 0 {
+		t.Errorf("Expected no import, got %d", len(domainCmd.Imported))
+	}
+	if len(defaultsCmds[1].WrittenValues) != 1 {
+		t.Errorf("Expected the invalid value to be left to defaults write")
+	}
+}
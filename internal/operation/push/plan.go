@@ -0,0 +1,129 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
+)
+
+// Action is what push does with a configuration entry.
+type Action int
+
+const (
+	// ActionWrite writes the configured value to the system.
+	ActionWrite Action = iota
+	// ActionUnchanged leaves an entry alone because the system already has
+	// the configured value and type.
+	ActionUnchanged
+	// ActionSkip ignores an entry without a value.
+	ActionSkip
+	// ActionInvalid marks an entry whose value cannot be written as its type.
+	ActionInvalid
+	// ActionDelete deletes a key that the configuration marks as absent.
+	ActionDelete
+)
+
+// Step is the planned action for one configuration entry, together with the
+// state of the entry on the system at planning time.
+type Step struct {
+	Config config.Config
+	Action Action
+	// Args are the arguments of the defaults invocation for ActionWrite and
+	// ActionDelete.
+	Args []string
+	// Exists reports whether the key could be read from the system.
+	Exists       bool
+	CurrentValue string
+	CurrentType  string
+	// Err explains why an entry is ActionInvalid.
+	Err error
+
+	defaultsCmd defaults.DefaultsCommand
+}
+
+// Command returns the defaults command line the step runs. The steps of
+// system domains run with sudo.
+func (s Step) Command() string {
+	if s.Config.System {
+		return "sudo " + defaults.FormatCommand(s.Args)
+	}
+	return defaults.FormatCommand(s.Args)
+}
+
+// Plan computes the steps that push takes for the configurations without
+// writing anything, reading several keys at the same time within limits.
+func Plan(ctx context.Context, configs []config.Config, limits parallel.Limits) ([]Step, error) {
+	defaultsCmds := make([]defaults.DefaultsCommand, 0, len(configs))
+	for i := 0; i < len(configs); i++ {
+		defaultsCmds = append(defaultsCmds, defaults.NewScopedDefaultsCommandImpl(configs[i].Domain, configs[i].Key, defaults.Scope{Host: configs[i].Host, System: configs[i].System}))
+	}
+	return PlanImpl(ctx, configs, defaultsCmds, limits)
+}
+
+// PlanImpl computes the step for each configuration using the defaults command
+// at the same index to read the current state. When ctx is cancelled PlanImpl
+// stops and returns its error.
+func PlanImpl(ctx context.Context, configs []config.Config, defaultsCmds []defaults.DefaultsCommand, limits parallel.Limits) ([]Step, error) {
+	steps := make([]Step, len(configs))
+	err := limits.Each(ctx, len(configs), func(ctx context.Context, i int) {
+		steps[i] = planStep(ctx, configs[i], defaultsCmds[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func planStep(ctx context.Context, cfg config.Config, defaultsCmd defaults.DefaultsCommand) Step {
+	step := Step{Config: cfg, defaultsCmd: defaultsCmd}
+	if cfg.Value == nil && !cfg.Absent {
+		step.Action = ActionSkip
+		return step
+	}
+
+	if value, err := defaultsCmd.Read(ctx); err == nil {
+		valueType, err := defaultsCmd.ReadType(ctx)
+		if err != nil {
+			valueType = "string"
+		}
+		step.Exists = true
+		step.CurrentValue, _ = config.NormalizeSystemValue(value, valueType)
+		step.CurrentType = valueType
+	} else if !errors.Is(err, defaults.ErrKeyNotFound) && !errors.Is(err, defaults.ErrDomainNotFound) {
+		// Without the current state the key could not be rolled back, so a
+		// key that could not be read, for example because it timed out, is
+		// not written.
+		step.Action = ActionInvalid
+		step.Err = fmt.Errorf("could not read the current value: %w", err)
+		return step
+	}
+
+	if cfg.Absent {
+		if !step.Exists {
+			step.Action = ActionUnchanged
+			return step
+		}
+		step.Action = ActionDelete
+		step.Args = defaultsCmd.DeleteArgs()
+		return step
+	}
+
+	if step.Exists && config.BaseType(cfg.Type) == step.CurrentType && config.ValuesEqual(cfg.Type, *cfg.Value, step.CurrentValue) {
+		step.Action = ActionUnchanged
+		return step
+	}
+
+	args, err := defaultsCmd.WriteArgs(*cfg.Value, cfg.Type)
+	if err != nil {
+		step.Action = ActionInvalid
+		step.Err = err
+		return step
+	}
+	step.Action = ActionWrite
+	step.Args = args
+	return step
+}
@@ -0,0 +1,385 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fumiya-kume/mdefaults/internal/config"
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
+)
+
+func TestPlanImpl(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         config.Config
+		defaultsCmd    *defaults.MockDefaultsCommand
+		expectedAction Action
+		expectedArgs   []string
+	}{
+		{
+			"unchanged boolean",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1\n", ReadTypeResult: "boolean"},
+			ActionUnchanged,
+			nil,
+		},
+		{
+			"changed integer",
+			config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "64\n", ReadTypeResult: "integer"},
+			ActionWrite,
+			[]string{"write", "com.apple.dock", "tilesize", "-int", "48"},
+		},
+		{
+			"type differs",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("1"), Type: "boolean"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1\n", ReadTypeResult: "integer"},
+			ActionWrite,
+			[]string{"write", "com.apple.dock", "autohide", "-bool", "1"},
+		},
+		{
+			"missing key",
+			config.Config{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("Path Bar"), Type: "string"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "ShowPathbar", ReadError: defaults.ErrKeyNotFound},
+			ActionWrite,
+			[]string{"write", "com.apple.finder", "ShowPathbar", "Path Bar"},
+		},
+		{
+			"array",
+			config.Config{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(a, b)"), Type: "array"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "persistent-others", ReadResult: "(\n    a\n)\n", ReadTypeResult: "array"},
+			ActionWrite,
+			[]string{"write", "com.apple.dock", "persistent-others", "-array", "a", "b"},
+		},
+		{
+			"missing domain",
+			config.Config{Domain: "com.example.app", Key: "Theme", Value: stringPtr("dark"), Type: "string"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.example.app", KeyVal: "Theme", ReadError: defaults.ErrDomainNotFound},
+			ActionWrite,
+			[]string{"write", "com.example.app", "Theme", "dark"},
+		},
+		{
+			"unreadable key",
+			config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadError: errors.New("exit status 1: Permission denied")},
+			ActionInvalid,
+			nil,
+		},
+		{
+			"unreadable absent key",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "mru-spaces", ReadError: errors.New("exit status 1: Permission denied")},
+			ActionInvalid,
+			nil,
+		},
+		{
+			"nil value",
+			config.Config{Domain: "com.apple.dock", Key: "autohide", Value: nil},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide"},
+			ActionSkip,
+			nil,
+		},
+		{
+			"absent key present",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "mru-spaces", ReadResult: "1\n", ReadTypeResult: "boolean"},
+			ActionDelete,
+			[]string{"delete", "com.apple.dock", "mru-spaces"},
+		},
+		{
+			"absent key already missing",
+			config.Config{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "mru-spaces", ReadError: defaults.ErrKeyNotFound},
+			ActionUnchanged,
+			nil,
+		},
+		{
+			"invalid array",
+			config.Config{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(a, b"), Type: "array"},
+			&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "persistent-others", ReadError: defaults.ErrKeyNotFound},
+			ActionInvalid,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps := planImpl(t, []config.Config{tc.config}, []defaults.DefaultsCommand{tc.defaultsCmd})
+			if len(steps) != 1 {
+				t.Fatalf("Expected 1 step, got %d", len(steps))
+			}
+			if steps[0].Action != tc.expectedAction {
+				t.Errorf("Expected action %d, got %d", tc.expectedAction, steps[0].Action)
+			}
+			if !reflect.DeepEqual(steps[0].Args, tc.expectedArgs) {
+				t.Errorf("Expected args %q, got %q", tc.expectedArgs, steps[0].Args)
+			}
+			if tc.expectedAction == ActionInvalid && steps[0].Err == nil {
+				t.Error("Expected an error for an invalid step")
+			}
+			if len(tc.defaultsCmd.WrittenValues) != 0 {
+				t.Errorf("Expected planning not to write, got %q", tc.defaultsCmd.WrittenValues)
+			}
+		})
+	}
+}
+
+func TestPlanImpl_RecordsCurrentState(t *testing.T) {
+	configs := []config.Config{{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"}}
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "64\n", ReadTypeResult: "integer"},
+	}
+
+	step := planImpl(t, configs, defaultsCmds)[0]
+
+	if !step.Exists || step.CurrentValue != "64" || step.CurrentType != "integer" {
+		t.Errorf("Expected current state 64 integer, got exists=%v %q %s", step.Exists, step.CurrentValue, step.CurrentType)
+	}
+}
+
+func TestStepCommand(t *testing.T) {
+	step := Step{Args: []string{"write", "com.apple.screencapture", "location", "/Users/me/Application Support", "-array", "it's"}}
+
+	expected := `defaults write com.apple.screencapture location '/Users/me/Application Support' -array 'it'\''s'`
+	if command := step.Command(); command != expected {
+		t.Errorf("Expected %s, got %s", expected, command)
+	}
+}
+
+func TestApply_WritesOnlyChangedEntries(t *testing.T) {
+	unchanged := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1\n", ReadTypeResult: "boolean"}
+	changed := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "64\n", ReadTypeResult: "integer"}
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+	}
+
+	Apply(context.Background(), planImpl(t, configs, []defaults.DefaultsCommand{unchanged, changed}), Options{})
+
+	if len(unchanged.WrittenValues) != 0 {
+		t.Errorf("Expected unchanged entry not to be written, got %q", unchanged.WrittenValues)
+	}
+	if !reflect.DeepEqual(changed.WrittenValues, []string{"48"}) {
+		t.Errorf("Expected changed entry to be written once, got %q", changed.WrittenValues)
+	}
+}
+
+func TestApply_Results(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "orientation", Value: nil},
+		{Domain: "com.apple.dock", Key: "persistent-others", Value: stringPtr("(a, b"), Type: "array"},
+		{Domain: "com.apple.finder", Key: "ShowPathbar", Value: stringPtr("1"), Type: "boolean"},
+		{Domain: "com.apple.finder", Key: "NewWindowTarget", Value: stringPtr("PfHm")},
+	}
+	writeErr := errors.New("write error")
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1\n", ReadTypeResult: "boolean"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "64\n", ReadTypeResult: "integer"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "orientation"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "persistent-others", ReadError: defaults.ErrKeyNotFound},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "ShowPathbar", ReadError: defaults.ErrKeyNotFound, WriteTypeError: writeErr},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "NewWindowTarget", ReadError: defaults.ErrKeyNotFound},
+	}
+
+	results := Apply(context.Background(), planImpl(t, configs, defaultsCmds), Options{})
+
+	expected := []Status{StatusUnchanged, StatusApplied, StatusSkipped, StatusFailed, StatusFailed, StatusApplied}
+	for i, status := range expected {
+		if results[i].Status != status {
+			t.Errorf("Expected %s for %s, got %s", status, results[i].Config.Key, results[i].Status)
+		}
+	}
+	if !errors.Is(results[4].Err, writeErr) {
+		t.Errorf("Expected the write error as cause, got %v", results[4].Err)
+	}
+	if !Failed(results) {
+		t.Error("Expected Failed to report the failures")
+	}
+}
+
+func TestApply_FailFast(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.dock", Key: "autohide", Value: stringPtr("true"), Type: "boolean"},
+	}
+	first := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadError: defaults.ErrKeyNotFound, WriteTypeError: errors.New("write error")}
+	second := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadError: defaults.ErrKeyNotFound}
+
+	results := Apply(context.Background(), planImpl(t, configs, []defaults.DefaultsCommand{first, second}), Options{FailFast: true, Limits: parallel.Limits{Jobs: 1}})
+
+	if results[0].Status != StatusFailed {
+		t.Errorf("Expected first entry to fail, got %s", results[0].Status)
+	}
+	if results[1].Status != StatusSkipped || !errors.Is(results[1].Err, ErrNotAttempted) {
+		t.Errorf("Expected second entry not to be attempted, got %s (%v)", results[1].Status, results[1].Err)
+	}
+	if len(second.WrittenValues) != 0 {
+		t.Errorf("Expected no write after the failure, got %q", second.WrittenValues)
+	}
+}
+
+func TestApply_DeletesAbsentEntries(t *testing.T) {
+	present := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "mru-spaces", ReadResult: "1\n", ReadTypeResult: "boolean"}
+	configs := []config.Config{{Domain: "com.apple.dock", Key: "mru-spaces", Absent: true}}
+
+	results := Apply(context.Background(), planImpl(t, configs, []defaults.DefaultsCommand{present}), Options{})
+
+	if !present.Deleted {
+		t.Error("Expected the key to be deleted")
+	}
+	if results[0].Status != StatusApplied {
+		t.Errorf("Expected applied, got %s", results[0].Status)
+	}
+}
+
+func TestApply_Interrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	defaultsCmd := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadError: defaults.ErrKeyNotFound}
+	steps := []Step{{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48")}, Action: ActionWrite, defaultsCmd: defaultsCmd}}
+
+	results := Apply(ctx, steps, Options{})
+
+	if results[0].Status != StatusSkipped || !errors.Is(results[0].Err, ErrInterrupted) {
+		t.Errorf("Expected the entry to be skipped as interrupted, got %s (%v)", results[0].Status, results[0].Err)
+	}
+	if len(defaultsCmd.WrittenValues) != 0 {
+		t.Errorf("Expected no write after the cancellation, got %q", defaultsCmd.WrittenValues)
+	}
+}
+
+func TestApply_WritesSameKeyInOrder(t *testing.T) {
+	defaultsCmd := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize"}
+	var steps []Step
+	for _, value := range []string{"16", "32", "48"} {
+		steps = append(steps, Step{Config: config.Config{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr(value)}, Action: ActionWrite, defaultsCmd: defaultsCmd})
+	}
+
+	Apply(context.Background(), steps, Options{Limits: parallel.Limits{Jobs: 3}})
+
+	if !reflect.DeepEqual(defaultsCmd.WrittenValues, []string{"16", "32", "48"}) {
+		t.Errorf("Expected the writes in configuration order, got %q", defaultsCmd.WrittenValues)
+	}
+}
+
+func TestPlanImpl_HostCommands(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.menuextra.clock", Key: "ShowSeconds", Value: stringPtr("1"), Type: "boolean", Host: config.CurrentHost},
+		{Domain: "com.apple.menuextra.clock", Key: "ShowSeconds", Absent: true, Host: "studio"},
+	}
+	cmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.menuextra.clock", KeyVal: "ShowSeconds", ScopeVal: defaults.Scope{Host: config.CurrentHost}, ReadResult: "0", ReadTypeResult: "boolean"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.menuextra.clock", KeyVal: "ShowSeconds", ScopeVal: defaults.Scope{Host: "studio"}, ReadResult: "0", ReadTypeResult: "boolean"},
+	}
+
+	steps := planImpl(t, configs, cmds)
+
+	expected := []string{
+		"defaults -currentHost write com.apple.menuextra.clock ShowSeconds -bool 1",
+		"defaults -host studio delete com.apple.menuextra.clock ShowSeconds",
+	}
+	for i, step := range steps {
+		if step.Command() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], step.Command())
+		}
+	}
+	if groups := groupByKey(steps, nil); len(groups) != 2 {
+		t.Errorf("Expected the hosts to be written separately, got %v", groups)
+	}
+}
+
+func TestPlanImpl_TimedOutReadIsInvalid(t *testing.T) {
+	configs := []config.Config{{Domain: "com.example.hung", Key: "key", Value: stringPtr("1")}}
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.example.hung", KeyVal: "key", ReadDelay: time.Minute},
+	}
+
+	steps, err := PlanImpl(context.Background(), configs, defaultsCmds, parallel.Limits{Timeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if steps[0].Action != ActionInvalid {
+		t.Errorf("Expected a key that timed out not to be written, got %v", steps[0].Action)
+	}
+}
+
+// planImpl plans configs with the default limits and fails t on error.
+func planImpl(t *testing.T, configs []config.Config, defaultsCmds []defaults.DefaultsCommand) []Step {
+	t.Helper()
+	steps, err := PlanImpl(context.Background(), configs, defaultsCmds, parallel.Limits{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return steps
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestApply_WritesSystemDomainsWithOnePrivilegedRun(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.loginwindow", Key: "SHOWFULLNAME", Value: stringPtr("1"), Type: "boolean", System: true},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Absent: true, System: true},
+	}
+	cmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "SHOWFULLNAME", ScopeVal: defaults.Scope{System: true}, ReadResult: "0", ReadTypeResult: "boolean"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "36", ReadTypeResult: "integer"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "GuestEnabled", ScopeVal: defaults.Scope{System: true}, ReadResult: "1", ReadTypeResult: "boolean"},
+	}
+	steps := planImpl(t, configs, cmds)
+	if expected := "sudo defaults write /Library/Preferences/com.apple.loginwindow SHOWFULLNAME -bool 1"; steps[0].Command() != expected {
+		t.Errorf("Expected %s, got %s", expected, steps[0].Command())
+	}
+	runner := &defaults.MockPrivilegedRunner{Errors: []error{nil, errors.New("exit status 1: Permission denied")}}
+
+	results := Apply(context.Background(), steps, Options{Privileged: runner})
+
+	if len(runner.Invocations) != 1 || len(runner.Invocations[0]) != 2 {
+		t.Fatalf("Expected both system entries in one privileged run, got %q", runner.Invocations)
+	}
+	if !reflect.DeepEqual(runner.Invocations[0][1], []string{"delete", "/Library/Preferences/com.apple.loginwindow", "GuestEnabled"}) {
+		t.Errorf("Expected the delete of GuestEnabled, got %q", runner.Invocations[0][1])
+	}
+	expected := []Status{StatusApplied, StatusApplied, StatusFailed}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			t.Errorf("Expected %s to be %s, got %s (%v)", result.Config.Key, expected[i], result.Status, result.Err)
+		}
+	}
+	if len(cmds[0].(*defaults.MockDefaultsCommand).WrittenValues) != 0 {
+		t.Error("Expected the system entry not to be written without privileges")
+	}
+	if len(cmds[1].(*defaults.MockDefaultsCommand).WrittenValues) != 1 {
+		t.Error("Expected the user entry to be written as usual")
+	}
+}
+
+func TestApply_PrivilegedFailureStopsFailFast(t *testing.T) {
+	configs := []config.Config{
+		{Domain: "com.apple.loginwindow", Key: "SHOWFULLNAME", Value: stringPtr("1"), Type: "boolean", System: true},
+		{Domain: "com.apple.dock", Key: "tilesize", Value: stringPtr("48"), Type: "integer"},
+	}
+	cmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "SHOWFULLNAME", ScopeVal: defaults.Scope{System: true}, ReadError: defaults.ErrKeyNotFound},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", ReadResult: "36", ReadTypeResult: "integer"},
+	}
+	steps := planImpl(t, configs, cmds)
+	runner := &defaults.MockPrivilegedRunner{Errors: []error{defaults.ErrPrivilegesRequired}}
+
+	results := Apply(context.Background(), steps, Options{Privileged: runner, FailFast: true})
+
+	if results[0].Status != StatusFailed || !errors.Is(results[0].Err, defaults.ErrPrivilegesRequired) {
+		t.Errorf("Expected the system entry to fail with ErrPrivilegesRequired, got %s (%v)", results[0].Status, results[0].Err)
+	}
+	if results[1].Status != StatusSkipped || !errors.Is(results[1].Err, ErrNotAttempted) {
+		t.Errorf("Expected the user entry to be skipped, got %s (%v)", results[1].Status, results[1].Err)
+	}
+}
@@ -2,29 +2,301 @@ package push
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sync/atomic"
 
 	"github.com/fumiya-kume/mdefaults/internal/config"
 	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/parallel"
 )
 
-// Push writes the provided configurations to the system defaults.
-func Push(configs []config.Config) {
-	for _, cfg := range configs {
-		if cfg.Value == nil {
-			log.Printf("Skipping %s: Value is nil", cfg.Key)
-			continue
+// Status is the outcome of pushing one configuration entry.
+type Status int
+
+const (
+	// StatusApplied means the configured value was written, or the key was
+	// deleted for an absent entry.
+	StatusApplied Status = iota
+	// StatusUnchanged means the system already had the configured value.
+	StatusUnchanged
+	// StatusSkipped means the entry was not written, either because it has no
+	// value or because an earlier failure stopped a fail-fast push.
+	StatusSkipped
+	// StatusFailed means the entry could not be written.
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusApplied:
+		return "applied"
+	case StatusUnchanged:
+		return "unchanged"
+	case StatusSkipped:
+		return "skipped"
+	case StatusFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// ErrNotAttempted is the cause of entries skipped by a fail-fast push after an
+// earlier entry failed.
+var ErrNotAttempted = errors.New("not attempted after an earlier failure")
+
+// ErrInterrupted is the cause of entries skipped because push was cancelled
+// before writing them.
+var ErrInterrupted = errors.New("not attempted, push was interrupted")
+
+// errNoValue is the cause of entries skipped because they have no value.
+var errNoValue = errors.New("value is nil")
+
+// Result is the outcome of pushing one configuration entry. Err explains why
+// an entry was skipped or failed.
+type Result struct {
+	Config config.Config
+	Status Status
+	Err    error
+}
+
+// Options control how push reacts to failures and how many entries it writes
+// at the same time.
+type Options struct {
+	// FailFast stops writing once an entry failed. Entries that are already
+	// being written finish; run with one job for a strict order.
+	FailFast bool
+	// Limits bound the number of entries written at the same time and how
+	// long each write may take.
+	Limits parallel.Limits
+	// Batch writes the changes to each domain with a single `defaults import`
+	// of the merged domain, so that a domain is either fully updated or left
+	// as it was. Domains that cannot be exported or imported are written key
+	// by key.
+	Batch bool
+	// NewDomainCmd returns the command Batch exports and imports a domain in
+	// a scope with. defaults.NewScopedDomainCommandImpl is used when it is
+	// nil.
+	NewDomainCmd func(domain string, scope defaults.Scope) defaults.DomainCommand
+	// Privileged writes the entries of system domains, all at once before
+	// the other entries. defaults.SudoRunner is used when it is nil.
+	Privileged defaults.PrivilegedRunner
+}
+
+// Push writes the provided configurations to the system defaults. Entries that
+// already have the configured value are left untouched.
+func Push(configs []config.Config) []Result {
+	steps, _ := Plan(context.Background(), configs, parallel.Limits{})
+	return Apply(context.Background(), steps, Options{})
+}
+
+// Apply runs the write steps of a plan and returns one result per step, in the
+// order of steps. Steps for the same domain and key are written one after the
+// other in that order; other steps are written concurrently within
+// opts.Limits. With opts.Batch the steps of a domain are written together.
+// The changes to system domains are written first, with a single privileged
+// invocation. Once ctx is cancelled the steps not started yet are skipped
+// with ErrInterrupted.
+func Apply(ctx context.Context, steps []Step, opts Options) []Result {
+	results := make([]Result, len(steps))
+	var failed atomic.Bool
+	privileged := applyPrivileged(ctx, steps, opts, results)
+	for i := range privileged {
+		if results[i].Status == StatusFailed {
+			failed.Store(true)
+		}
+	}
+
+	groups := groupByKey(steps, privileged)
+	if opts.Batch {
+		groups = groupByDomain(steps, privileged)
+	}
+	started := make([]bool, len(groups))
+	// The error is ctx's, which the skipped steps report below.
+	_ = opts.Limits.Each(ctx, len(groups), func(keyCtx context.Context, g int) {
+		started[g] = true
+		var imported map[int]bool
+		if opts.Batch && ctx.Err() == nil && !(opts.FailFast && failed.Load()) {
+			cfg := steps[groups[g][0]].Config
+			imported = importDomain(keyCtx, opts.newDomainCmd(cfg.Domain, defaults.Scope{Host: cfg.Host, System: cfg.System}), steps, groups[g])
 		}
-		defaults := defaults.NewDefaultsCommandImpl(cfg.Domain, cfg.Key)
-		
-		if cfg.Type != "" && cfg.Type != "string" {
-			if err := defaults.WriteWithType(context.Background(), *cfg.Value, cfg.Type); err != nil {
-				log.Printf("Failed to write typed defaults for %s: %v", cfg.Key, err)
+		for _, i := range groups[g] {
+			if imported[i] {
+				results[i] = Result{Config: steps[i].Config, Status: StatusApplied}
+				continue
 			}
-		} else {
-			if err := defaults.Write(context.Background(), *cfg.Value); err != nil {
-				log.Printf("Failed to write defaults for %s: %v", cfg.Key, err)
+			var stop error
+			switch {
+			case ctx.Err() != nil:
+				stop = ErrInterrupted
+			case opts.FailFast && failed.Load():
+				stop = ErrNotAttempted
 			}
+			results[i] = apply(keyCtx, steps[i], stop)
+			if results[i].Status == StatusFailed {
+				failed.Store(true)
+			}
+		}
+	})
+	for g, group := range groups {
+		if started[g] {
+			continue
+		}
+		for _, i := range group {
+			results[i] = apply(ctx, steps[i], ErrInterrupted)
+		}
+	}
+	return results
+}
+
+func (o Options) newDomainCmd(domain string, scope defaults.Scope) defaults.DomainCommand {
+	if o.NewDomainCmd == nil {
+		return defaults.NewScopedDomainCommandImpl(domain, scope)
+	}
+	return o.NewDomainCmd(domain, scope)
+}
+
+// stepKey identifies the domain, or the key, of a step in its scope.
+type stepKey struct {
+	scope       defaults.Scope
+	domain, key string
+}
+
+// groupByKey returns the indexes of steps grouped by scope, domain and key, in
+// the order each key first appears. Indexes in skip are left out.
+func groupByKey(steps []Step, skip map[int]bool) [][]int {
+	return groupBy(steps, skip, func(cfg config.Config) stepKey {
+		return stepKey{defaults.Scope{Host: cfg.Host, System: cfg.System}, cfg.Domain, cfg.Key}
+	})
+}
+
+// groupByDomain returns the indexes of steps grouped by scope and domain, in
+// the order each domain first appears. Indexes in skip are left out.
+func groupByDomain(steps []Step, skip map[int]bool) [][]int {
+	return groupBy(steps, skip, func(cfg config.Config) stepKey {
+		return stepKey{scope: defaults.Scope{Host: cfg.Host, System: cfg.System}, domain: cfg.Domain}
+	})
+}
+
+func groupBy(steps []Step, skip map[int]bool, keyOf func(config.Config) stepKey) [][]int {
+	var groups [][]int
+	index := map[stepKey]int{}
+	for i, step := range steps {
+		if skip[i] {
+			continue
+		}
+		key := keyOf(step.Config)
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// applyPrivileged writes the write and delete steps of system domains with
+// one run of the privileged runner of opts and records their results. It
+// returns the indexes of the steps it handled.
+func applyPrivileged(ctx context.Context, steps []Step, opts Options, results []Result) map[int]bool {
+	var indexes []int
+	var invocations [][]string
+	for i, step := range steps {
+		if step.Config.System && (step.Action == ActionWrite || step.Action == ActionDelete) {
+			indexes = append(indexes, i)
+			invocations = append(invocations, step.Args)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	handled := make(map[int]bool, len(indexes))
+	if ctx.Err() != nil {
+		for _, i := range indexes {
+			results[i] = apply(ctx, steps[i], ErrInterrupted)
+			handled[i] = true
+		}
+		return handled
+	}
+	errs := opts.privileged().Run(ctx, invocations)
+	for j, i := range indexes {
+		results[i] = Result{Config: steps[i].Config, Status: StatusApplied}
+		if errs[j] != nil {
+			log.Printf("Failed to write system defaults for %s: %v", steps[i].Config.Key, errs[j])
+			results[i].Status = StatusFailed
+			results[i].Err = errs[j]
+		}
+		handled[i] = true
+	}
+	return handled
+}
+
+func (o Options) privileged() defaults.PrivilegedRunner {
+	if o.Privileged == nil {
+		return defaults.SudoRunner{}
+	}
+	return o.Privileged
+}
+
+// apply runs one step. A non-nil stop skips the write with that cause.
+func apply(ctx context.Context, step Step, stop error) Result {
+	result := Result{Config: step.Config}
+	switch {
+	case step.Action == ActionUnchanged:
+		result.Status = StatusUnchanged
+	case step.Action == ActionSkip:
+		log.Printf("Skipping %s: Value is nil", step.Config.Key)
+		result.Status = StatusSkipped
+		result.Err = errNoValue
+	case stop != nil:
+		result.Status = StatusSkipped
+		result.Err = stop
+	case step.Action == ActionInvalid:
+		log.Printf("Skipping %s: %v", step.Config.Key, step.Err)
+		result.Status = StatusFailed
+		result.Err = step.Err
+	default:
+		result.Err = write(ctx, step)
+		result.Status = StatusApplied
+		if result.Err != nil {
+			result.Status = StatusFailed
+		}
+	}
+	return result
+}
+
+func write(ctx context.Context, step Step) error {
+	cfg := step.Config
+	if step.Action == ActionDelete {
+		if err := step.defaultsCmd.Delete(ctx); err != nil {
+			log.Printf("Failed to delete defaults for %s: %v", cfg.Key, err)
+			return err
+		}
+		return nil
+	}
+	if cfg.Type != "" && cfg.Type != "string" {
+		if err := step.defaultsCmd.WriteWithType(ctx, *cfg.Value, cfg.Type); err != nil {
+			log.Printf("Failed to write typed defaults for %s: %v", cfg.Key, err)
+			return err
+		}
+		return nil
+	}
+	if err := step.defaultsCmd.Write(ctx, *cfg.Value); err != nil {
+		log.Printf("Failed to write defaults for %s: %v", cfg.Key, err)
+		return err
+	}
+	return nil
+}
+
+// Failed reports whether any result is StatusFailed.
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			return true
 		}
 	}
+	return false
 }
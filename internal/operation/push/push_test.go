@@ -32,13 +32,17 @@ func TestPush_EmptyConfigs(t *testing.T) {
 	configs := []config.Config{}
 
 	// Capture the output
+	var results []Result
 	output := captureOutput(func() {
-		Push(configs)
+		results = Push(configs)
 	})
 
 	if output != "" {
 		t.Errorf("Expected no output, got %s", output)
 	}
+	if len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
 }
 
 func TestPush_InvalidConfig(t *testing.T) {
@@ -47,13 +51,17 @@ func TestPush_InvalidConfig(t *testing.T) {
 	}
 
 	// Capture the output
+	var results []Result
 	output := captureOutput(func() {
-		Push(configs)
+		results = Push(configs)
 	})
 
 	if output != "" {
 		t.Errorf("Expected no output, got %s", output)
 	}
+	if len(results) != 1 || results[0].Status != StatusSkipped {
+		t.Errorf("Expected the entry to be skipped, got %+v", results)
+	}
 }
 
 func TestPush_MaxConfigs(t *testing.T) {
@@ -0,0 +1,18 @@
+package restart
+
+import (
+	"context"
+)
+
+// MockCommand is a mock implementation of the Command interface for testing.
+type MockCommand struct {
+	// Errors holds the error to return for each process.
+	Errors map[string]error
+	// Restarted records the processes Restart was called with.
+	Restarted []string
+}
+
+func (m *MockCommand) Restart(ctx context.Context, process string) error {
+	m.Restarted = append(m.Restarted, process)
+	return m.Errors[process]
+}
@@ -0,0 +1,92 @@
+// Package restart restarts the processes that only pick up changed defaults
+// when they are relaunched, such as the Dock and the Finder.
+package restart
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// builtinProcesses maps the domains of well-known system components to the
+// processes that read them at launch.
+var builtinProcesses = map[string][]string{
+	"com.apple.dock":            {"Dock"},
+	"com.apple.spaces":          {"Dock"},
+	"com.apple.finder":          {"Finder"},
+	"com.apple.systemuiserver":  {"SystemUIServer"},
+	"com.apple.menuextra.clock": {"SystemUIServer"},
+	"com.apple.screencapture":   {"SystemUIServer"},
+	"com.apple.controlcenter":   {"ControlCenter"},
+}
+
+// Map maps domains to the processes to restart after they changed.
+type Map map[string][]string
+
+// NewMap returns the built-in mapping with overrides applied. An override
+// replaces the processes of its domain; an empty one means the domain needs
+// no restart.
+func NewMap(overrides map[string][]string) Map {
+	m := Map{}
+	for domain, processes := range builtinProcesses {
+		m[domain] = processes
+	}
+	for domain, processes := range overrides {
+		m[domain] = processes
+	}
+	return m
+}
+
+// Processes returns the processes to restart after domains changed, each once
+// and in the order their domains are given.
+func (m Map) Processes(domains []string) []string {
+	var processes []string
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		for _, process := range m[domain] {
+			if !seen[process] {
+				seen[process] = true
+				processes = append(processes, process)
+			}
+		}
+	}
+	return processes
+}
+
+// Command restarts a process.
+type Command interface {
+	Restart(ctx context.Context, process string) error
+}
+
+// CommandImpl restarts processes with killall. launchd relaunches the Dock,
+// the Finder and SystemUIServer right away.
+type CommandImpl struct{}
+
+// Restart runs `killall <process>`.
+func (CommandImpl) Restart(ctx context.Context, process string) error {
+	output, err := exec.CommandContext(ctx, "killall", process).CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+// Result is the outcome of restarting one process.
+type Result struct {
+	Process string
+	Err     error
+}
+
+// Restart restarts processes one after the other and returns one result per
+// process.
+func Restart(ctx context.Context, cmd Command, processes []string) []Result {
+	results := make([]Result, 0, len(processes))
+	for _, process := range processes {
+		results = append(results, Result{Process: process, Err: cmd.Restart(ctx, process)})
+	}
+	return results
+}
@@ -0,0 +1,47 @@
+package restart
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMap_Processes(t *testing.T) {
+	m := NewMap(map[string][]string{
+		"com.apple.finder": {},
+		"com.example.app":  {"ExampleApp", "Dock"},
+	})
+
+	processes := m.Processes([]string{"com.apple.dock", "com.apple.finder", "com.example.app", "com.apple.spaces", "com.example.unknown"})
+
+	expected := []string{"Dock", "ExampleApp"}
+	if !reflect.DeepEqual(processes, expected) {
+		t.Errorf("Expected %v, got %v", expected, processes)
+	}
+}
+
+func TestMap_Builtin(t *testing.T) {
+	m := NewMap(nil)
+
+	processes := m.Processes([]string{"com.apple.finder", "com.apple.menuextra.clock"})
+
+	expected := []string{"Finder", "SystemUIServer"}
+	if !reflect.DeepEqual(processes, expected) {
+		t.Errorf("Expected %v, got %v", expected, processes)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	notRunning := errors.New("No matching processes belonging to you were found")
+	cmd := &MockCommand{Errors: map[string]error{"Finder": notRunning}}
+
+	results := Restart(context.Background(), cmd, []string{"Dock", "Finder"})
+
+	if !reflect.DeepEqual(cmd.Restarted, []string{"Dock", "Finder"}) {
+		t.Errorf("Expected Dock and Finder to be restarted, got %v", cmd.Restarted)
+	}
+	if results[0].Err != nil || !errors.Is(results[1].Err, notRunning) {
+		t.Errorf("Expected only the Finder to fail, got %+v", results)
+	}
+}
@@ -0,0 +1,205 @@
+package rollback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/plist"
+	"github.com/fumiya-kume/mdefaults/internal/snapshot"
+)
+
+// Result is the outcome of restoring one snapshot entry.
+type Result struct {
+	Entry snapshot.Entry
+	// Deleted reports whether the key was removed because it did not exist
+	// when the snapshot was taken.
+	Deleted bool
+	Err     error
+}
+
+// errContainerText is returned for array and dict entries of snapshots that
+// only hold the text of the value. Writing it back would turn every nested
+// number, boolean, date and data value into a string.
+var errContainerText = errors.New("the snapshot holds this value only as text, which would turn its nested numbers and booleans into strings; restore it by hand")
+
+// errSystemContainer is returned for array and dict entries of system domains,
+// which can only be restored exactly by importing the domain as root.
+var errSystemContainer = errors.New("array and dict values of system domains cannot be restored exactly; restore it by hand with sudo defaults import")
+
+// Rollback restores the keys recorded in a snapshot to their previous values.
+// The keys of system domains are restored with a single run of privileged.
+func Rollback(s *snapshot.Snapshot, privileged defaults.PrivilegedRunner) []Result {
+	defaultsCmds := make([]defaults.DefaultsCommand, 0, len(s.Entries))
+	domainCmds := make([]defaults.DomainCommand, 0, len(s.Entries))
+	for _, entry := range s.Entries {
+		scope := defaults.Scope{Host: entry.Host, System: entry.System}
+		defaultsCmds = append(defaultsCmds, defaults.NewScopedDefaultsCommandImpl(entry.Domain, entry.Key, scope))
+		domainCmds = append(domainCmds, defaults.NewScopedDomainCommandImpl(entry.Domain, scope))
+	}
+	return RollbackImpl(s, defaultsCmds, domainCmds, privileged)
+}
+
+// RollbackImpl restores each snapshot entry using the defaults and domain
+// commands at the same index. Entries are restored in reverse order so that
+// when a key was recorded more than once, its earliest state wins. Array and
+// dict values are restored with one `defaults import` of their domain, so
+// that nested values keep their types. The other entries of system domains
+// are restored next, all in one run of privileged, followed by the remaining
+// entries key by key.
+func RollbackImpl(s *snapshot.Snapshot, defaultsCmds []defaults.DefaultsCommand, domainCmds []defaults.DomainCommand, privileged defaults.PrivilegedRunner) []Result {
+	results := make([]Result, len(s.Entries))
+	restored := restoreContainers(s, domainCmds, results)
+	restorePrivileged(s, defaultsCmds, privileged, results, restored)
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		if !s.Entries[i].System && !restored[i] {
+			results[i] = restore(s.Entries[i], defaultsCmds[i])
+		}
+	}
+	return results
+}
+
+// isContainer reports whether entry held an array or dict value.
+func isContainer(entry snapshot.Entry) bool {
+	return entry.Exists && (entry.Type == "array" || entry.Type == "dict")
+}
+
+// domainKey identifies the preferences a domain command imports.
+type domainKey struct {
+	domain, host string
+	system       bool
+}
+
+// restoreContainers restores the array and dict entries with one import of
+// the current domain merged with their recorded values, and records their
+// results. It returns the indexes it handled.
+func restoreContainers(s *snapshot.Snapshot, domainCmds []defaults.DomainCommand, results []Result) map[int]bool {
+	handled := map[int]bool{}
+	groups := map[domainKey][]int{}
+	var order []domainKey
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		entry := s.Entries[i]
+		if !isContainer(entry) {
+			continue
+		}
+		handled[i] = true
+		results[i] = Result{Entry: entry}
+		switch {
+		case entry.Plist == "":
+			results[i].Err = errContainerText
+			continue
+		case entry.System:
+			results[i].Err = errSystemContainer
+			continue
+		}
+		key := domainKey{domain: entry.Domain, host: entry.Host}
+		if groups[key] == nil {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range order {
+		indexes := groups[key]
+		err := importValues(s, domainCmds[indexes[0]], indexes)
+		if err != nil {
+			log.Printf("Failed to restore %s: %v", key.domain, err)
+		}
+		for _, i := range indexes {
+			results[i].Err = err
+		}
+	}
+	return handled
+}
+
+// importValues sets the recorded values of the entries at indexes, in that
+// order, in the exported domain of domainCmd and imports it back.
+func importValues(s *snapshot.Snapshot, domainCmd defaults.DomainCommand, indexes []int) error {
+	ctx := context.Background()
+	output, err := domainCmd.Export(ctx)
+	if err != nil {
+		return err
+	}
+	tree, _, err := plist.Decode(output)
+	if err == nil && tree.Type != "dict" {
+		err = fmt.Errorf("expected a dict, got %s", tree.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse the export of %s: %w", domainCmd.Domain(), err)
+	}
+	for _, i := range indexes {
+		value, _, err := plist.Decode([]byte(s.Entries[i].Plist))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s in the snapshot: %w", s.Entries[i].Key, err)
+		}
+		tree.Set(s.Entries[i].Key, value)
+	}
+	data, err := plist.FormatXML(tree)
+	if err != nil {
+		return err
+	}
+	return domainCmd.Import(ctx, data)
+}
+
+// restorePrivileged restores the entries of system domains that are not in
+// restored with one run of privileged and records their results.
+func restorePrivileged(s *snapshot.Snapshot, defaultsCmds []defaults.DefaultsCommand, privileged defaults.PrivilegedRunner, results []Result, restored map[int]bool) {
+	var indexes []int
+	var invocations [][]string
+	for i := len(s.Entries) - 1; i >= 0; i-- {
+		entry := s.Entries[i]
+		if !entry.System || restored[i] {
+			continue
+		}
+		results[i] = Result{Entry: entry}
+		var args []string
+		if !entry.Exists {
+			results[i].Deleted = true
+			if _, err := defaultsCmds[i].Read(context.Background()); err != nil {
+				continue
+			}
+			args = defaultsCmds[i].DeleteArgs()
+		} else {
+			var err error
+			if args, err = defaultsCmds[i].WriteArgs(entry.Value, entry.Type); err != nil {
+				results[i].Err = err
+				continue
+			}
+		}
+		indexes = append(indexes, i)
+		invocations = append(invocations, args)
+	}
+	if len(invocations) == 0 {
+		return
+	}
+
+	errs := privileged.Run(context.Background(), invocations)
+	for j, i := range indexes {
+		if errs[j] != nil {
+			log.Printf("Failed to restore system defaults for %s: %v", s.Entries[i].Key, errs[j])
+			results[i].Err = errs[j]
+		}
+	}
+}
+
+func restore(entry snapshot.Entry, defaultsCmd defaults.DefaultsCommand) Result {
+	ctx := context.Background()
+	result := Result{Entry: entry}
+	if !entry.Exists {
+		result.Deleted = true
+		if _, err := defaultsCmd.Read(ctx); err != nil {
+			// Already absent, e.g. because the write failed during push.
+			return result
+		}
+		result.Err = defaultsCmd.Delete(ctx)
+		return result
+	}
+	if entry.Type != "" && entry.Type != "string" {
+		result.Err = defaultsCmd.WriteWithType(ctx, entry.Value, entry.Type)
+	} else {
+		result.Err = defaultsCmd.Write(ctx, entry.Value)
+	}
+	return result
+}
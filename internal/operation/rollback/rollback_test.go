@@ -0,0 +1,154 @@
+package rollback
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fumiya-kume/mdefaults/internal/defaults"
+	"github.com/fumiya-kume/mdefaults/internal/snapshot"
+)
+
+func TestRollbackImpl(t *testing.T) {
+	typed := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize"}
+	plain := &defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "NewWindowTarget"}
+	created := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadResult: "1\n"}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{
+		{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"},
+		{Domain: "com.apple.finder", Key: "NewWindowTarget", Exists: true, Value: "PfHm", Type: "string"},
+		{Domain: "com.apple.dock", Key: "autohide", Exists: false},
+	}}
+
+	results := RollbackImpl(s, []defaults.DefaultsCommand{typed, plain, created}, make([]defaults.DomainCommand, 3), &defaults.MockPrivilegedRunner{})
+
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("Expected no error for %s, got %v", result.Entry.Key, result.Err)
+		}
+	}
+	if !reflect.DeepEqual(typed.WrittenValues, []string{"64"}) || typed.Deleted {
+		t.Errorf("Expected tilesize to be restored to 64, got %q", typed.WrittenValues)
+	}
+	if !reflect.DeepEqual(plain.WrittenValues, []string{"PfHm"}) {
+		t.Errorf("Expected NewWindowTarget to be restored to PfHm, got %q", plain.WrittenValues)
+	}
+	if !created.Deleted || !results[2].Deleted {
+		t.Error("Expected autohide to be deleted")
+	}
+}
+
+func TestRollbackImpl_AlreadyAbsentKeyIsNotDeleted(t *testing.T) {
+	absent := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "autohide", ReadError: errors.New("does not exist")}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{{Domain: "com.apple.dock", Key: "autohide", Exists: false}}}
+
+	results := RollbackImpl(s, []defaults.DefaultsCommand{absent}, make([]defaults.DomainCommand, 1), &defaults.MockPrivilegedRunner{})
+
+	if results[0].Err != nil || absent.Deleted {
+		t.Errorf("Expected nothing to be done, got deleted=%v err=%v", absent.Deleted, results[0].Err)
+	}
+}
+
+func TestRollbackImpl_ReportsFailures(t *testing.T) {
+	failing := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize", WriteTypeError: errors.New("write error")}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"}}}
+
+	results := RollbackImpl(s, []defaults.DefaultsCommand{failing}, make([]defaults.DomainCommand, 1), &defaults.MockPrivilegedRunner{})
+
+	if results[0].Err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func TestRollbackImpl_SystemEntriesArePrivileged(t *testing.T) {
+	system := defaults.Scope{System: true}
+	written := &defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "GuestEnabled", ScopeVal: system}
+	created := &defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "SHOWFULLNAME", ScopeVal: system, ReadResult: "1\n"}
+	absent := &defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "LoginHook", ScopeVal: system, ReadError: errors.New("does not exist")}
+	user := &defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "tilesize"}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{
+		{Domain: "com.apple.loginwindow", Key: "GuestEnabled", Exists: true, Value: "0", Type: "boolean", System: true},
+		{Domain: "com.apple.loginwindow", Key: "SHOWFULLNAME", Exists: false, System: true},
+		{Domain: "com.apple.loginwindow", Key: "LoginHook", Exists: false, System: true},
+		{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"},
+	}}
+	privileged := &defaults.MockPrivilegedRunner{Errors: []error{errors.New("sudo: a password is required")}}
+
+	results := RollbackImpl(s, []defaults.DefaultsCommand{written, created, absent, user}, make([]defaults.DomainCommand, 4), privileged)
+
+	expected := [][][]string{{
+		{"delete", "/Library/Preferences/com.apple.loginwindow", "SHOWFULLNAME"},
+		{"write", "/Library/Preferences/com.apple.loginwindow", "GuestEnabled", "-bool", "0"},
+	}}
+	if !reflect.DeepEqual(privileged.Invocations, expected) {
+		t.Errorf("Expected one privileged run %q, got %q", expected, privileged.Invocations)
+	}
+	if len(written.WrittenValues) != 0 || created.Deleted {
+		t.Error("Expected system entries not to be restored without privileges")
+	}
+	if results[1].Err == nil || !results[1].Deleted {
+		t.Errorf("Expected the error of the privileged delete, got %+v", results[1])
+	}
+	if results[0].Err != nil || results[2].Err != nil || !results[2].Deleted {
+		t.Errorf("Expected the other system entries to succeed, got %+v and %+v", results[0], results[2])
+	}
+	if !reflect.DeepEqual(user.WrittenValues, []string{"64"}) || results[3].Err != nil {
+		t.Errorf("Expected tilesize to be restored without privileges, got %q", user.WrittenValues)
+	}
+}
+
+func TestRollbackImpl_ContainersAreImported(t *testing.T) {
+	apps := `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<array>
+	<dict>
+		<key>GUID</key>
+		<integer>1234</integer>
+	</dict>
+</array>
+</plist>
+`
+	export := `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>persistent-apps</key>
+	<array/>
+	<key>tilesize</key>
+	<integer>48</integer>
+</dict>
+</plist>
+`
+	dock := &defaults.MockDomainCommand{DomainVal: "com.apple.dock", ExportResult: export}
+	s := &snapshot.Snapshot{Entries: []snapshot.Entry{
+		{Domain: "com.apple.dock", Key: "persistent-apps", Exists: true, Value: "({GUID = 1234;})", Type: "array", Plist: apps},
+		{Domain: "com.apple.finder", Key: "FavoriteTagNames", Exists: true, Value: "(Red)", Type: "array"},
+		{Domain: "com.apple.loginwindow", Key: "LoginHooks", Exists: true, Value: "(a)", Type: "array", Plist: apps, System: true},
+	}}
+	defaultsCmds := []defaults.DefaultsCommand{
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.dock", KeyVal: "persistent-apps"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.finder", KeyVal: "FavoriteTagNames"},
+		&defaults.MockDefaultsCommand{DomainVal: "com.apple.loginwindow", KeyVal: "LoginHooks"},
+	}
+	privileged := &defaults.MockPrivilegedRunner{}
+
+	results := RollbackImpl(s, defaultsCmds, []defaults.DomainCommand{dock, nil, nil}, privileged)
+
+	if results[0].Err != nil || len(dock.Imported) != 1 {
+		t.Fatalf("Expected persistent-apps to be restored with one import, got %v", results[0].Err)
+	}
+	imported := string(dock.Imported[0])
+	if !strings.Contains(imported, "<integer>1234</integer>") || !strings.Contains(imported, "<integer>48</integer>") {
+		t.Errorf("Expected the typed value merged into the domain, got:\n%s", imported)
+	}
+	if !errors.Is(results[1].Err, errContainerText) {
+		t.Errorf("Expected a container without its property list to be refused, got %v", results[1].Err)
+	}
+	if !errors.Is(results[2].Err, errSystemContainer) || len(privileged.Invocations) != 0 {
+		t.Errorf("Expected a system container to be refused, got %v", results[2].Err)
+	}
+	for i, cmd := range defaultsCmds {
+		if written := cmd.(*defaults.MockDefaultsCommand).WrittenValues; len(written) != 0 {
+			t.Errorf("Expected entry %d not to be written as text, got %q", i, written)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package parallel runs independent work items, such as the defaults commands
+// of a configuration's entries, on a bounded number of goroutines.
+package parallel
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultJobs is the number of items worked on at the same time when Limits
+// does not set one.
+const DefaultJobs = 8
+
+// DefaultTimeout bounds a single item when Limits does not set a timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Limits bound how many items run at the same time and how long each may take.
+type Limits struct {
+	// Jobs is the number of items worked on at the same time. DefaultJobs is
+	// used when it is zero or less.
+	Jobs int
+	// Timeout bounds each item. DefaultTimeout is used when it is zero or less.
+	Timeout time.Duration
+}
+
+func (l Limits) jobs() int {
+	if l.Jobs <= 0 {
+		return DefaultJobs
+	}
+	return l.Jobs
+}
+
+func (l Limits) timeout() time.Duration {
+	if l.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return l.Timeout
+}
+
+// Each calls fn for every index below n, with at most Jobs calls running at
+// the same time. Each call gets a context derived from ctx that expires after
+// Timeout. Callers store results by index, so their order does not depend on
+// the order the calls finish in.
+//
+// Once ctx is done no further calls start; Each waits for the running ones
+// and returns ctx.Err(), also when ctx ended during the last calls. It
+// returns nil when every call was made before ctx was done.
+func (l Limits) Each(ctx context.Context, n int, fn func(ctx context.Context, i int)) error {
+	jobs := l.jobs()
+	if jobs > n {
+		jobs = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				l.call(ctx, i, fn)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (l Limits) call(ctx context.Context, i int, fn func(ctx context.Context, i int)) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout())
+	defer cancel()
+	fn(ctx, i)
+}
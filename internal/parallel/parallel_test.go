@@ -0,0 +1,88 @@
+package parallel
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEach_BoundsConcurrency(t *testing.T) {
+	var running, peak int32
+	results := make([]int, 20)
+
+	err := Limits{Jobs: 3}.Each(context.Background(), len(results), func(ctx context.Context, i int) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		results[i] = i * i
+		atomic.AddInt32(&running, -1)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if peak > 3 {
+		t.Errorf("Expected at most 3 calls at the same time, got %d", peak)
+	}
+	for i, result := range results {
+		if result != i*i {
+			t.Errorf("Expected result %d at index %d, got %d", i*i, i, result)
+		}
+	}
+}
+
+func TestEach_Timeout(t *testing.T) {
+	var timedOut int32
+	err := Limits{Jobs: 2, Timeout: 10 * time.Millisecond}.Each(context.Background(), 2, func(ctx context.Context, i int) {
+		<-ctx.Done()
+		if ctx.Err() == context.DeadlineExceeded {
+			atomic.AddInt32(&timedOut, 1)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if timedOut != 2 {
+		t.Errorf("Expected both calls to time out, got %d", timedOut)
+	}
+}
+
+func TestEach_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var called []int
+
+	err := Limits{Jobs: 1}.Each(ctx, 10, func(ctx context.Context, i int) {
+		mu.Lock()
+		called = append(called, i)
+		mu.Unlock()
+		if i == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if len(called) > 4 {
+		t.Errorf("Expected calls to stop after the cancellation, got %v", called)
+	}
+}
+
+func TestEach_CancelDuringLastCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := Limits{Jobs: 2}.Each(ctx, 2, func(ctx context.Context, i int) {
+		if i == 1 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,491 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// binaryMagic starts every binary property list.
+const binaryMagic = "bplist00"
+
+// binaryTrailerSize is the size of the trailer that ends a binary property
+// list and locates its offset table.
+const binaryTrailerSize = 32
+
+// binaryEpoch is the reference date of binary plist dates, which are stored as
+// seconds relative to it.
+var binaryEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// maxBinaryDepth bounds the nesting of containers.
+const maxBinaryDepth = 512
+
+// maxBinaryObjects bounds the number of values decoded from one file. Objects
+// may be referenced more than once and are decoded again for every reference,
+// so a small malformed file could otherwise expand to billions of values.
+const maxBinaryObjects = 1 << 20
+
+// ParseBinary parses a binary property list (bplist00), the format macOS stores
+// preference files in. Scalars are stored the same way ParseXML stores them.
+func ParseBinary(data []byte) (*Value, error) {
+	if !bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return nil, fmt.Errorf("plist: not a binary property list")
+	}
+	if len(data) < len(binaryMagic)+binaryTrailerSize {
+		return nil, fmt.Errorf("plist: binary property list is truncated")
+	}
+	trailer := data[len(data)-binaryTrailerSize:]
+	p := &binaryParser{
+		data:          data,
+		offsetSize:    int(trailer[6]),
+		refSize:       int(trailer[7]),
+		numObjects:    binary.BigEndian.Uint64(trailer[8:]),
+		offsetTableAt: binary.BigEndian.Uint64(trailer[24:]),
+		ancestors:     map[uint64]bool{},
+	}
+	top := binary.BigEndian.Uint64(trailer[16:])
+	if p.offsetSize < 1 || p.offsetSize > 8 || p.refSize < 1 || p.refSize > 8 {
+		return nil, fmt.Errorf("plist: invalid binary trailer")
+	}
+	tableEnd := p.offsetTableAt + p.numObjects*uint64(p.offsetSize)
+	if p.numObjects == 0 || p.numObjects > uint64(len(data)) || tableEnd < p.offsetTableAt || tableEnd > uint64(len(data)-binaryTrailerSize) {
+		return nil, fmt.Errorf("plist: invalid binary offset table")
+	}
+	return p.object(top, 0)
+}
+
+type binaryParser struct {
+	data          []byte
+	offsetSize    int
+	refSize       int
+	numObjects    uint64
+	offsetTableAt uint64
+	// ancestors holds the containers being decoded, so that a reference back
+	// to one of them is reported as a cycle.
+	ancestors map[uint64]bool
+	// decoded counts the values decoded so far.
+	decoded int
+}
+
+func (p *binaryParser) object(ref uint64, depth int) (*Value, error) {
+	if ref >= p.numObjects {
+		return nil, fmt.Errorf("plist: object reference %d out of range", ref)
+	}
+	if depth > maxBinaryDepth {
+		return nil, fmt.Errorf("plist: containers nested too deeply")
+	}
+	if p.ancestors[ref] {
+		return nil, fmt.Errorf("plist: object %d contains itself", ref)
+	}
+	p.decoded++
+	if p.decoded > maxBinaryObjects {
+		return nil, fmt.Errorf("plist: more than %d values", maxBinaryObjects)
+	}
+	offset := readUint(p.data[p.offsetTableAt+ref*uint64(p.offsetSize):], p.offsetSize)
+	if offset < uint64(len(binaryMagic)) || offset >= p.offsetTableAt {
+		return nil, fmt.Errorf("plist: object offset %d out of range", offset)
+	}
+
+	marker := p.data[offset]
+	kind, info := marker>>4, int(marker&0x0f)
+	pos := offset + 1
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return &Value{Type: "boolean", Scalar: "0"}, nil
+		case 0x09:
+			return &Value{Type: "boolean", Scalar: "1"}, nil
+		}
+	case 0x1:
+		if info > 4 {
+			break
+		}
+		b, err := p.bytes(pos, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Type: "integer", Scalar: binaryInt(b)}, nil
+	case 0x2:
+		if info > 3 {
+			break
+		}
+		b, err := p.bytes(pos, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		switch len(b) {
+		case 4:
+			f := math.Float32frombits(binary.BigEndian.Uint32(b))
+			return &Value{Type: "float", Scalar: strconv.FormatFloat(float64(f), 'f', -1, 32)}, nil
+		case 8:
+			f := math.Float64frombits(binary.BigEndian.Uint64(b))
+			return &Value{Type: "float", Scalar: strconv.FormatFloat(f, 'f', -1, 64)}, nil
+		}
+	case 0x3:
+		if marker != 0x33 {
+			break
+		}
+		b, err := p.bytes(pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(b))
+		t := time.Unix(binaryEpoch.Unix()+int64(math.Round(seconds)), 0).UTC()
+		return &Value{Type: "date", Scalar: t.Format(DateLayout)}, nil
+	case 0x4, 0x5, 0x6, 0xa, 0xd:
+		count, pos, err := p.count(info, pos)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0x4:
+			b, err := p.bytes(pos, count)
+			if err != nil {
+				return nil, err
+			}
+			return &Value{Type: "data", Scalar: hex.EncodeToString(b)}, nil
+		case 0x5:
+			b, err := p.bytes(pos, count)
+			if err != nil {
+				return nil, err
+			}
+			return NewString(string(b)), nil
+		case 0x6:
+			b, err := p.bytes(pos, 2*count)
+			if err != nil {
+				return nil, err
+			}
+			units := make([]uint16, count)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(b[2*i:])
+			}
+			return NewString(string(utf16.Decode(units))), nil
+		case 0xa:
+			refs, err := p.refs(pos, count)
+			if err != nil {
+				return nil, err
+			}
+			p.ancestors[ref] = true
+			defer delete(p.ancestors, ref)
+			array := NewArray()
+			for _, child := range refs {
+				element, err := p.object(child, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				array.Array = append(array.Array, element)
+			}
+			return array, nil
+		case 0xd:
+			refs, err := p.refs(pos, 2*count)
+			if err != nil {
+				return nil, err
+			}
+			p.ancestors[ref] = true
+			defer delete(p.ancestors, ref)
+			dict := NewDict()
+			for i := 0; i < count; i++ {
+				key, err := p.object(refs[i], depth+1)
+				if err != nil {
+					return nil, err
+				}
+				if key.Type != "string" {
+					return nil, fmt.Errorf("plist: dictionary key is a %s", key.Type)
+				}
+				value, err := p.object(refs[count+i], depth+1)
+				if err != nil {
+					return nil, err
+				}
+				dict.Dict = append(dict.Dict, DictEntry{Key: key.Scalar, Value: value})
+			}
+			return dict, nil
+		}
+	}
+	return nil, fmt.Errorf("plist: unsupported object marker 0x%02x", marker)
+}
+
+// count returns the element count of a data, string or container object whose
+// marker carries info, and the position of its contents. A count of 15 or
+// more follows the marker as an integer object.
+func (p *binaryParser) count(info int, pos uint64) (int, uint64, error) {
+	if info != 0x0f {
+		return info, pos, nil
+	}
+	header, err := p.bytes(pos, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if header[0]>>4 != 0x1 || header[0]&0x0f > 3 {
+		return 0, 0, fmt.Errorf("plist: invalid count marker 0x%02x", header[0])
+	}
+	size := 1 << (header[0] & 0x0f)
+	b, err := p.bytes(pos+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := readUint(b, size)
+	if count > uint64(len(p.data)) {
+		return 0, 0, fmt.Errorf("plist: count %d out of range", count)
+	}
+	return int(count), pos + 1 + uint64(size), nil
+}
+
+// bytes returns n bytes at pos, which must lie before the offset table.
+func (p *binaryParser) bytes(pos uint64, n int) ([]byte, error) {
+	if n < 0 || pos+uint64(n) < pos || pos+uint64(n) > p.offsetTableAt {
+		return nil, fmt.Errorf("plist: object at offset %d is truncated", pos)
+	}
+	return p.data[pos : pos+uint64(n)], nil
+}
+
+func (p *binaryParser) refs(pos uint64, n int) ([]uint64, error) {
+	b, err := p.bytes(pos, n*p.refSize)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, n)
+	for i := range refs {
+		refs[i] = readUint(b[i*p.refSize:], p.refSize)
+	}
+	return refs, nil
+}
+
+func readUint(b []byte, size int) uint64 {
+	var n uint64
+	for _, c := range b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// binaryInt renders a big-endian integer. Integers of 1, 2 and 4 bytes are
+// unsigned, 8-byte integers are signed and 16-byte integers hold the values
+// above the int64 range.
+func binaryInt(b []byte) string {
+	if len(b) == 8 {
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(b)), 10)
+	}
+	if len(b) < 8 {
+		return strconv.FormatUint(readUint(b, len(b)), 10)
+	}
+	return new(big.Int).SetBytes(b).String()
+}
+
+// FormatBinary renders v as a binary property list. Scalars are expected in
+// the same form as for FormatXML.
+func FormatBinary(v *Value) ([]byte, error) {
+	var objects []*Value
+	var flatten func(v *Value)
+	flatten = func(v *Value) {
+		objects = append(objects, v)
+		for _, element := range v.Array {
+			flatten(element)
+		}
+		for _, entry := range v.Dict {
+			objects = append(objects, NewString(entry.Key))
+		}
+		for _, entry := range v.Dict {
+			flatten(entry.Value)
+		}
+	}
+	flatten(v)
+	refSize := uintSize(uint64(len(objects)))
+
+	var b bytes.Buffer
+	b.WriteString(binaryMagic)
+	offsets := make([]uint64, 0, len(objects))
+	for i, object := range objects {
+		offsets = append(offsets, uint64(b.Len()))
+		// Objects are numbered in the order flatten visits them, so the
+		// children of the object at index i start at index i+1.
+		if err := writeBinaryObject(&b, object, i+1, refSize); err != nil {
+			return nil, err
+		}
+	}
+
+	offsetTableAt := uint64(b.Len())
+	offsetSize := uintSize(offsetTableAt)
+	for _, offset := range offsets {
+		writeUint(&b, offset, offsetSize)
+	}
+	var trailer [binaryTrailerSize]byte
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objects)))
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], offsetTableAt)
+	b.Write(trailer[:])
+	return b.Bytes(), nil
+}
+
+// writeBinaryObject writes v, whose children FormatBinary numbered from next
+// on: the elements of an array, or the keys and then the values of a dict.
+func writeBinaryObject(b *bytes.Buffer, v *Value, next, refSize int) error {
+	switch v.Type {
+	case "array":
+		writeBinaryCount(b, 0xa, len(v.Array))
+		refs := next
+		for _, element := range v.Array {
+			writeUint(b, uint64(refs), refSize)
+			refs += countObjects(element)
+		}
+		return nil
+	case "dict":
+		writeBinaryCount(b, 0xd, len(v.Dict))
+		for i := range v.Dict {
+			writeUint(b, uint64(next+i), refSize)
+		}
+		refs := next + len(v.Dict)
+		for _, entry := range v.Dict {
+			writeUint(b, uint64(refs), refSize)
+			refs += countObjects(entry.Value)
+		}
+		return nil
+	case "string":
+		writeBinaryString(b, v.Scalar)
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(v.Scalar)) {
+		case "1", "true", "yes":
+			b.WriteByte(0x09)
+		case "0", "false", "no":
+			b.WriteByte(0x08)
+		default:
+			return fmt.Errorf("plist: invalid boolean %q", v.Scalar)
+		}
+	case "integer":
+		if err := writeBinaryInt(b, strings.TrimSpace(v.Scalar)); err != nil {
+			return err
+		}
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.Scalar), 64)
+		if err != nil {
+			return fmt.Errorf("plist: invalid real %q", v.Scalar)
+		}
+		b.WriteByte(0x23)
+		writeUint(b, math.Float64bits(f), 8)
+	case "date":
+		t, err := time.Parse(DateLayout, strings.TrimSpace(v.Scalar))
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, strings.TrimSpace(v.Scalar)); err != nil {
+				return fmt.Errorf("plist: invalid date %q", v.Scalar)
+			}
+		}
+		b.WriteByte(0x33)
+		writeUint(b, math.Float64bits(t.Sub(binaryEpoch).Seconds()), 8)
+	case "data":
+		data, err := hex.DecodeString(v.Scalar)
+		if err != nil {
+			return fmt.Errorf("plist: invalid data: %w", err)
+		}
+		writeBinaryCount(b, 0x4, len(data))
+		b.Write(data)
+	default:
+		return fmt.Errorf("plist: unknown type %q", v.Type)
+	}
+	return nil
+}
+
+// countObjects returns the number of objects FormatBinary writes for v.
+func countObjects(v *Value) int {
+	n := 1 + len(v.Dict)
+	for _, element := range v.Array {
+		n += countObjects(element)
+	}
+	for _, entry := range v.Dict {
+		n += countObjects(entry.Value)
+	}
+	return n
+}
+
+func writeBinaryCount(b *bytes.Buffer, kind byte, count int) {
+	if count < 0x0f {
+		b.WriteByte(kind<<4 | byte(count))
+		return
+	}
+	b.WriteByte(kind<<4 | 0x0f)
+	size := uintSize(uint64(count))
+	b.WriteByte(0x10 | byte(bitsLog2(size)))
+	writeUint(b, uint64(count), size)
+}
+
+func writeBinaryString(b *bytes.Buffer, s string) {
+	ascii := true
+	for i := 0; i < len(s) && ascii; i++ {
+		ascii = s[i] < 0x80
+	}
+	if ascii {
+		writeBinaryCount(b, 0x5, len(s))
+		b.WriteString(s)
+		return
+	}
+	units := utf16.Encode([]rune(s))
+	writeBinaryCount(b, 0x6, len(units))
+	for _, unit := range units {
+		writeUint(b, uint64(unit), 2)
+	}
+}
+
+func writeBinaryInt(b *bytes.Buffer, text string) error {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		if n < 0 {
+			b.WriteByte(0x13)
+			writeUint(b, uint64(n), 8)
+			return nil
+		}
+		size := uintSize(uint64(n))
+		if size == 8 {
+			b.WriteByte(0x13)
+		} else {
+			b.WriteByte(0x10 | byte(bitsLog2(size)))
+		}
+		writeUint(b, uint64(n), size)
+		return nil
+	}
+	n, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("plist: invalid integer %q", text)
+	}
+	b.WriteByte(0x14)
+	writeUint(b, 0, 8)
+	writeUint(b, n, 8)
+	return nil
+}
+
+// uintSize returns the number of bytes, 1, 2, 4 or 8, needed to store n.
+func uintSize(n uint64) int {
+	switch {
+	case n <= math.MaxUint8:
+		return 1
+	case n <= math.MaxUint16:
+		return 2
+	case n <= math.MaxUint32:
+		return 4
+	}
+	return 8
+}
+
+func bitsLog2(size int) int {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	}
+	return 3
+}
+
+func writeUint(b *bytes.Buffer, n uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		b.WriteByte(byte(n >> (8 * i)))
+	}
+}
@@ -0,0 +1,190 @@
+package plist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures in testdata were written by Python's plistlib, so they check
+// the decoders against an independent encoder.
+
+// typesFixture is the content of testdata/types.xml and testdata/types.bplist.
+const typesFixture = `{autohide = 1; autohide-delay = 0.5; big = 18446744073709551615; blob = <0a0b0c>; ` +
+	`empty-array = (); empty-dict = {}; lastShown = "2024-01-02 03:04:05 +0000"; launchanim = 0; ` +
+	`name = "Café ☕"; offset = -3; persistent-others = ({tile-data = {arrangement = 2; file-label = Downloads;}; ` +
+	`tile-type = directory-tile;}, plain); tilesize = 48;}`
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func TestDecode_Fixtures(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format Format
+	}{
+		{"types.xml", XMLFormat},
+		{"types.bplist", BinaryFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, format, err := Decode(readFixture(t, tc.name))
+			if err != nil {
+				t.Fatalf("Decode returned error: %v", err)
+			}
+			if format != tc.format {
+				t.Errorf("Expected format %s, got %s", tc.format, format)
+			}
+			if got := FormatText(v); got != typesFixture {
+				t.Errorf("Expected\n%s\ngot\n%s", typesFixture, got)
+			}
+			expectedTypes := map[string]string{
+				"autohide": "boolean", "autohide-delay": "float", "big": "integer", "blob": "data",
+				"lastShown": "date", "name": "string", "offset": "integer", "empty-dict": "dict",
+			}
+			for key, valueType := range expectedTypes {
+				if got := v.Get(key).Type; got != valueType {
+					t.Errorf("Expected %s to be a %s, got %s", key, valueType, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDecode_ManyObjects(t *testing.T) {
+	v, _, err := Decode(readFixture(t, "many.bplist"))
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if len(v.Dict) != 300 {
+		t.Fatalf("Expected 300 entries, got %d", len(v.Dict))
+	}
+	if got := v.Get("key299"); got == nil || got.Scalar != "value 299" {
+		t.Errorf("Expected key299 = value 299, got %+v", got)
+	}
+}
+
+func TestDecode_Text(t *testing.T) {
+	v, format, err := Decode([]byte(`{autohide = 1;}`))
+	if err != nil || format != TextFormat || v.Get("autohide") == nil {
+		t.Errorf("Expected the text format to be decoded, got %+v %s (%v)", v, format, err)
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	fixture, _, err := Decode(readFixture(t, "types.xml"))
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	many, _, err := Decode(readFixture(t, "many.bplist"))
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+
+	for _, format := range []Format{XMLFormat, BinaryFormat} {
+		for name, v := range map[string]*Value{"types": fixture, "many": many} {
+			t.Run(fmt.Sprintf("%s %s", name, format), func(t *testing.T) {
+				data, err := Encode(v, format)
+				if err != nil {
+					t.Fatalf("Encode returned error: %v", err)
+				}
+				got, gotFormat, err := Decode(data)
+				if err != nil {
+					t.Fatalf("Decode returned error: %v", err)
+				}
+				if gotFormat != format {
+					t.Errorf("Expected format %s, got %s", format, gotFormat)
+				}
+				if FormatText(got) != FormatText(v) {
+					t.Errorf("Expected\n%s\ngot\n%s", FormatText(v), FormatText(got))
+				}
+			})
+		}
+	}
+}
+
+func TestFormatBinary_LongValues(t *testing.T) {
+	var elements []*Value
+	for i := 0; i < 20; i++ {
+		elements = append(elements, NewString(fmt.Sprintf("element %d of a long array", i)))
+	}
+	v := NewDict(
+		DictEntry{Key: "array", Value: NewArray(elements...)},
+		DictEntry{Key: "negative", Value: &Value{Type: "integer", Scalar: "-9223372036854775808"}},
+		DictEntry{Key: "wide", Value: &Value{Type: "integer", Scalar: "70000"}},
+	)
+
+	data, err := FormatBinary(v)
+	if err != nil {
+		t.Fatalf("FormatBinary returned error: %v", err)
+	}
+	got, err := ParseBinary(data)
+	if err != nil {
+		t.Fatalf("ParseBinary returned error: %v", err)
+	}
+	if !Equal(got, v) {
+		t.Errorf("Expected %s, got %s", FormatText(v), FormatText(got))
+	}
+}
+
+func TestParseBinary_Errors(t *testing.T) {
+	valid := readFixture(t, "types.bplist")
+	badRef := append([]byte{}, valid...)
+	// Point the top object past the last object.
+	badRef[len(badRef)-9] = 0xff
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{"not binary", []byte("<plist/>")},
+		{"truncated", valid[:20]},
+		{"missing trailer", valid[:len(valid)-8]},
+		{"bad top object", badRef},
+		{"cycle", nestedArrays(1, true)},
+		{"shared references", nestedArrays(40, false)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseBinary(tc.data); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// nestedArrays returns a binary property list of levels arrays, each holding
+// the next object twice, followed by true or, with cycle, by an array holding
+// the first one. Decoding every reference expands to 2^levels values.
+func nestedArrays(levels int, cycle bool) []byte {
+	data := []byte(binaryMagic)
+	var offsets []byte
+	for i := 0; i < levels; i++ {
+		offsets = append(offsets, byte(len(data)))
+		data = append(data, 0xa2, byte(i+1), byte(i+1))
+	}
+	offsets = append(offsets, byte(len(data)))
+	if cycle {
+		data = append(data, 0xa1, 0)
+	} else {
+		data = append(data, 0x09)
+	}
+	offsetTableAt := len(data)
+	data = append(data, offsets...)
+
+	trailer := make([]byte, binaryTrailerSize)
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(offsets)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTableAt))
+	return append(data, trailer...)
+}
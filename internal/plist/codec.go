@@ -0,0 +1,60 @@
+package plist
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Format is a serialization of property lists.
+type Format int
+
+const (
+	// XMLFormat is the XML format printed by `defaults export` and read by
+	// `defaults import`.
+	XMLFormat Format = iota
+	// BinaryFormat is the bplist00 format preference files are stored in.
+	BinaryFormat
+	// TextFormat is the old-style format printed by `defaults read`.
+	TextFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case XMLFormat:
+		return "xml"
+	case BinaryFormat:
+		return "binary"
+	case TextFormat:
+		return "text"
+	}
+	return "unknown"
+}
+
+// Decode parses a property list in any of the formats and reports which one it
+// was in.
+func Decode(data []byte) (*Value, Format, error) {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case bytes.HasPrefix(data, []byte(binaryMagic)):
+		v, err := ParseBinary(data)
+		return v, BinaryFormat, err
+	case bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<!DOCTYPE")) || bytes.HasPrefix(trimmed, []byte("<plist")):
+		v, err := ParseXML(trimmed)
+		return v, XMLFormat, err
+	}
+	v, err := ParseText(string(data))
+	return v, TextFormat, err
+}
+
+// Encode renders v in format.
+func Encode(v *Value, format Format) ([]byte, error) {
+	switch format {
+	case XMLFormat:
+		return FormatXML(v)
+	case BinaryFormat:
+		return FormatBinary(v)
+	case TextFormat:
+		return []byte(FormatText(v)), nil
+	}
+	return nil, fmt.Errorf("plist: unknown format %d", format)
+}
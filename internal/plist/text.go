@@ -0,0 +1,428 @@
+package plist
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ParseText parses a value in the old-style (OpenStep) property list format
+// printed by `defaults read`, for example:
+//
+//	(
+//	    "com.apple.Safari",
+//	    {
+//	        "tile-type" = "file-tile";
+//	    }
+//	)
+//
+// The text format does not record scalar types, so every scalar is returned
+// as a string. Data is accepted both as <0a0b> and as the
+// {length = 2, bytes = 0x0a0b} form printed by newer macOS versions.
+func ParseText(text string) (*Value, error) {
+	p := &textParser{s: text}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q after value", p.s[p.pos])
+	}
+	return v, nil
+}
+
+type textParser struct {
+	s   string
+	pos int
+}
+
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("plist: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and // or /* */ comments.
+func (p *textParser) skipSpace() error {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			end := strings.IndexByte(p.s[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.s)
+			} else {
+				p.pos += end + 1
+			}
+		case strings.HasPrefix(p.s[p.pos:], "/*"):
+			end := strings.Index(p.s[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *textParser) peek() (byte, error) {
+	if err := p.skipSpace(); err != nil {
+		return 0, err
+	}
+	if p.pos >= len(p.s) {
+		return 0, p.errorf("unexpected end of input")
+	}
+	return p.s[p.pos], nil
+}
+
+func (p *textParser) expect(c byte) error {
+	next, err := p.peek()
+	if err != nil {
+		return err
+	}
+	if next != c {
+		return p.errorf("expected %q, found %q", c, next)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *textParser) parseValue() (*Value, error) {
+	c, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == '(':
+		return p.parseArray()
+	case c == '{':
+		return p.parseDict()
+	case c == '<':
+		return p.parseData()
+	case c == '"':
+		s, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return NewString(s), nil
+	case isUnquotedChar(c):
+		return NewString(p.parseUnquoted()), nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *textParser) parseArray() (*Value, error) {
+	p.pos++ // (
+	array := NewArray()
+	for {
+		c, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			p.pos++
+			return array, nil
+		}
+		element, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array.Array = append(array.Array, element)
+
+		c, err = p.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case ',':
+			p.pos++
+		case ')':
+		default:
+			return nil, p.errorf("expected ',' or ')' in array, found %q", c)
+		}
+	}
+}
+
+func (p *textParser) parseDict() (*Value, error) {
+	start := p.pos
+	p.pos++ // {
+	dict := NewDict()
+	for {
+		c, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == '}' {
+			p.pos++
+			return dict, nil
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('='); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c, err = p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == ',' && len(dict.Dict) == 0 && key == "length" {
+			// {length = 4, bytes = 0x01020304} is how newer macOS versions
+			// print data values.
+			p.pos = start
+			return p.parseLengthBytesData()
+		}
+		dict.Dict = append(dict.Dict, DictEntry{Key: key, Value: value})
+		if err := p.expect(';'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *textParser) parseKey() (string, error) {
+	c, err := p.peek()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case c == '"':
+		return p.parseQuoted()
+	case isUnquotedChar(c):
+		return p.parseUnquoted(), nil
+	default:
+		return "", p.errorf("expected dictionary key, found %q", c)
+	}
+}
+
+func (p *textParser) parseLengthBytesData() (*Value, error) {
+	end := strings.IndexByte(p.s[p.pos:], '}')
+	if end < 0 {
+		return nil, p.errorf("unterminated data")
+	}
+	body := p.s[p.pos+1 : p.pos+end]
+	p.pos += end + 1
+
+	var length int
+	var digits string
+	for _, part := range strings.Split(body, ",") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, p.errorf("malformed data %q", body)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case "length":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, p.errorf("malformed data length %q", value)
+			}
+			length = n
+		case "bytes":
+			if strings.Contains(value, "...") {
+				return nil, p.errorf("data value is truncated")
+			}
+			digits = strings.TrimPrefix(value, "0x")
+		default:
+			return nil, p.errorf("malformed data %q", body)
+		}
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(digits), ""))
+	if err != nil {
+		return nil, p.errorf("malformed data bytes: %v", err)
+	}
+	if len(data) != length {
+		return nil, p.errorf("data length %d does not match %d bytes", length, len(data))
+	}
+	return &Value{Type: "data", Scalar: hex.EncodeToString(data)}, nil
+}
+
+func (p *textParser) parseData() (*Value, error) {
+	end := strings.IndexByte(p.s[p.pos:], '>')
+	if end < 0 {
+		return nil, p.errorf("unterminated data")
+	}
+	digits := strings.Join(strings.Fields(p.s[p.pos+1:p.pos+end]), "")
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, p.errorf("malformed data: %v", err)
+	}
+	p.pos += end + 1
+	return &Value{Type: "data", Scalar: hex.EncodeToString(data)}, nil
+}
+
+func (p *textParser) parseUnquoted() string {
+	start := p.pos
+	for p.pos < len(p.s) && isUnquotedChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *textParser) parseQuoted() (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	var pending []uint16 // UTF-16 code units from \U escapes
+	flush := func() {
+		if len(pending) > 0 {
+			b.WriteString(string(utf16.Decode(pending)))
+			pending = pending[:0]
+		}
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			flush()
+			return b.String(), nil
+		case '\\':
+			if p.pos+1 >= len(p.s) {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.s[p.pos+1]
+			p.pos += 2
+			if e == 'U' || e == 'u' {
+				if p.pos+4 > len(p.s) {
+					return "", p.errorf("malformed unicode escape")
+				}
+				n, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 16)
+				if err != nil {
+					return "", p.errorf("malformed unicode escape %q", p.s[p.pos:p.pos+4])
+				}
+				pending = append(pending, uint16(n))
+				p.pos += 4
+				continue
+			}
+			flush()
+			if '0' <= e && e <= '7' {
+				n := int(e - '0')
+				for i := 0; i < 2 && p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '7'; i++ {
+					n = n*8 + int(p.s[p.pos]-'0')
+					p.pos++
+				}
+				b.WriteByte(byte(n))
+				continue
+			}
+			b.WriteByte(unescape(e))
+		default:
+			flush()
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'a':
+		return '\a'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'v':
+		return '\v'
+	default:
+		return c
+	}
+}
+
+func isUnquotedChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '$' || c == '+' || c == '/' || c == ':' || c == '.' || c == '-'
+}
+
+// FormatText renders v in the old-style property list format on a single
+// line, e.g. ("com.apple.Safari", {"tile-type" = "file-tile";}). The result is
+// accepted by ParseText and by `defaults write`.
+func FormatText(v *Value) string {
+	var b strings.Builder
+	writeText(&b, v)
+	return b.String()
+}
+
+func writeText(b *strings.Builder, v *Value) {
+	switch v.Type {
+	case "array":
+		b.WriteByte('(')
+		for i, element := range v.Array {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeText(b, element)
+		}
+		b.WriteByte(')')
+	case "dict":
+		b.WriteByte('{')
+		for i, entry := range v.Dict {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(quoteText(entry.Key))
+			b.WriteString(" = ")
+			writeText(b, entry.Value)
+			b.WriteByte(';')
+		}
+		b.WriteByte('}')
+	case "data":
+		b.WriteByte('<')
+		b.WriteString(v.Scalar)
+		b.WriteByte('>')
+	default:
+		b.WriteString(quoteText(v.Scalar))
+	}
+}
+
+// quoteText quotes s unless it only consists of characters that may appear
+// in an unquoted old-style string.
+func quoteText(s string) string {
+	plain := s != ""
+	for i := 0; i < len(s) && plain; i++ {
+		plain = isUnquotedChar(s[i])
+	}
+	if plain {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package plist
+
+import (
+	"reflect"
+	"testing"
+)
+
+const persistentApps = `(
+        {
+        GUID = 1234567890;
+        "tile-data" =         {
+            "bundle-identifier" = "com.apple.Safari";
+            "file-data" =             {
+                "_CFURLString" = "file:///Applications/Safari.app/";
+                "_CFURLStringType" = 15;
+            };
+            "file-label" = Safari;
+        };
+        "tile-type" = "file-tile";
+    },
+        {
+        GUID = 987654321;
+        "tile-data" =         {
+            "file-label" = "System Settings";
+        };
+        "tile-type" = "file-tile";
+    }
+)
+`
+
+func TestParseText_PersistentApps(t *testing.T) {
+	v, err := ParseText(persistentApps)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if v.Type != "array" || len(v.Array) != 2 {
+		t.Fatalf("Expected an array with 2 elements, got %+v", v)
+	}
+	tile := v.Array[0]
+	if tile.Type != "dict" {
+		t.Fatalf("Expected a dict, got %s", tile.Type)
+	}
+	if got := tile.Get("tile-type").Scalar; got != "file-tile" {
+		t.Errorf("Expected tile-type file-tile, got %q", got)
+	}
+	url := tile.Get("tile-data").Get("file-data").Get("_CFURLString").Scalar
+	if url != "file:///Applications/Safari.app/" {
+		t.Errorf("Expected Safari URL, got %q", url)
+	}
+	if got := v.Array[1].Get("tile-data").Get("file-label").Scalar; got != "System Settings" {
+		t.Errorf("Expected System Settings, got %q", got)
+	}
+}
+
+func TestParseText_Values(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected *Value
+	}{
+		{"unquoted string", "Safari", NewString("Safari")},
+		{"quoted string with escapes", `"a \"b\" \\ c\nd\te"`, NewString("a \"b\" \\ c\nd\te")},
+		{"unicode escapes", `"\U65e5\U672c \Ud83d\Ude00"`, NewString("日本 😀")},
+		{"octal escape", `"\033[0m"`, NewString("\x1b[0m")},
+		{"empty string", `""`, NewString("")},
+		{"empty array", "(\n)", NewArray()},
+		{"empty dict", "{\n}", NewDict()},
+		{"array with trailing comma", "(a, b,)", NewArray(NewString("a"), NewString("b"))},
+		{"nested array", "((a), ())", NewArray(NewArray(NewString("a")), NewArray())},
+		{"dict", `{a = 1; "b c" = (x);}`, NewDict(DictEntry{"a", NewString("1")}, DictEntry{"b c", NewArray(NewString("x"))})},
+		{"data", "<0a0B 0c>", &Value{Type: "data", Scalar: "0a0b0c"}},
+		{"length bytes data", "{length = 3, bytes = 0x0a0b0c}", &Value{Type: "data", Scalar: "0a0b0c"}},
+		{"empty length bytes data", "{length = 0, bytes = 0x}", &Value{Type: "data", Scalar: ""}},
+		{"comments", "( /* first */ a, // second\n b)", NewArray(NewString("a"), NewString("b"))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := ParseText(tc.text)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(v, tc.expected) {
+				t.Errorf("ParseText(%q) = %+v, expected %+v", tc.text, v, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseText_Errors(t *testing.T) {
+	testCases := []struct {
+		name string
+		text string
+	}{
+		{"empty input", ""},
+		{"unterminated array", "(a, b"},
+		{"missing comma", "(a b)"},
+		{"missing semicolon", "{a = b}"},
+		{"missing equals", "{a b;}"},
+		{"unterminated string", `"abc`},
+		{"trailing garbage", "(a) b"},
+		{"malformed data", "<0g>"},
+		{"truncated data", "{length = 512, bytes = 0x01020304 ... 0a0b0c0d}"},
+		{"unterminated comment", "/* (a)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseText(tc.text); err == nil {
+				t.Errorf("Expected error for %q, got nil", tc.text)
+			}
+		})
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    *Value
+		expected string
+	}{
+		{"plain string", NewString("Safari"), "Safari"},
+		{"string needing quotes", NewString(`System "Settings"`), `"System \"Settings\""`},
+		{"empty string", NewString(""), `""`},
+		{"array", NewArray(NewString("a"), NewString("b c")), `(a, "b c")`},
+		{"dict", NewDict(DictEntry{"tile-type", NewString("file-tile")}, DictEntry{"GUID", NewString("1")}), `{tile-type = file-tile; GUID = 1;}`},
+		{"data", &Value{Type: "data", Scalar: "0a0b"}, "<0a0b>"},
+		{"control characters", NewString("a\nb\x1b"), `"a\nb\033"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if text := FormatText(tc.value); text != tc.expected {
+				t.Errorf("FormatText() = %s, expected %s", text, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatText_RoundTrip(t *testing.T) {
+	v, err := ParseText(persistentApps)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reparsed, err := ParseText(FormatText(v))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(v, reparsed) {
+		t.Errorf("Round trip mismatch:\n%+v\n%+v", v, reparsed)
+	}
+}
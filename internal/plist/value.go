@@ -0,0 +1,143 @@
+// Package plist models property list values and converts them from and to the
+// old-style text format used by the macOS defaults command and the XML and
+// binary formats preference files are stored in.
+package plist
+
+// Value is a node of a property list value tree. Type uses the type names of
+// the mdefaults configuration file (string, integer, float, boolean, date,
+// data, array, dict). Scalar values are kept in their textual form, with data
+// stored as lowercase hexadecimal digits.
+type Value struct {
+	Type   string
+	Scalar string
+	Array  []*Value
+	Dict   []DictEntry
+}
+
+// DictEntry is a key/value pair of a dictionary. Dictionaries keep the order
+// of their entries so that values render the same way they were read.
+type DictEntry struct {
+	Key   string
+	Value *Value
+}
+
+// NewString returns a string value.
+func NewString(s string) *Value {
+	return &Value{Type: "string", Scalar: s}
+}
+
+// NewArray returns an array value holding elements.
+func NewArray(elements ...*Value) *Value {
+	return &Value{Type: "array", Array: elements}
+}
+
+// NewDict returns a dictionary value holding entries.
+func NewDict(entries ...DictEntry) *Value {
+	return &Value{Type: "dict", Dict: entries}
+}
+
+// IsContainer reports whether v is an array or a dictionary.
+func (v *Value) IsContainer() bool {
+	return v.Type == "array" || v.Type == "dict"
+}
+
+// Get returns the value stored under key in a dictionary, or nil.
+func (v *Value) Get(key string) *Value {
+	for _, entry := range v.Dict {
+		if entry.Key == key {
+			return entry.Value
+		}
+	}
+	return nil
+}
+
+// Set stores value under key in a dictionary, replacing an existing entry in
+// place or adding a new one at the end.
+func (v *Value) Set(key string, value *Value) {
+	for i := range v.Dict {
+		if v.Dict[i].Key == key {
+			v.Dict[i].Value = value
+			return
+		}
+	}
+	v.Dict = append(v.Dict, DictEntry{Key: key, Value: value})
+}
+
+// Delete removes the entry for key from a dictionary.
+func (v *Value) Delete(key string) {
+	for i := range v.Dict {
+		if v.Dict[i].Key == key {
+			v.Dict = append(v.Dict[:i], v.Dict[i+1:]...)
+			return
+		}
+	}
+}
+
+// Equal reports whether a and b hold the same value. Dictionary entries are
+// compared regardless of their order.
+func Equal(a, b *Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case "array":
+		if len(a.Array) != len(b.Array) {
+			return false
+		}
+		for i := range a.Array {
+			if !Equal(a.Array[i], b.Array[i]) {
+				return false
+			}
+		}
+		return true
+	case "dict":
+		if len(a.Dict) != len(b.Dict) {
+			return false
+		}
+		for _, entry := range a.Dict {
+			if !Equal(entry.Value, b.Get(entry.Key)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Scalar == b.Scalar
+	}
+}
+
+// Contains reports whether v includes every element of part: each element of
+// an array part must occur in the array v, and each entry of a dict part must
+// be present with an equal value in the dict v. Other values must be Equal.
+func Contains(v, part *Value) bool {
+	if v == nil || part == nil || v.Type != part.Type {
+		return Equal(v, part)
+	}
+	switch part.Type {
+	case "array":
+		for _, element := range part.Array {
+			found := false
+			for _, candidate := range v.Array {
+				if Equal(candidate, element) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case "dict":
+		for _, entry := range part.Dict {
+			if !Equal(v.Get(entry.Key), entry.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return Equal(v, part)
+	}
+}
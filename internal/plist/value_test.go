@@ -0,0 +1,91 @@
+package plist
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a        string
+		b        string
+		expected bool
+	}{
+		{"same strings", "a", "a", true},
+		{"different strings", "a", "b", false},
+		{"quoted and unquoted string", `"a"`, "a", true},
+		{"same arrays", "(a, b)", `("a", "b")`, true},
+		{"array order matters", "(a, b)", "(b, a)", false},
+		{"array length", "(a)", "(a, a)", false},
+		{"dict order does not matter", "{a = 1; b = 2;}", "{b = 2; a = 1;}", true},
+		{"dict values differ", "{a = 1;}", "{a = 2;}", false},
+		{"dict keys differ", "{a = 1;}", "{b = 1;}", false},
+		{"nested", "({a = (x, y);})", "({a = (x, y);})", true},
+		{"array and dict", "()", "{}", false},
+		{"data", "<0A0B>", "<0a 0b>", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Equal(mustParse(t, tc.a), mustParse(t, tc.b)); got != tc.expected {
+				t.Errorf("Equal(%s, %s) = %v, expected %v", tc.a, tc.b, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	testCases := []struct {
+		name     string
+		v        string
+		part     string
+		expected bool
+	}{
+		{"array contains elements", "(a, b, c)", "(c, a)", true},
+		{"array misses element", "(a, b)", "(d)", false},
+		{"empty part", "(a)", "()", true},
+		{"dict contains entries", "{a = 1; b = 2;}", "{b = 2;}", true},
+		{"dict entry differs", "{a = 1; b = 2;}", "{b = 3;}", false},
+		{"type mismatch", "(a)", "{a = 1;}", false},
+		{"scalars", "a", "a", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Contains(mustParse(t, tc.v), mustParse(t, tc.part)); got != tc.expected {
+				t.Errorf("Contains(%s, %s) = %v, expected %v", tc.v, tc.part, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEqual_Nil(t *testing.T) {
+	if !Equal(nil, nil) {
+		t.Error("Expected nil values to be equal")
+	}
+	if Equal(NewString("a"), nil) || Equal(nil, NewString("a")) {
+		t.Error("Expected nil and non-nil values to differ")
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	v := mustParse(t, `{a = 1; b = 2;}`)
+
+	v.Set("a", NewString("3"))
+	v.Set("c", NewString("4"))
+	v.Delete("b")
+	v.Delete("missing")
+
+	if got := FormatText(v); got != "{a = 3; c = 4;}" {
+		t.Errorf("Expected {a = 3; c = 4;}, got %s", got)
+	}
+}
+
+func mustParse(t *testing.T, text string) *Value {
+	t.Helper()
+	v, err := ParseText(text)
+	if err != nil {
+		t.Fatalf("ParseText(%q) returned error: %v", text, err)
+	}
+	return v
+}
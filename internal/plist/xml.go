@@ -0,0 +1,299 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout `defaults read` prints dates in. Dates decoded
+// from XML use it as their textual form.
+const DateLayout = "2006-01-02 15:04:05 -0700"
+
+// ParseXML parses an XML property list, such as the output of
+// `defaults export <domain> -`, and returns its top-level value. Unlike the
+// text format, XML records the type of every scalar. Scalars are stored the
+// way `defaults read` prints them: booleans as 1 or 0, dates in DateLayout
+// and data as hexadecimal digits.
+func ParseXML(data []byte) (*Value, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	start, err := nextStart(d)
+	if err != nil {
+		return nil, err
+	}
+	if start.Name.Local == "plist" {
+		if start, err = nextStart(d); err != nil {
+			return nil, err
+		}
+	}
+	return decodeXMLValue(d, start)
+}
+
+// nextStart returns the next start element, skipping the XML declaration,
+// the doctype, comments and whitespace.
+func nextStart(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return xml.StartElement{}, fmt.Errorf("plist: unexpected end of XML")
+		}
+		if err != nil {
+			return xml.StartElement{}, fmt.Errorf("plist: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return xml.StartElement{}, fmt.Errorf("plist: unexpected text %q", tok)
+			}
+		}
+	}
+}
+
+func decodeXMLValue(d *xml.Decoder, start xml.StartElement) (*Value, error) {
+	switch start.Name.Local {
+	case "array":
+		return decodeXMLArray(d)
+	case "dict":
+		return decodeXMLDict(d)
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		if start.Name.Local == "true" {
+			return &Value{Type: "boolean", Scalar: "1"}, nil
+		}
+		return &Value{Type: "boolean", Scalar: "0"}, nil
+	}
+
+	text, err := elementText(d)
+	if err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "string":
+		return NewString(text), nil
+	case "integer":
+		text = strings.TrimSpace(text)
+		if _, err := strconv.ParseInt(text, 0, 64); err != nil {
+			if _, err := strconv.ParseUint(text, 0, 64); err != nil {
+				return nil, fmt.Errorf("plist: invalid integer %q", text)
+			}
+		}
+		return &Value{Type: "integer", Scalar: text}, nil
+	case "real":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("plist: invalid real %q", text)
+		}
+		return &Value{Type: "float", Scalar: strconv.FormatFloat(f, 'f', -1, 64)}, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("plist: invalid date %q", text)
+		}
+		return &Value{Type: "date", Scalar: t.UTC().Format(DateLayout)}, nil
+	case "data":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("plist: invalid data: %w", err)
+		}
+		return &Value{Type: "data", Scalar: hex.EncodeToString(b)}, nil
+	}
+	return nil, fmt.Errorf("plist: unknown element <%s>", start.Name.Local)
+}
+
+func decodeXMLArray(d *xml.Decoder) (*Value, error) {
+	array := NewArray()
+	for {
+		start, end, err := nextChild(d)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return array, nil
+		}
+		element, err := decodeXMLValue(d, start)
+		if err != nil {
+			return nil, err
+		}
+		array.Array = append(array.Array, element)
+	}
+}
+
+func decodeXMLDict(d *xml.Decoder) (*Value, error) {
+	dict := NewDict()
+	for {
+		start, end, err := nextChild(d)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return dict, nil
+		}
+		if start.Name.Local != "key" {
+			return nil, fmt.Errorf("plist: expected <key> in dict, got <%s>", start.Name.Local)
+		}
+		key, err := elementText(d)
+		if err != nil {
+			return nil, err
+		}
+		start, end, err = nextChild(d)
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return nil, fmt.Errorf("plist: missing value for key %q", key)
+		}
+		value, err := decodeXMLValue(d, start)
+		if err != nil {
+			return nil, err
+		}
+		dict.Dict = append(dict.Dict, DictEntry{Key: key, Value: value})
+	}
+}
+
+// nextChild returns the next child element of the current container, or end
+// when the container is closed.
+func nextChild(d *xml.Decoder) (start xml.StartElement, end bool, err error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, false, fmt.Errorf("plist: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok, false, nil
+		case xml.EndElement:
+			return xml.StartElement{}, true, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) > 0 {
+				return xml.StartElement{}, false, fmt.Errorf("plist: unexpected text %q", tok)
+			}
+		}
+	}
+}
+
+// elementText returns the text of the current element and consumes its end.
+func elementText(d *xml.Decoder) (string, error) {
+	var b strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("plist: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			b.Write(tok)
+		case xml.EndElement:
+			return b.String(), nil
+		case xml.StartElement:
+			return "", fmt.Errorf("plist: unexpected <%s> inside a scalar", tok.Name.Local)
+		}
+	}
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+`
+
+// FormatXML renders v as an XML property list document, the format
+// `defaults import` reads. Scalars are expected in the form ParseXML returns
+// them; booleans may also be true/false or yes/no and dates may use RFC 3339.
+func FormatXML(v *Value) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xmlHeader)
+	if err := writeXML(&b, v, 0); err != nil {
+		return nil, err
+	}
+	b.WriteString("</plist>\n")
+	return b.Bytes(), nil
+}
+
+func writeXML(b *bytes.Buffer, v *Value, depth int) error {
+	indent := strings.Repeat("\t", depth)
+	switch v.Type {
+	case "array":
+		if len(v.Array) == 0 {
+			b.WriteString(indent + "<array/>\n")
+			return nil
+		}
+		b.WriteString(indent + "<array>\n")
+		for _, element := range v.Array {
+			if err := writeXML(b, element, depth+1); err != nil {
+				return err
+			}
+		}
+		b.WriteString(indent + "</array>\n")
+	case "dict":
+		if len(v.Dict) == 0 {
+			b.WriteString(indent + "<dict/>\n")
+			return nil
+		}
+		b.WriteString(indent + "<dict>\n")
+		for _, entry := range v.Dict {
+			writeXMLElement(b, indent+"\t", "key", entry.Key)
+			if err := writeXML(b, entry.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		b.WriteString(indent + "</dict>\n")
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(v.Scalar)) {
+		case "1", "true", "yes":
+			b.WriteString(indent + "<true/>\n")
+		case "0", "false", "no":
+			b.WriteString(indent + "<false/>\n")
+		default:
+			return fmt.Errorf("plist: invalid boolean %q", v.Scalar)
+		}
+	case "integer":
+		text := strings.TrimSpace(v.Scalar)
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			if _, err := strconv.ParseUint(text, 10, 64); err != nil {
+				return fmt.Errorf("plist: invalid integer %q", v.Scalar)
+			}
+		}
+		writeXMLElement(b, indent, "integer", text)
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.Scalar), 64)
+		if err != nil {
+			return fmt.Errorf("plist: invalid real %q", v.Scalar)
+		}
+		writeXMLElement(b, indent, "real", strconv.FormatFloat(f, 'f', -1, 64))
+	case "date":
+		t, err := time.Parse(DateLayout, strings.TrimSpace(v.Scalar))
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, strings.TrimSpace(v.Scalar)); err != nil {
+				return fmt.Errorf("plist: invalid date %q", v.Scalar)
+			}
+		}
+		writeXMLElement(b, indent, "date", t.UTC().Format("2006-01-02T15:04:05Z"))
+	case "data":
+		data, err := hex.DecodeString(v.Scalar)
+		if err != nil {
+			return fmt.Errorf("plist: invalid data: %w", err)
+		}
+		writeXMLElement(b, indent, "data", base64.StdEncoding.EncodeToString(data))
+	case "string":
+		writeXMLElement(b, indent, "string", v.Scalar)
+	default:
+		return fmt.Errorf("plist: unknown type %q", v.Type)
+	}
+	return nil
+}
+
+func writeXMLElement(b *bytes.Buffer, indent, name, text string) {
+	b.WriteString(indent + "<" + name + ">")
+	// EscapeText only fails when writing to b fails, which it does not.
+	_ = xml.EscapeText(b, []byte(text))
+	b.WriteString("</" + name + ">\n")
+}
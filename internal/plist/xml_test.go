@@ -0,0 +1,159 @@
+package plist
+
+import (
+	"strings"
+	"testing"
+)
+
+const dockExport = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>autohide</key>
+	<true/>
+	<key>tilesize</key>
+	<integer>48</integer>
+	<key>autohide-delay</key>
+	<real>0.5</real>
+	<key>mod-count</key>
+	<integer>-3</integer>
+	<key>lastShown</key>
+	<date>2024-01-02T03:04:05Z</date>
+	<key>blob</key>
+	<data>
+	CgsM
+	</data>
+	<key>orientation</key>
+	<string>left &amp; bottom</string>
+	<key>persistent-others</key>
+	<array>
+		<dict>
+			<key>tile-type</key>
+			<string>directory-tile</string>
+			<key>enabled</key>
+			<false/>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+func TestParseXML(t *testing.T) {
+	v, err := ParseXML([]byte(dockExport))
+	if err != nil {
+		t.Fatalf("ParseXML returned error: %v", err)
+	}
+
+	testCases := []struct {
+		key       string
+		valueType string
+		scalar    string
+	}{
+		{"autohide", "boolean", "1"},
+		{"tilesize", "integer", "48"},
+		{"autohide-delay", "float", "0.5"},
+		{"mod-count", "integer", "-3"},
+		{"lastShown", "date", "2024-01-02 03:04:05 +0000"},
+		{"blob", "data", "0a0b0c"},
+		{"orientation", "string", "left & bottom"},
+	}
+	for _, tc := range testCases {
+		got := v.Get(tc.key)
+		if got == nil {
+			t.Errorf("Expected key %s to be present", tc.key)
+			continue
+		}
+		if got.Type != tc.valueType || got.Scalar != tc.scalar {
+			t.Errorf("Expected %s to be %s %q, got %s %q", tc.key, tc.valueType, tc.scalar, got.Type, got.Scalar)
+		}
+	}
+
+	expected := mustParse(t, `({"tile-type" = "directory-tile"; enabled = 0;})`)
+	expected.Array[0].Dict[1].Value.Type = "boolean"
+	if got := v.Get("persistent-others"); !Equal(got, expected) {
+		t.Errorf("Expected %s, got %s", FormatText(expected), FormatText(got))
+	}
+}
+
+func TestParseXML_Errors(t *testing.T) {
+	testCases := []struct {
+		name string
+		xml  string
+	}{
+		{"empty", ""},
+		{"unknown element", `<plist><color>red</color></plist>`},
+		{"invalid integer", `<plist><integer>many</integer></plist>`},
+		{"invalid date", `<plist><date>yesterday</date></plist>`},
+		{"value without key", `<plist><dict><string>a</string></dict></plist>`},
+		{"key without value", `<plist><dict><key>a</key></dict></plist>`},
+		{"unterminated", `<plist><array><string>a</string>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseXML([]byte(tc.xml)); err == nil {
+				t.Errorf("Expected an error for %q", tc.xml)
+			}
+		})
+	}
+}
+
+func TestFormatXML_RoundTrip(t *testing.T) {
+	v, err := ParseXML([]byte(dockExport))
+	if err != nil {
+		t.Fatalf("ParseXML returned error: %v", err)
+	}
+
+	data, err := FormatXML(v)
+	if err != nil {
+		t.Fatalf("FormatXML returned error: %v", err)
+	}
+	got, err := ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML of formatted output returned error: %v\n%s", err, data)
+	}
+	if !Equal(got, v) {
+		t.Errorf("Expected the round trip to keep the value, got\n%s", data)
+	}
+}
+
+func TestFormatXML_Scalars(t *testing.T) {
+	testCases := []struct {
+		value    *Value
+		expected string
+	}{
+		{&Value{Type: "boolean", Scalar: "yes"}, "<true/>"},
+		{&Value{Type: "boolean", Scalar: "false"}, "<false/>"},
+		{&Value{Type: "date", Scalar: "2024-01-02T04:04:05+01:00"}, "<date>2024-01-02T03:04:05Z</date>"},
+		{&Value{Type: "data", Scalar: "0a0b0c"}, "<data>CgsM</data>"},
+		{NewString("a < b"), "<string>a &lt; b</string>"},
+		{NewDict(), "<dict/>"},
+	}
+
+	for _, tc := range testCases {
+		data, err := FormatXML(tc.value)
+		if err != nil {
+			t.Fatalf("FormatXML returned error: %v", err)
+		}
+		if !strings.Contains(string(data), "\n"+tc.expected+"\n") {
+			t.Errorf("Expected %s in\n%s", tc.expected, data)
+		}
+	}
+}
+
+func TestFormatXML_Errors(t *testing.T) {
+	testCases := []*Value{
+		{Type: "boolean", Scalar: "maybe"},
+		{Type: "integer", Scalar: "many"},
+		{Type: "float", Scalar: "half"},
+		{Type: "date", Scalar: "yesterday"},
+		{Type: "data", Scalar: "xyz"},
+		NewArray(&Value{Type: "color", Scalar: "red"}),
+	}
+
+	for _, v := range testCases {
+		if _, err := FormatXML(v); err == nil {
+			t.Errorf("Expected an error for %+v", v)
+		}
+	}
+}
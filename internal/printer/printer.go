@@ -13,3 +13,8 @@ func PrintError(message string) {
 func PrintSuccess(message string) {
 	color.Green("Success: %s", message)
 }
+
+// PrintWarning prints a warning message in yellow color
+func PrintWarning(message string) {
+	color.Yellow("Warning: %s", message)
+}
@@ -15,3 +15,9 @@ func TestPrintError(t *testing.T) {
 	// We can't easily capture colored output in tests
 	PrintError("Test error message")
 }
+
+func TestPrintWarning(t *testing.T) {
+	// This test simply verifies that the function doesn't panic
+	// We can't easily capture colored output in tests
+	PrintWarning("Test warning message")
+}
@@ -0,0 +1,52 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MockFileSystem is an in-memory implementation of the FileSystem interface
+// for testing.
+type MockFileSystem struct {
+	Files        map[string]string
+	MkdirAllErr  error
+	WriteFileErr error
+}
+
+func (m *MockFileSystem) ReadFile(name string) (string, error) {
+	content, ok := m.Files[name]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return content, nil
+}
+
+func (m *MockFileSystem) WriteFile(name string, content string) error {
+	if m.WriteFileErr != nil {
+		return m.WriteFileErr
+	}
+	if m.Files == nil {
+		m.Files = map[string]string{}
+	}
+	m.Files[name] = content
+	return nil
+}
+
+func (m *MockFileSystem) MkdirAll(path string) error {
+	return m.MkdirAllErr
+}
+
+func (m *MockFileSystem) ReadDir(name string) ([]string, error) {
+	var names []string
+	for path := range m.Files {
+		if filepath.Dir(path) == name {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	if names == nil {
+		return nil, os.ErrNotExist
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,134 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// idLayout formats snapshot IDs so that sorting them by name sorts them by
+// creation time.
+const idLayout = "20060102T150405.000000000Z"
+
+const fileExtension = ".json"
+
+// ErrNoSnapshots is returned by Latest when no snapshot has been taken yet.
+var ErrNoSnapshots = errors.New("no snapshots found")
+
+// FileSystem is the part of the file system snapshots are stored through.
+type FileSystem interface {
+	ReadFile(name string) (string, error)
+	WriteFile(name string, content string) error
+	MkdirAll(path string) error
+	ReadDir(name string) ([]string, error)
+}
+
+// Entry is the state of one key before push changed it.
+type Entry struct {
+	Domain string `json:"domain"`
+	Key    string `json:"key"`
+	// Host and System select the preferences of the key, see config.Config.
+	Host   string `json:"host,omitempty"`
+	System bool   `json:"system,omitempty"`
+	// Exists is false when the key was not set, in which case rolling back
+	// deletes it.
+	Exists bool   `json:"exists"`
+	Value  string `json:"value,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// Plist holds the value of array and dict keys as an XML property list,
+	// which keeps the types of nested values that Value, the text printed by
+	// defaults read, loses.
+	Plist string `json:"plist,omitempty"`
+}
+
+// Snapshot is the state of the keys a push was about to change.
+type Snapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// New creates a snapshot of entries taken at now.
+func New(entries []Entry, now time.Time) *Snapshot {
+	return &Snapshot{
+		ID:        now.UTC().Format(idLayout),
+		CreatedAt: now,
+		Entries:   entries,
+	}
+}
+
+// Dir returns the directory snapshots are stored in:
+// $XDG_STATE_HOME/mdefaults/snapshots, or ~/.local/state/mdefaults/snapshots
+// when XDG_STATE_HOME is not set.
+func Dir(homeDir string) string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" || !filepath.IsAbs(stateHome) {
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, "mdefaults", "snapshots")
+}
+
+// Save writes the snapshot to dir, creating dir if needed.
+func Save(fs FileSystem, dir string, s *Snapshot) error {
+	if err := fs.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(filepath.Join(dir, s.ID+fileExtension), string(content)+"\n")
+}
+
+// Load reads the snapshot with the given ID from dir.
+func Load(fs FileSystem, dir, id string) (*Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	content, err := fs.ReadFile(filepath.Join(dir, id+fileExtension))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal([]byte(content), &s); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+// List returns the IDs of the snapshots in dir, oldest first. A missing
+// directory has no snapshots.
+func List(fs FileSystem, dir string) ([]string, error) {
+	names, err := fs.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, name := range names {
+		if strings.HasSuffix(name, fileExtension) {
+			ids = append(ids, strings.TrimSuffix(name, fileExtension))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Latest loads the most recent snapshot in dir.
+func Latest(fs FileSystem, dir string) (*Snapshot, error) {
+	ids, err := List(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoSnapshots
+	}
+	return Load(fs, dir, ids[len(ids)-1])
+}
@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	fs := &MockFileSystem{}
+	s := New([]Entry{
+		{Domain: "com.apple.dock", Key: "tilesize", Exists: true, Value: "64", Type: "integer"},
+		{Domain: "com.apple.dock", Key: "autohide", Exists: false},
+	}, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC))
+
+	if err := Save(fs, "/state/snapshots", s); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	if s.ID != "20240501T123000.000000000Z" {
+		t.Errorf("Expected timestamp ID, got %s", s.ID)
+	}
+
+	loaded, err := Load(fs, "/state/snapshots", s.ID)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Entries, s.Entries) {
+		t.Errorf("Expected %+v, got %+v", s.Entries, loaded.Entries)
+	}
+}
+
+func TestSave_MkdirAllError(t *testing.T) {
+	fs := &MockFileSystem{MkdirAllErr: errors.New("permission denied")}
+	if err := Save(fs, "/state/snapshots", New(nil, time.Now())); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func TestLoad_InvalidID(t *testing.T) {
+	for _, id := range []string{"", "../config", "a/b"} {
+		if _, err := Load(&MockFileSystem{}, "/state/snapshots", id); err == nil {
+			t.Errorf("Expected an error for id %q, got nil", id)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	fs := &MockFileSystem{}
+	older := New([]Entry{{Domain: "a", Key: "old"}}, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	newer := New([]Entry{{Domain: "a", Key: "new"}}, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))
+	for _, s := range []*Snapshot{newer, older} {
+		if err := Save(fs, "/state/snapshots", s); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+	fs.Files["/state/snapshots/notes.txt"] = "ignored"
+
+	ids, err := List(fs, "/state/snapshots")
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{older.ID, newer.ID}) {
+		t.Errorf("Expected oldest first, got %q", ids)
+	}
+
+	latest, err := Latest(fs, "/state/snapshots")
+	if err != nil {
+		t.Fatalf("Failed to load latest snapshot: %v", err)
+	}
+	if latest.ID != newer.ID {
+		t.Errorf("Expected %s, got %s", newer.ID, latest.ID)
+	}
+}
+
+func TestLatest_NoSnapshots(t *testing.T) {
+	if _, err := Latest(&MockFileSystem{}, "/state/snapshots"); !errors.Is(err, ErrNoSnapshots) {
+		t.Errorf("Expected ErrNoSnapshots, got %v", err)
+	}
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	if dir := Dir("/Users/me"); dir != "/xdg/state/mdefaults/snapshots" {
+		t.Errorf("Expected XDG_STATE_HOME to be used, got %s", dir)
+	}
+
+	t.Setenv("XDG_STATE_HOME", "")
+	if dir := Dir("/Users/me"); dir != "/Users/me/.local/state/mdefaults/snapshots" {
+		t.Errorf("Expected ~/.local/state fallback, got %s", dir)
+	}
+}